@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// configureForActions adjusts opts when wait runs inside a GitHub Actions
+// job: failures are also written as workflow commands and to the job summary,
+// and the desktop notification is off unless the config turns it on.
+func configureForActions(opts *waitOptions, getenv func(string) string) {
+	if getenv("GITHUB_ACTIONS") != "true" {
+		return
+	}
+	opts.WorkflowCommands = true
+	opts.StepSummary = getenv("GITHUB_STEP_SUMMARY")
+	if opts.Notify.Enabled == nil {
+		off := false
+		opts.Notify.Enabled = &off
+	}
+}
+
+// escapeCommandData escapes the message of a workflow command.
+// https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions
+func escapeCommandData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeCommandProperty escapes a property value of a workflow command.
+func escapeCommandProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// writeErrorCommands writes an ::error workflow command for each failed job
+// in rep, so the failure shows up in the calling workflow's annotations.
+func writeErrorCommands(w io.Writer, rep *ghactions.RunReport) {
+	if len(rep.Failed) == 0 {
+		fmt.Fprintf(w, "::error title=%s::%s\n", escapeCommandProperty(rep.Run.Name+" failed"),
+			escapeCommandData(fmt.Sprintf("Workflow %q %s: %s", rep.Run.Name, rep.Run.StatusText(), rep.Run.HTMLURL)))
+		return
+	}
+	for _, f := range rep.Failed {
+		msg := fmt.Sprintf("Job %q failed in workflow %q", f.Job.Name, rep.Run.Name)
+		for _, a := range f.Annotations {
+			msg += "\n" + a.Message
+		}
+		if url := f.Job.FailedStepURL(); url != "" {
+			msg += "\n" + url
+		}
+		fmt.Fprintf(w, "::error title=%s::%s\n", escapeCommandProperty(rep.Run.Name+" / "+f.Job.Name+" failed"), escapeCommandData(msg))
+	}
+}
+
+// stepSummary collects what wait saw, to write as Markdown to the file in
+// $GITHUB_STEP_SUMMARY when it finishes.
+type stepSummary struct {
+	path    string
+	target  target
+	remote  *RemoteURL
+	rawLogs bool
+
+	runs    []ghactions.WorkflowRun
+	reports map[int64]*ghactions.RunReport
+}
+
+func newStepSummary(path string, t target, remote *RemoteURL, rawLogs bool) *stepSummary {
+	return &stepSummary{
+		path:    path,
+		target:  t,
+		remote:  remote,
+		rawLogs: rawLogs,
+		reports: make(map[int64]*ghactions.RunReport),
+	}
+}
+
+// setRuns records the latest state of the runs being waited on.
+func (s *stepSummary) setRuns(runs []ghactions.WorkflowRun) {
+	if s == nil {
+		return
+	}
+	s.runs = append(s.runs[:0], runs...)
+}
+
+// addReport records the jobs, and any failure details, of a run.
+func (s *stepSummary) addReport(rep *ghactions.RunReport) {
+	if s == nil {
+		return
+	}
+	s.reports[rep.Run.ID] = rep
+	for i := range s.runs {
+		if s.runs[i].ID == rep.Run.ID {
+			s.runs[i] = rep.Run
+		}
+	}
+}
+
+// write appends the Markdown summary to the step summary file. waitErr is
+// the error wait is about to return, if any.
+func (s *stepSummary) write(waitErr error) {
+	if s == nil || s.path == "" {
+		return
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not write the job summary: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(s.markdown(waitErr)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not write the job summary: %v\n", err)
+	}
+}
+
+// escapeTableCell makes s safe to use in a Markdown table cell.
+func escapeTableCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// codeFence returns a fence for a Markdown code block holding s, longer than
+// any run of backticks in s.
+func codeFence(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// jobDuration returns how long a job ran, or 0 if it hasn't finished.
+func jobDuration(job ghactions.Job) time.Duration {
+	if job.StartedAt == nil || job.CompletedAt == nil {
+		return 0
+	}
+	return job.CompletedAt.Sub(*job.StartedAt)
+}
+
+// markdown renders the summary: a table of runs, then each run's jobs, with
+// the log excerpt of failed jobs in a collapsible section.
+func (s *stepSummary) markdown(waitErr error) []byte {
+	var buf bytes.Buffer
+	repoURL := fmt.Sprintf("https://%s/%s/%s", s.remote.Host, s.remote.Path, s.remote.RepoName)
+	anyFailed := false
+	for _, run := range s.runs {
+		anyFailed = anyFailed || run.IsFailed()
+	}
+	result := "passed"
+	switch {
+	case anyFailed:
+		result = "failed"
+	case waitErr != nil:
+		result = "did not finish"
+	}
+	fmt.Fprintf(&buf, "### GitHub Actions on %s %s\n\n", s.target, result)
+	fmt.Fprintf(&buf, "[%s/%s](%s) at [`%s`](%s/commit/%s)\n\n", s.remote.Path, s.remote.RepoName, repoURL, shortRef(s.target.SHA), repoURL, s.target.SHA)
+	if waitErr != nil && !anyFailed {
+		fmt.Fprintf(&buf, "> %s\n\n", strings.ReplaceAll(waitErr.Error(), "\n", "\n> "))
+	}
+
+	if len(s.runs) > 0 {
+		buf.WriteString("| Workflow | Run | Result | Duration |\n")
+		buf.WriteString("| --- | --- | --- | --- |\n")
+		for _, run := range s.runs {
+			id := workflowRunIdentifier(run)
+			if id == "" {
+				id = "-"
+			}
+			fmt.Fprintf(&buf, "| [%s](%s) | %s | %s | %s |\n", escapeTableCell(run.Name), run.HTMLURL, id, run.StatusText(), durationString(run.Duration()))
+		}
+		buf.WriteByte('\n')
+	}
+
+	for _, run := range groupByWorkflow(s.runs) {
+		rep := s.reports[run.ID]
+		if rep == nil {
+			continue
+		}
+		fmt.Fprintf(&buf, "#### %s\n\n", escapeTableCell(workflowRunDisplayName(run)))
+		if rep.JobsErr != nil {
+			fmt.Fprintf(&buf, "Could not fetch jobs: %v\n\n", rep.JobsErr)
+			continue
+		}
+		buf.WriteString("| Job | Result | Duration |\n")
+		buf.WriteString("| --- | --- | --- |\n")
+		for _, job := range rep.Jobs {
+			status := string(job.Status)
+			if job.Conclusion != nil {
+				status = string(*job.Conclusion)
+			}
+			name := escapeTableCell(job.Name)
+			if job.HTMLURL != "" {
+				name = fmt.Sprintf("[%s](%s)", name, job.HTMLURL)
+			}
+			fmt.Fprintf(&buf, "| %s | %s | %s |\n", name, status, durationString(jobDuration(job)))
+		}
+		buf.WriteByte('\n')
+
+		for _, f := range rep.Failed {
+			fmt.Fprintf(&buf, "<details><summary>Job %q failed</summary>\n\n", f.Job.Name)
+			for _, a := range f.Annotations {
+				fmt.Fprintf(&buf, "> %s\n\n", strings.ReplaceAll(a.Message, "\n", "\n> "))
+			}
+			switch {
+			case f.LogsErr != nil:
+				fmt.Fprintf(&buf, "Could not fetch the job's logs: %v\n\n", f.LogsErr)
+			case len(f.Excerpt) > 0:
+				excerpt := f.Excerpt
+				if !s.rawLogs {
+					excerpt = ghactions.NormalizeLog(excerpt, ghactions.LogOptions{})
+				}
+				text := strings.TrimRight(string(excerpt), "\n")
+				fence := codeFence(text)
+				fmt.Fprintf(&buf, "%stext\n%s\n%s\n\n", fence, text, fence)
+			}
+			if url := f.Job.FailedStepURL(); url != "" {
+				fmt.Fprintf(&buf, "[View the failed step](%s)\n\n", url)
+			}
+			buf.WriteString("</details>\n\n")
+		}
+	}
+	return buf.Bytes()
+}
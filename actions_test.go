@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestConfigureForActions(t *testing.T) {
+	env := map[string]string{
+		"GITHUB_ACTIONS":      "true",
+		"GITHUB_STEP_SUMMARY": "/tmp/summary.md",
+	}
+	var opts waitOptions
+	configureForActions(&opts, func(k string) string { return env[k] })
+	if !opts.WorkflowCommands || opts.StepSummary != "/tmp/summary.md" {
+		t.Errorf("opts = %+v, want workflow commands and a step summary", opts)
+	}
+	if opts.Notify.IsEnabled() {
+		t.Errorf("notifications should be off in GitHub Actions")
+	}
+
+	on := true
+	opts = waitOptions{Notify: ghactions.NotifySettings{Enabled: &on}}
+	configureForActions(&opts, func(k string) string { return env[k] })
+	if !opts.Notify.IsEnabled() {
+		t.Errorf("notifications turned on in the config should stay on")
+	}
+
+	opts = waitOptions{}
+	configureForActions(&opts, func(string) string { return "" })
+	if opts.WorkflowCommands || opts.StepSummary != "" || !opts.Notify.IsEnabled() {
+		t.Errorf("outside GitHub Actions, opts = %+v, want it unchanged", opts)
+	}
+}
+
+func TestEscapeCommand(t *testing.T) {
+	if got, want := escapeCommandData("50% done\nnext: a,b"), "50%25 done%0Anext: a,b"; got != want {
+		t.Errorf("escapeCommandData() = %q, want %q", got, want)
+	}
+	if got, want := escapeCommandProperty("CI: test, lint"), "CI%3A test%2C lint"; got != want {
+		t.Errorf("escapeCommandProperty() = %q, want %q", got, want)
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	if got := codeFence("no backticks"); got != "```" {
+		t.Errorf("codeFence() = %q", got)
+	}
+	if got := codeFence("a ```` b"); got != "`````" {
+		t.Errorf("codeFence() = %q, want 5 backticks", got)
+	}
+}
+
+func failedRunReport() *ghactions.RunReport {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(90 * time.Second)
+	run := ghactions.WorkflowRun{
+		ID: 42, Name: "CI", RunNumber: 7, WorkflowID: 1,
+		Status: "completed", Conclusion: stringPtr("failure"),
+		HTMLURL: "https://github.com/o/r/actions/runs/42",
+	}
+	test := ghactions.Job{
+		ID: 99, Name: "test", Status: "completed", Conclusion: stringPtr("failure"),
+		StartedAt: &start, CompletedAt: &end,
+		HTMLURL: "https://github.com/o/r/actions/runs/42/job/99",
+	}
+	lint := ghactions.Job{ID: 98, Name: "lint | vet", Status: "completed", Conclusion: stringPtr("success")}
+	return &ghactions.RunReport{
+		Run:  run,
+		Jobs: []ghactions.Job{lint, test},
+		Failed: []ghactions.FailedJobReport{{
+			Job:         test,
+			Annotations: []ghactions.Annotation{{AnnotationLevel: "failure", Message: "Process completed with exit code 1."}},
+			Excerpt:     []byte("2026-01-01T10:01:29.0000000Z --- FAIL: TestFoo\n2026-01-01T10:01:30.0000000Z ##[error]Process completed with exit code 1.\n"),
+		}},
+	}
+}
+
+func TestWriteErrorCommands(t *testing.T) {
+	var buf bytes.Buffer
+	writeErrorCommands(&buf, failedRunReport())
+	want := "::error title=CI / test failed::Job \"test\" failed in workflow \"CI\"%0AProcess completed with exit code 1.%0Ahttps://github.com/o/r/actions/runs/42/job/99\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeErrorCommands() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestStepSummaryMarkdown(t *testing.T) {
+	remote := &RemoteURL{Host: "github.com", Path: "o", RepoName: "r"}
+	tip := "1a2b3c4d5e6f1a2b3c4d5e6f1a2b3c4d5e6f1a2b"
+	path := filepath.Join(t.TempDir(), "summary.md")
+	s := newStepSummary(path, target{Ref: "main", Branch: "main", SHA: tip}, remote, false)
+	rep := failedRunReport()
+	other := ghactions.WorkflowRun{ID: 43, Name: "Docs", Status: "completed", Conclusion: stringPtr("success"), HTMLURL: "https://github.com/o/r/actions/runs/43"}
+	s.setRuns([]ghactions.WorkflowRun{rep.Run, other})
+	s.addReport(rep)
+	s.write(errors.New("build on main failed"))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		"### GitHub Actions on main failed",
+		"[o/r](https://github.com/o/r) at [`1a2b3c4d`](https://github.com/o/r/commit/" + tip + ")",
+		"| [CI](https://github.com/o/r/actions/runs/42) | run 7 | failure |",
+		"| [Docs](https://github.com/o/r/actions/runs/43) | - | success |",
+		"#### CI [run 7]",
+		`| lint \| vet | success |`,
+		"| [test](https://github.com/o/r/actions/runs/42/job/99) | failure | 1m30s |",
+		`<details><summary>Job "test" failed</summary>`,
+		"> Process completed with exit code 1.",
+		"```text\n--- FAIL: TestFoo\n",
+		"</details>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary missing %q\ngot:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "2026-01-01T10:01:29") {
+		t.Errorf("log excerpt should be normalized\ngot:\n%s", out)
+	}
+
+	// The file is appended to, since other steps may have written to it.
+	s.write(nil)
+	data, _ = os.ReadFile(path)
+	if n := strings.Count(string(data), "### GitHub Actions on main"); n != 2 {
+		t.Errorf("got %d summaries after two writes, want 2", n)
+	}
+}
+
+func TestStepSummaryDidNotFinish(t *testing.T) {
+	remote := &RemoteURL{Host: "github.com", Path: "o", RepoName: "r"}
+	s := newStepSummary("unused", target{Ref: "main", Branch: "main", SHA: "abc"}, remote, false)
+	out := string(s.markdown(errors.New("no workflow runs appeared")))
+	if !strings.Contains(out, "main did not finish") || !strings.Contains(out, "> no workflow runs appeared") {
+		t.Errorf("markdown() =\n%s", out)
+	}
+}
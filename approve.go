@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// pendingApproval is a workflow run and the deployments it is waiting on.
+type pendingApproval struct {
+	Run         ghactions.WorkflowRun
+	Deployments []ghactions.PendingDeployment
+}
+
+// findPendingApprovals fetches the pending deployments for every run in the
+// waiting state.
+func findPendingApprovals(ctx context.Context, repoSvc *ghactions.RepoService, runs []ghactions.WorkflowRun) ([]pendingApproval, error) {
+	var approvals []pendingApproval
+	for _, run := range runs {
+		if run.Status != ghactions.StatusWaiting {
+			continue
+		}
+		deployments, err := repoSvc.ListPendingDeployments(ctx, run.ID)
+		if err != nil {
+			return nil, fmt.Errorf("listing pending deployments for %q: %w", run.Name, err)
+		}
+		if len(deployments) > 0 {
+			approvals = append(approvals, pendingApproval{Run: run, Deployments: deployments})
+		}
+	}
+	return approvals, nil
+}
+
+// environmentNames returns the names of the environments in deployments.
+func environmentNames(deployments []ghactions.PendingDeployment) []string {
+	names := make([]string, 0, len(deployments))
+	for _, d := range deployments {
+		names = append(names, d.Environment.Name)
+	}
+	return names
+}
+
+// describeDeployment summarizes who can approve a deployment and how long its
+// wait timer has left, e.g. "reviewers: @octocat; wait timer ends 15:04".
+func describeDeployment(now time.Time, d ghactions.PendingDeployment) string {
+	var parts []string
+	if reviewers := d.ReviewerList(); reviewers != "" {
+		parts = append(parts, "reviewers: "+reviewers)
+	}
+	if ends, ok := d.WaitTimerEndsAt(); ok {
+		if ends.After(now) {
+			parts = append(parts, fmt.Sprintf("wait timer ends %s (~%s left)", ends.Format("15:04"), formatEstimate(ends.Sub(now))))
+		} else {
+			parts = append(parts, "wait timer elapsed")
+		}
+	} else if d.WaitTimer > 0 {
+		parts = append(parts, fmt.Sprintf("wait timer %dm", d.WaitTimer))
+	}
+	if !d.CurrentUserCanApprove {
+		parts = append(parts, "you can't approve this")
+	}
+	return strings.Join(parts, "; ")
+}
+
+func writePendingApprovals(w io.Writer, now time.Time, approvals []pendingApproval) {
+	for _, a := range approvals {
+		fmt.Fprintf(w, "%s is waiting on:\n", workflowRunDisplayName(a.Run))
+		for _, d := range a.Deployments {
+			if desc := describeDeployment(now, d); desc != "" {
+				fmt.Fprintf(w, "  %s (%s)\n", d.Environment.Name, desc)
+			} else {
+				fmt.Fprintf(w, "  %s\n", d.Environment.Name)
+			}
+		}
+		fmt.Fprintf(w, "  %s\n", a.Run.HTMLURL)
+	}
+}
+
+// matchesEnvironment reports whether name is one of environments, ignoring
+// case. An empty filter matches every environment.
+func matchesEnvironment(name string, environments []string) bool {
+	if len(environments) == 0 {
+		return true
+	}
+	for _, env := range environments {
+		if strings.EqualFold(env, name) {
+			return true
+		}
+	}
+	return false
+}
+
+type approveOptions struct {
+	List         bool
+	Reject       bool
+	Comment      string
+	Environments []string // empty means every environment
+}
+
+func doApprove(ctx context.Context, client *ghactions.Client, remote *RemoteURL, w io.Writer, t target, opts approveOptions) error {
+	tip := t.SHA
+	repoSvc := client.Repo(remote.Path, remote.RepoName)
+	runs, err := repoSvc.FindWorkflowRunsForCommit(ctx, tip)
+	if err != nil {
+		return err
+	}
+	approvals, err := findPendingApprovals(ctx, repoSvc, runs)
+	if err != nil {
+		return err
+	}
+	if len(approvals) == 0 {
+		fmt.Fprintf(w, "No workflow runs for %s are waiting on a deployment approval\n", shortRef(tip))
+		return nil
+	}
+	if opts.List {
+		writePendingApprovals(w, time.Now(), approvals)
+		return nil
+	}
+
+	state, verb := ghactions.DeploymentApproved, "Approved"
+	if opts.Reject {
+		state, verb = ghactions.DeploymentRejected, "Rejected"
+	}
+	reviewed := 0
+	var skipped []string
+	for _, a := range approvals {
+		var ids []int64
+		var names []string
+		for _, d := range a.Deployments {
+			if !matchesEnvironment(d.Environment.Name, opts.Environments) {
+				continue
+			}
+			if !d.CurrentUserCanApprove {
+				skipped = append(skipped, d.Environment.Name)
+				continue
+			}
+			ids = append(ids, d.Environment.ID)
+			names = append(names, d.Environment.Name)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if err := repoSvc.ReviewPendingDeployments(ctx, a.Run.ID, ids, state, opts.Comment); err != nil {
+			return fmt.Errorf("reviewing deployments for %q: %w", a.Run.Name, err)
+		}
+		reviewed += len(ids)
+		fmt.Fprintf(w, "%s %s %s to %s\n", verb, workflowRunDisplayName(a.Run), pluralize(len(ids), "deployment"), strings.Join(names, ", "))
+	}
+	if reviewed > 0 {
+		return nil
+	}
+	if len(skipped) > 0 {
+		return fmt.Errorf("you are not a required reviewer for %s", strings.Join(skipped, ", "))
+	}
+	var available []string
+	for _, a := range approvals {
+		available = append(available, environmentNames(a.Deployments)...)
+	}
+	return fmt.Errorf("no pending deployments match --environment %s (waiting on: %s)", strings.Join(opts.Environments, ","), strings.Join(available, ", "))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestDescribeDeployment(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 10, 0, 0, time.UTC)
+	started := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	reviewers := []ghactions.DeploymentReviewer{{Type: "User"}}
+	reviewers[0].Reviewer.Login = "octocat"
+
+	tests := []struct {
+		name string
+		d    ghactions.PendingDeployment
+		want string
+	}{
+		{
+			name: "reviewers",
+			d:    ghactions.PendingDeployment{Reviewers: reviewers, CurrentUserCanApprove: true},
+			want: "reviewers: @octocat",
+		},
+		{
+			name: "running wait timer",
+			d:    ghactions.PendingDeployment{WaitTimer: 30, WaitTimerStartedAt: &started, CurrentUserCanApprove: true},
+			want: "wait timer ends 10:30 (~20m left)",
+		},
+		{
+			name: "elapsed wait timer",
+			d:    ghactions.PendingDeployment{WaitTimer: 5, WaitTimerStartedAt: &started, CurrentUserCanApprove: true},
+			want: "wait timer elapsed",
+		},
+		{
+			name: "not a reviewer",
+			d:    ghactions.PendingDeployment{Reviewers: reviewers},
+			want: "reviewers: @octocat; you can't approve this",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeDeployment(now, tt.d); got != tt.want {
+				t.Errorf("describeDeployment() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesEnvironment(t *testing.T) {
+	if !matchesEnvironment("production", nil) {
+		t.Error("an empty filter should match every environment")
+	}
+	if !matchesEnvironment("Production", []string{"staging", "production"}) {
+		t.Error("environment names should match case-insensitively")
+	}
+	if matchesEnvironment("production", []string{"staging"}) {
+		t.Error("matchesEnvironment(production, [staging]) = true")
+	}
+}
+
+func TestWritePendingApprovals(t *testing.T) {
+	var buf bytes.Buffer
+	writePendingApprovals(&buf, time.Now(), []pendingApproval{{
+		Run: ghactions.WorkflowRun{Name: "Deploy", RunNumber: 12, HTMLURL: "https://github.com/o/r/actions/runs/5"},
+		Deployments: []ghactions.PendingDeployment{
+			{Environment: ghactions.Environment{Name: "staging"}, CurrentUserCanApprove: true},
+		},
+	}})
+	want := "Deploy [run 12] is waiting on:\n  staging\n  https://github.com/o/r/actions/runs/5\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writePendingApprovals() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// cancelConcurrency is the number of cancel requests in flight at once.
+const cancelConcurrency = 4
+
+// maxStaleBranchRuns caps how many incomplete runs per status cancel
+// --all-branches looks at.
+const maxStaleBranchRuns = 500
+
+// cancelFilter scopes which runs cancel considers.
+type cancelFilter struct {
+	// Workflows and ExcludeWorkflows are globs matched against the
+	// workflow name and its file name, e.g. "CI" or "deploy-*.yml". An empty
+	// Workflows list matches every workflow.
+	Workflows        []string
+	ExcludeWorkflows []string
+	// OlderThan, if positive, skips runs created more recently than this.
+	OlderThan time.Duration
+}
+
+// matchesWorkflow reports whether run's workflow name or file name matches
+// any of the globs.
+func matchesWorkflow(run ghactions.WorkflowRun, globs []string) bool {
+	file := path.Base(run.Path)
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, run.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(glob, file); ok && run.Path != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// workflowFilter selects runs by workflow. Include and Exclude are globs
+// matched against the workflow name and its file name. An empty Include
+// matches every workflow.
+type workflowFilter struct {
+	Include []string
+	Exclude []string
+}
+
+func (f workflowFilter) matches(run ghactions.WorkflowRun) bool {
+	if len(f.Include) > 0 && !matchesWorkflow(run, f.Include) {
+		return false
+	}
+	return !matchesWorkflow(run, f.Exclude)
+}
+
+func (f workflowFilter) apply(runs []ghactions.WorkflowRun) []ghactions.WorkflowRun {
+	matched := make([]ghactions.WorkflowRun, 0, len(runs))
+	for _, run := range runs {
+		if f.matches(run) {
+			matched = append(matched, run)
+		}
+	}
+	return matched
+}
+
+// String describes the filter, e.g. "matching CI, excluding nightly*". It is
+// empty for a filter that matches everything.
+func (f workflowFilter) String() string {
+	var parts []string
+	if len(f.Include) > 0 {
+		parts = append(parts, "matching "+strings.Join(f.Include, ", "))
+	}
+	if len(f.Exclude) > 0 {
+		parts = append(parts, "excluding "+strings.Join(f.Exclude, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (f cancelFilter) matches(now time.Time, run ghactions.WorkflowRun) bool {
+	if !(workflowFilter{Include: f.Workflows, Exclude: f.ExcludeWorkflows}).matches(run) {
+		return false
+	}
+	if f.OlderThan > 0 && now.Sub(run.CreatedAt) < f.OlderThan {
+		return false
+	}
+	return true
+}
+
+func (f cancelFilter) apply(now time.Time, runs []ghactions.WorkflowRun) []ghactions.WorkflowRun {
+	matched := make([]ghactions.WorkflowRun, 0, len(runs))
+	for _, run := range runs {
+		if f.matches(now, run) {
+			matched = append(matched, run)
+		}
+	}
+	return matched
+}
+
+// cancelOptions configures the cancel subcommand.
+type cancelOptions struct {
+	DryRun bool
+	// AllBranches cancels runs on any branch whose remote head has moved on,
+	// instead of only older runs on one branch.
+	AllBranches bool
+	Filter      cancelFilter
+	// Force waits for each cancelled run to finish, and force-cancels runs
+	// that are still going ForceAfter after the normal cancel.
+	Force      bool
+	ForceAfter time.Duration
+}
+
+// cancelPollInterval is how often cancel --force checks whether a run has
+// finished.
+var cancelPollInterval = 5 * time.Second
+
+// forceCancelTimeout is how long cancel --force waits for a run to finish
+// after force-cancelling it.
+const forceCancelTimeout = 2 * time.Minute
+
+// staleRuns returns the incomplete runs whose branch head on the remote has
+// moved on from the commit the run is testing. heads maps branch name to
+// commit SHA. Runs on branches that no longer exist on the remote, and runs
+// for pull requests from forks, are left alone.
+func staleRuns(repoFullName string, runs []ghactions.WorkflowRun, heads map[string]string) []ghactions.WorkflowRun {
+	stale := make([]ghactions.WorkflowRun, 0, len(runs))
+	for _, run := range runs {
+		if run.IsCompleted() {
+			continue
+		}
+		if run.HeadRepository.FullName != "" && !strings.EqualFold(run.HeadRepository.FullName, repoFullName) {
+			continue
+		}
+		head, ok := heads[run.HeadBranch]
+		if !ok || head == run.HeadSha {
+			continue
+		}
+		stale = append(stale, run)
+	}
+	return stale
+}
+
+// listIncompleteRuns lists queued, waiting and in-progress runs on every
+// branch.
+func listIncompleteRuns(ctx context.Context, repoSvc *ghactions.RepoService) ([]ghactions.WorkflowRun, error) {
+	var runs []ghactions.WorkflowRun
+	seen := make(map[int64]bool)
+	for _, status := range []ghactions.RunStatus{ghactions.StatusInProgress, ghactions.StatusQueued, ghactions.StatusWaiting} {
+		page, err := repoSvc.ListAllWorkflowRuns(ctx, url.Values{"status": {string(status)}}, maxStaleBranchRuns)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s workflow runs: %w", status, err)
+		}
+		for _, run := range page {
+			// A run can change status between requests.
+			if !seen[run.ID] {
+				seen[run.ID] = true
+				runs = append(runs, run)
+			}
+		}
+	}
+	return runs, nil
+}
+
+// cancelResult is the outcome of cancelling one run.
+type cancelResult struct {
+	Run ghactions.WorkflowRun
+	// Forced is true if the run had to be force-cancelled.
+	Forced bool
+	Err    error
+}
+
+// waitForRunCompletion polls run until it reaches a terminal state or until
+// timeout passes. It returns the last status seen.
+func waitForRunCompletion(ctx context.Context, repoSvc *ghactions.RepoService, runID int64, timeout time.Duration) (ghactions.RunStatus, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		run, err := repoSvc.GetWorkflowRun(ctx, runID)
+		if err != nil {
+			return "", err
+		}
+		if run.IsCompleted() || !time.Now().Before(deadline) {
+			return run.Status, nil
+		}
+		select {
+		case <-ctx.Done():
+			return run.Status, ctx.Err()
+		case <-time.After(cancelPollInterval):
+		}
+	}
+}
+
+// cancelRun cancels one run. With opts.Force, it confirms that the run
+// actually finished, force-cancelling it if the normal cancel didn't take
+// effect within opts.ForceAfter.
+func cancelRun(ctx context.Context, repoSvc *ghactions.RepoService, run ghactions.WorkflowRun, opts cancelOptions) cancelResult {
+	result := cancelResult{Run: run}
+	if result.Err = repoSvc.CancelWorkflowRun(ctx, run.ID); result.Err != nil || !opts.Force {
+		return result
+	}
+	status, err := waitForRunCompletion(ctx, repoSvc, run.ID, opts.ForceAfter)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if status.IsTerminal() {
+		return result
+	}
+	result.Forced = true
+	if result.Err = repoSvc.ForceCancelWorkflowRun(ctx, run.ID); result.Err != nil {
+		return result
+	}
+	status, err = waitForRunCompletion(ctx, repoSvc, run.ID, forceCancelTimeout)
+	switch {
+	case err != nil:
+		result.Err = err
+	case !status.IsTerminal():
+		result.Err = fmt.Errorf("still %s %s after force-cancelling", status, formatWaitDuration(forceCancelTimeout))
+	}
+	return result
+}
+
+// cancelRuns cancels runs, at most cancelConcurrency at a time. With
+// opts.DryRun, it returns the runs without cancelling anything. Results are
+// in the same order as runs.
+func cancelRuns(ctx context.Context, repoSvc *ghactions.RepoService, runs []ghactions.WorkflowRun, opts cancelOptions) []cancelResult {
+	results := make([]cancelResult, len(runs))
+	sem := make(chan struct{}, cancelConcurrency)
+	var wg sync.WaitGroup
+	for i, run := range runs {
+		results[i].Run = run
+		if opts.DryRun {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = cancelRun(ctx, repoSvc, run, opts)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// writeCancelSummary prints a table of the cancel results and returns the
+// number of runs cancelled (or that would be, with dryRun) and the number
+// of failures.
+func writeCancelSummary(w io.Writer, now time.Time, results []cancelResult, dryRun bool) (cancelled, failed int) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Run.CreatedAt.Before(results[j].Run.CreatedAt)
+	})
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKFLOW\tRUN\tBRANCH\tCOMMIT\tAGE\tRESULT")
+	for _, r := range results {
+		result := "cancelled"
+		switch {
+		case dryRun:
+			result = "would cancel"
+			cancelled++
+		case r.Err != nil:
+			result = "error: " + r.Err.Error()
+			failed++
+		case r.Forced:
+			result = "force-cancelled"
+			cancelled++
+		default:
+			cancelled++
+		}
+		age := "-"
+		if !r.Run.CreatedAt.IsZero() {
+			age = durationString(now.Sub(r.Run.CreatedAt).Round(time.Second))
+		}
+		id := workflowRunIdentifier(r.Run)
+		if id == "" {
+			id = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Run.Name, id, r.Run.HeadBranch, shortRef(r.Run.HeadSha), age, result)
+	}
+	tw.Flush()
+	return cancelled, failed
+}
+
+// cancelAndSummarize cancels runs and prints the summary table. where
+// describes the scope, e.g. "on outdated branches", for the closing line.
+func cancelAndSummarize(ctx context.Context, w io.Writer, repoSvc *ghactions.RepoService, runs []ghactions.WorkflowRun, opts cancelOptions, where string) error {
+	if opts.Force && !opts.DryRun {
+		fmt.Fprintf(w, "Cancelling %d %s and waiting for each to finish...\n", len(runs), pluralize(len(runs), "workflow run"))
+	}
+	results := cancelRuns(ctx, repoSvc, runs, opts)
+	cancelled, failed := writeCancelSummary(w, time.Now(), results, opts.DryRun)
+	switch {
+	case opts.DryRun:
+		fmt.Fprintf(w, "Would cancel %d %s %s (dry run)\n", cancelled, pluralize(cancelled, "workflow run"), where)
+	default:
+		fmt.Fprintf(w, "Cancelled %d %s %s\n", cancelled, pluralize(cancelled, "workflow run"), where)
+	}
+	if failed > 0 {
+		return fmt.Errorf("could not cancel %d %s", failed, pluralize(failed, "workflow run"))
+	}
+	return nil
+}
+
+// cancelStaleBranchRuns cancels incomplete runs on every branch whose head on
+// the remote has moved on from the run's commit.
+func cancelStaleBranchRuns(ctx context.Context, w io.Writer, client *ghactions.Client, remote *RemoteURL, remoteName string, opts cancelOptions) error {
+	repoSvc := client.Repo(remote.Path, remote.RepoName)
+	heads, err := remoteHeads(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	runs, err := listIncompleteRuns(ctx, repoSvc)
+	if err != nil {
+		return err
+	}
+	stale := opts.Filter.apply(time.Now(), staleRuns(remote.Path+"/"+remote.RepoName, runs, heads))
+	if len(stale) == 0 {
+		fmt.Fprintf(w, "No workflow runs on %s/%s are testing an outdated branch head\n", remote.Path, remote.RepoName)
+		return nil
+	}
+	return cancelAndSummarize(ctx, w, repoSvc, stale, opts, "on outdated branches")
+}
+
+func doCancel(ctx context.Context, client *ghactions.Client, remote *RemoteURL, remoteName string, t target, opts cancelOptions) error {
+	if opts.AllBranches {
+		return cancelStaleBranchRuns(ctx, os.Stdout, client, remote, remoteName, opts)
+	}
+	if t.Branch == "" {
+		return fmt.Errorf("cancel needs a branch, but %s is not on one; pass a branch name or use --all-branches", t)
+	}
+	return cancelPreviousRunsForTip(ctx, client, remote, remoteName, t.Branch, t.SHA, false, opts)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestCancelFilter(t *testing.T) {
+	now := time.Now()
+	ci := ghactions.WorkflowRun{Name: "CI", Path: ".github/workflows/ci.yml", CreatedAt: now.Add(-time.Hour)}
+	deploy := ghactions.WorkflowRun{Name: "Deploy production", Path: ".github/workflows/deploy-prod.yml", CreatedAt: now.Add(-time.Minute)}
+
+	tests := []struct {
+		name   string
+		filter cancelFilter
+		want   []string
+	}{
+		{"no filter", cancelFilter{}, []string{"CI", "Deploy production"}},
+		{"name glob", cancelFilter{Workflows: []string{"C*"}}, []string{"CI"}},
+		{"file glob", cancelFilter{Workflows: []string{"deploy-*.yml"}}, []string{"Deploy production"}},
+		{"exclude", cancelFilter{ExcludeWorkflows: []string{"Deploy*"}}, []string{"CI"}},
+		{"older than", cancelFilter{OlderThan: 30 * time.Minute}, []string{"CI"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, run := range tt.filter.apply(now, []ghactions.WorkflowRun{ci, deploy}) {
+				got = append(got, run.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkflowFilterString(t *testing.T) {
+	tests := []struct {
+		filter workflowFilter
+		want   string
+	}{
+		{workflowFilter{}, ""},
+		{workflowFilter{Include: []string{"CI", "lint"}}, "matching CI, lint"},
+		{workflowFilter{Include: []string{"CI"}, Exclude: []string{"nightly*"}}, "matching CI, excluding nightly*"},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestStaleRuns(t *testing.T) {
+	heads := map[string]string{"main": "new", "feature": "abc"}
+	runs := []ghactions.WorkflowRun{
+		{ID: 1, Status: "in_progress", HeadBranch: "main", HeadSha: "old"},
+		{ID: 2, Status: "in_progress", HeadBranch: "main", HeadSha: "new"},
+		{ID: 3, Status: "queued", HeadBranch: "feature", HeadSha: "abc"},
+		{ID: 4, Status: "in_progress", HeadBranch: "deleted", HeadSha: "xyz"},
+		{ID: 5, Status: "completed", HeadBranch: "main", HeadSha: "old"},
+		{ID: 6, Status: "in_progress", HeadBranch: "main", HeadSha: "fork", HeadRepository: ghactions.RepositoryRef{FullName: "someone/r"}},
+		{ID: 7, Status: "waiting", HeadBranch: "main", HeadSha: "older", HeadRepository: ghactions.RepositoryRef{FullName: "O/R"}},
+	}
+	got := staleRuns("o/r", runs, heads)
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 7 {
+		t.Fatalf("staleRuns() = %+v, want runs 1 and 7", got)
+	}
+}
+
+func TestCancelRunsBoundedConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	var mu sync.Mutex
+	cancelled := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if strings.Contains(r.URL.Path, "/runs/3/") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"forbidden"}`))
+			return
+		}
+		mu.Lock()
+		cancelled[r.URL.Path] = true
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	client := ghactions.NewClient("token", "github.com")
+	client.Client.Base = srv.URL
+	repoSvc := client.Repo("o", "r")
+
+	var runs []ghactions.WorkflowRun
+	for i := int64(1); i <= 10; i++ {
+		runs = append(runs, ghactions.WorkflowRun{ID: i, Name: "CI"})
+	}
+	results := cancelRuns(context.Background(), repoSvc, runs, cancelOptions{})
+	if p := peak.Load(); p > cancelConcurrency {
+		t.Errorf("peak concurrency = %d, want at most %d", p, cancelConcurrency)
+	}
+	if len(cancelled) != 9 {
+		t.Errorf("cancelled %d runs, want 9", len(cancelled))
+	}
+	for i, r := range results {
+		if r.Run.ID != int64(i+1) {
+			t.Fatalf("results out of order: %+v", results)
+		}
+		if (r.Err != nil) != (r.Run.ID == 3) {
+			t.Errorf("run %d: err = %v", r.Run.ID, r.Err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, failed := writeCancelSummary(&buf, time.Now(), results, false)
+	if n != 9 || failed != 1 {
+		t.Errorf("writeCancelSummary() = %d, %d, want 9, 1", n, failed)
+	}
+	if !strings.Contains(buf.String(), "WORKFLOW") || !strings.Contains(buf.String(), "error: cancelling run 3") {
+		t.Errorf("summary missing header or error:\n%s", buf.String())
+	}
+}
+
+func TestCancelRunsDryRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("dry run made a request: %s %s", r.Method, r.URL.Path)
+	}))
+	defer srv.Close()
+	client := ghactions.NewClient("token", "github.com")
+	client.Client.Base = srv.URL
+
+	runs := []ghactions.WorkflowRun{{ID: 1, Name: "CI", RunNumber: 4, HeadBranch: "main", HeadSha: "0123456789"}}
+	results := cancelRuns(context.Background(), client.Repo("o", "r"), runs, cancelOptions{DryRun: true})
+	var buf bytes.Buffer
+	if n, _ := writeCancelSummary(&buf, time.Now(), results, true); n != 1 {
+		t.Errorf("writeCancelSummary() counted %d runs, want 1", n)
+	}
+	if !strings.Contains(buf.String(), "would cancel") || !strings.Contains(buf.String(), "01234567") {
+		t.Errorf("dry run summary:\n%s", buf.String())
+	}
+}
+
+func TestCancelRunForce(t *testing.T) {
+	defer func(d time.Duration) { cancelPollInterval = d }(cancelPollInterval)
+	cancelPollInterval = time.Millisecond
+
+	tests := []struct {
+		name       string
+		stuck      bool // the normal cancel has no effect
+		wantForced bool
+	}{
+		{"cancel takes effect", false, false},
+		{"stuck run", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var forced atomic.Bool
+			var cancelled atomic.Bool
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/o/r/actions/runs/1/cancel", func(w http.ResponseWriter, r *http.Request) {
+				cancelled.Store(!tt.stuck)
+				w.WriteHeader(http.StatusAccepted)
+			})
+			mux.HandleFunc("/repos/o/r/actions/runs/1/force-cancel", func(w http.ResponseWriter, r *http.Request) {
+				forced.Store(true)
+				w.WriteHeader(http.StatusAccepted)
+			})
+			mux.HandleFunc("/repos/o/r/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+				if cancelled.Load() || forced.Load() {
+					w.Write([]byte(`{"id":1,"status":"completed","conclusion":"cancelled"}`))
+					return
+				}
+				w.Write([]byte(`{"id":1,"status":"in_progress"}`))
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+			client := ghactions.NewClient("token", "github.com")
+			client.Client.Base = srv.URL
+
+			run := ghactions.WorkflowRun{ID: 1, Name: "CI"}
+			result := cancelRun(context.Background(), client.Repo("o", "r"), run, cancelOptions{Force: true, ForceAfter: 20 * time.Millisecond})
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+			if result.Forced != tt.wantForced || forced.Load() != tt.wantForced {
+				t.Errorf("Forced = %v (force-cancel called: %v), want %v", result.Forced, forced.Load(), tt.wantForced)
+			}
+		})
+	}
+}
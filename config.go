@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// loadSettings reads the user config file, then the repository's
+// .github-actions.toml, which takes precedence. Outside a git repository only
+// the user config is read.
+func loadSettings(ctx context.Context) (*ghactions.Settings, error) {
+	user, err := ghactions.UserSettings()
+	if err != nil {
+		return nil, err
+	}
+	root, err := repoRoot(ctx)
+	if err != nil {
+		slog.Debug("not reading repository config", "error", err)
+		return user, nil
+	}
+	repo, err := ghactions.LoadSettings(filepath.Join(root, ghactions.RepoConfigFile))
+	if err != nil {
+		return nil, err
+	}
+	return user.Merge(repo), nil
+}
+
+// checkCommandTables returns an error if settings has flag defaults for a
+// subcommand that doesn't exist, most likely a typo.
+func checkCommandTables(settings *ghactions.Settings, flagSets ...*flag.FlagSet) error {
+	known := make(map[string]bool, len(flagSets))
+	names := make([]string, 0, len(flagSets))
+	for _, fs := range flagSets {
+		known[fs.Name()] = true
+		names = append(names, fs.Name())
+	}
+	for command := range settings.Commands {
+		if !known[command] {
+			return fmt.Errorf("config has a [%s] table, but there is no %q command (want one of %s)", command, command, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// inheritDefaults copies the flag defaults in the [from] config table into
+// the table for fs, for the flags fs has and its own table doesn't set. It
+// lets push use the [wait] settings.
+func inheritDefaults(settings *ghactions.Settings, from string, fs *flag.FlagSet) {
+	table := settings.Commands[fs.Name()]
+	for name, v := range settings.Commands[from] {
+		if fs.Lookup(name) == nil {
+			continue
+		}
+		if table == nil {
+			table = make(map[string]any)
+			settings.Commands[fs.Name()] = table
+		}
+		if _, ok := table[name]; !ok {
+			table[name] = v
+		}
+	}
+}
+
+// envFlagName returns the environment variable that sets a flag's default,
+// e.g. GH_ACTIONS_WAIT_FAILED_OUTPUT_LINES for "wait --failed-output-lines".
+func envFlagName(command, flagName string) string {
+	name := "GH_ACTIONS_" + command + "_" + flagName
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// configValue formats a TOML value the way it would be written on the command
+// line. Arrays become comma separated lists.
+func configValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool, int64, float64:
+		return fmt.Sprint(v), nil
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, elem := range v {
+			if _, ok := elem.([]any); ok {
+				return "", fmt.Errorf("nested arrays are not supported")
+			}
+			s, err := configValue(elem)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v (%T)", v, v)
+	}
+}
+
+// applyDefaults sets the flags in fs that weren't given on the command line.
+// In order of precedence, values come from GH_ACTIONS_<COMMAND>_<FLAG>
+// environment variables, the [<command>] table in the config, and, for the
+// --workflow and --exclude-workflow flags, the [workflows] table. Call it
+// after fs.Parse.
+func applyDefaults(fs *flag.FlagSet, settings *ghactions.Settings, getenv func(string) string) error {
+	command := fs.Name()
+	values := make(map[string]string)
+	sources := make(map[string]string) // flag name -> where the value came from
+	if fs.Lookup("workflow") != nil && len(settings.Workflows.Include) > 0 {
+		values["workflow"] = strings.Join(settings.Workflows.Include, ",")
+		sources["workflow"] = "config [workflows] include"
+	}
+	if fs.Lookup("exclude-workflow") != nil && len(settings.Workflows.Exclude) > 0 {
+		values["exclude-workflow"] = strings.Join(settings.Workflows.Exclude, ",")
+		sources["exclude-workflow"] = "config [workflows] exclude"
+	}
+	for name, v := range settings.Commands[command] {
+		source := fmt.Sprintf("config [%s] %s", command, name)
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: %s has no --%s flag", source, command, name)
+		}
+		s, err := configValue(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		values[name] = s
+		sources[name] = source
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		env := envFlagName(command, f.Name)
+		if v := getenv(env); v != "" {
+			values[f.Name] = v
+			sources[f.Name] = env
+		}
+	})
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("%s: %w", sources[name], err)
+		}
+	}
+	return nil
+}
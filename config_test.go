@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func newTestWaitFlags() (*flag.FlagSet, *string, *time.Duration, *int, *stringsFlag) {
+	fs := flag.NewFlagSet("wait", flag.ContinueOnError)
+	remote := fs.String("remote", "origin", "")
+	timeout := fs.Duration("timeout", time.Hour, "")
+	lines := fs.Int("failed-output-lines", 100, "")
+	var exclude stringsFlag
+	fs.Var(&exclude, "exclude-workflow", "")
+	return fs, remote, timeout, lines, &exclude
+}
+
+func TestApplyDefaultsPrecedence(t *testing.T) {
+	settings := &ghactions.Settings{
+		Workflows: ghactions.WorkflowFilter{Exclude: []string{"nightly*", "docs"}},
+		Commands: map[string]map[string]any{
+			"wait": {
+				"remote":              "upstream",
+				"timeout":             "2h",
+				"failed-output-lines": int64(300),
+			},
+		},
+	}
+	env := map[string]string{
+		"GH_ACTIONS_WAIT_TIMEOUT":             "3h",
+		"GH_ACTIONS_WAIT_FAILED_OUTPUT_LINES": "50",
+	}
+	fs, remote, timeout, lines, exclude := newTestWaitFlags()
+	if err := fs.Parse([]string{"--failed-output-lines", "10"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyDefaults(fs, settings, func(k string) string { return env[k] }); err != nil {
+		t.Fatal(err)
+	}
+	if *remote != "upstream" {
+		t.Errorf("remote = %q, want the config value upstream", *remote)
+	}
+	if *timeout != 3*time.Hour {
+		t.Errorf("timeout = %s, want the environment value 3h", *timeout)
+	}
+	if *lines != 10 {
+		t.Errorf("failed-output-lines = %d, want the command line value 10", *lines)
+	}
+	if got := exclude.String(); got != "nightly*,docs" {
+		t.Errorf("exclude-workflow = %q, want nightly*,docs", got)
+	}
+}
+
+func TestApplyDefaultsCommandTableOverridesWorkflows(t *testing.T) {
+	settings := &ghactions.Settings{
+		Workflows: ghactions.WorkflowFilter{Exclude: []string{"nightly*"}},
+		Commands: map[string]map[string]any{
+			"wait": {"exclude-workflow": []any{"deploy"}},
+		},
+	}
+	fs, _, _, _, exclude := newTestWaitFlags()
+	fs.Parse(nil)
+	if err := applyDefaults(fs, settings, func(string) string { return "" }); err != nil {
+		t.Fatal(err)
+	}
+	if got := exclude.String(); got != "deploy" {
+		t.Errorf("exclude-workflow = %q, want deploy", got)
+	}
+}
+
+func TestApplyDefaultsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands map[string]any
+		want     string
+	}{
+		{"unknown flag", map[string]any{"remtoe": "upstream"}, "wait has no --remtoe flag"},
+		{"bad value", map[string]any{"timeout": "forever"}, "config [wait] timeout"},
+		{"bad type", map[string]any{"remote": map[string]any{}}, "unsupported value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := &ghactions.Settings{Commands: map[string]map[string]any{"wait": tt.commands}}
+			fs, _, _, _, _ := newTestWaitFlags()
+			fs.Parse(nil)
+			err := applyDefaults(fs, settings, func(string) string { return "" })
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("applyDefaults() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInheritDefaults(t *testing.T) {
+	settings := &ghactions.Settings{Commands: map[string]map[string]any{
+		"wait": {"remote": "upstream", "timeout": "2h", "quiet": true},
+		"push": {"timeout": "3h"},
+	}}
+	push := flag.NewFlagSet("push", flag.ContinueOnError)
+	push.Duration("timeout", time.Hour, "")
+	push.Bool("quiet", false, "")
+	inheritDefaults(settings, "wait", push)
+	want := map[string]any{"timeout": "3h", "quiet": true}
+	if got := settings.Commands["push"]; len(got) != len(want) || got["timeout"] != want["timeout"] || got["quiet"] != want["quiet"] {
+		t.Errorf("[push] = %v, want %v", got, want)
+	}
+}
+
+func TestEnvFlagName(t *testing.T) {
+	if got := envFlagName("has-workflows", "remote"); got != "GH_ACTIONS_HAS_WORKFLOWS_REMOTE" {
+		t.Errorf("envFlagName = %q", got)
+	}
+	if got := envFlagName("wait", "failed-output-lines"); got != "GH_ACTIONS_WAIT_FAILED_OUTPUT_LINES" {
+		t.Errorf("envFlagName = %q", got)
+	}
+}
+
+func TestCheckCommandTables(t *testing.T) {
+	wait := flag.NewFlagSet("wait", flag.ContinueOnError)
+	open := flag.NewFlagSet("open", flag.ContinueOnError)
+	ok := &ghactions.Settings{Commands: map[string]map[string]any{"wait": {}}}
+	if err := checkCommandTables(ok, wait, open); err != nil {
+		t.Errorf("checkCommandTables() = %v, want nil", err)
+	}
+	typo := &ghactions.Settings{Commands: map[string]map[string]any{"wiat": {}}}
+	if err := checkCommandTables(typo, wait, open); err == nil || !strings.Contains(err.Error(), `no "wiat" command`) {
+		t.Errorf("checkCommandTables() = %v, want error about wiat", err)
+	}
+}
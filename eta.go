@@ -0,0 +1,166 @@
+package main
+
+import (
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// runETA is the estimated completion of a single workflow run.
+type runETA struct {
+	Finish time.Time
+	// Progress is the fraction of the estimated total run time that has
+	// elapsed, between 0 and 1. Incomplete runs never report 1.
+	Progress float64
+}
+
+// maxIncompleteProgress caps the progress of a run that is still going, so a
+// run that is taking longer than usual doesn't show a full bar.
+const maxIncompleteProgress = 0.99
+
+// estimateRunETA estimates when run will finish. When job profiles from the
+// duration history are available, the estimate accounts for jobs that have
+// already finished, the steps completed within running jobs, and the
+// (inferred) needs: chain of jobs that haven't started yet. Otherwise it falls
+// back to the run's median duration. It returns false if there is nothing to
+// base an estimate on.
+func estimateRunETA(now time.Time, run ghactions.WorkflowRun, jobs []ghactions.Job, profiles map[string]ghactions.JobProfile, median time.Duration) (runETA, bool) {
+	if run.IsCompleted() {
+		return runETA{Finish: run.UpdatedAt, Progress: 1}, true
+	}
+	start := now
+	if run.RunStartedAt != nil {
+		start = *run.RunStartedAt
+	}
+
+	var finish time.Time
+	switch {
+	case len(profiles) > 0:
+		finish = estimateJobsFinish(now, start, jobs, profiles)
+	case median > 0:
+		finish = start.Add(median)
+	default:
+		return runETA{}, false
+	}
+	if finish.Before(now) {
+		// Running longer than usual; the best guess is "any moment now".
+		finish = now
+	}
+
+	eta := runETA{Finish: finish}
+	if total := finish.Sub(start); total > 0 {
+		eta.Progress = float64(now.Sub(start)) / float64(total)
+	}
+	eta.Progress = min(max(eta.Progress, 0), maxIncompleteProgress)
+	return eta, true
+}
+
+// estimateJobsFinish returns the latest estimated finish time across the
+// run's current jobs and every job the history says usually runs. A job that
+// hasn't started begins once the jobs it needs have finished, and no earlier
+// than its usual offset from the start of the run.
+func estimateJobsFinish(now, runStart time.Time, jobs []ghactions.Job, profiles map[string]ghactions.JobProfile) time.Time {
+	current := make(map[string]*ghactions.Job, len(jobs))
+	for i := range jobs {
+		current[jobs[i].Name] = &jobs[i]
+	}
+
+	memo := make(map[string]time.Time)
+	visiting := make(map[string]bool)
+	var finishOf func(name string) time.Time
+	finishOf = func(name string) time.Time {
+		if f, ok := memo[name]; ok {
+			return f
+		}
+		if visiting[name] {
+			// Inferred dependencies should be acyclic, but don't
+			// recurse forever if the history is odd.
+			return now
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		job := current[name]
+		profile, hasProfile := profiles[name]
+		var f time.Time
+		switch {
+		case job != nil && job.Status.IsTerminal():
+			f = now
+			if job.CompletedAt != nil {
+				f = *job.CompletedAt
+			}
+		case job != nil && job.StartedAt != nil:
+			f = now.Add(remainingInJob(now, job, profile, hasProfile))
+		case !hasProfile:
+			// Queued with no history: nothing to add.
+			f = now
+		default:
+			begin := maxTime(now, runStart.Add(profile.StartOffset))
+			for _, need := range profile.Needs {
+				begin = maxTime(begin, finishOf(need))
+			}
+			f = begin.Add(profile.Duration)
+		}
+		memo[name] = f
+		return f
+	}
+
+	finish := now
+	for name := range current {
+		finish = maxTime(finish, finishOf(name))
+	}
+	for name := range profiles {
+		finish = maxTime(finish, finishOf(name))
+	}
+	return finish
+}
+
+// remainingInJob estimates how much longer a running job will take. With step
+// history, it sums the median duration of every step that hasn't finished,
+// minus the time the current step has already been running.
+func remainingInJob(now time.Time, job *ghactions.Job, profile ghactions.JobProfile, hasProfile bool) time.Duration {
+	if !hasProfile {
+		return 0
+	}
+	if len(profile.Steps) > 0 && len(job.Steps) > 0 {
+		steps := make(map[int]*ghactions.Step, len(job.Steps))
+		for i := range job.Steps {
+			steps[job.Steps[i].Number] = &job.Steps[i]
+		}
+		var remaining time.Duration
+		for _, ps := range profile.Steps {
+			step := steps[ps.Number]
+			switch {
+			case step != nil && step.Status.IsTerminal():
+			case step != nil && step.StartedAt != nil:
+				remaining += max(ps.Duration-now.Sub(*step.StartedAt), 0)
+			default:
+				remaining += ps.Duration
+			}
+		}
+		return remaining
+	}
+	return max(profile.Duration-now.Sub(*job.StartedAt), 0)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// progressBar renders a fixed-width bar for a fraction between 0 and 1.
+func progressBar(fraction float64, width int) string {
+	filled := int(fraction*float64(width) + 0.5)
+	filled = min(max(filled, 0), width)
+	bar := make([]rune, 0, width)
+	for i := range width {
+		if i < filled {
+			bar = append(bar, '█')
+		} else {
+			bar = append(bar, '░')
+		}
+	}
+	return string(bar)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestEstimateRunETAFromMedian(t *testing.T) {
+	now := time.Now()
+	run := ghactions.WorkflowRun{
+		Status:       "in_progress",
+		RunStartedAt: timeRef(now.Add(-4 * time.Minute)),
+	}
+	eta, ok := estimateRunETA(now, run, nil, nil, 10*time.Minute)
+	if !ok {
+		t.Fatal("estimateRunETA() ok = false, want true")
+	}
+	if got := eta.Finish.Sub(now); got != 6*time.Minute {
+		t.Errorf("remaining = %s, want 6m", got)
+	}
+	if eta.Progress < 0.39 || eta.Progress > 0.41 {
+		t.Errorf("Progress = %v, want 0.4", eta.Progress)
+	}
+
+	if _, ok := estimateRunETA(now, run, nil, nil, 0); ok {
+		t.Error("estimateRunETA() with no history should report ok = false")
+	}
+}
+
+func TestEstimateRunETAOverdue(t *testing.T) {
+	now := time.Now()
+	run := ghactions.WorkflowRun{
+		Status:       "in_progress",
+		RunStartedAt: timeRef(now.Add(-20 * time.Minute)),
+	}
+	eta, ok := estimateRunETA(now, run, nil, nil, 10*time.Minute)
+	if !ok || !eta.Finish.Equal(now) {
+		t.Errorf("overdue run ETA = %v, want now", eta.Finish)
+	}
+	if eta.Progress != maxIncompleteProgress {
+		t.Errorf("overdue Progress = %v, want %v", eta.Progress, maxIncompleteProgress)
+	}
+}
+
+func TestEstimateRunETAFollowsNeeds(t *testing.T) {
+	now := time.Now()
+	runStart := now.Add(-5 * time.Minute)
+	run := ghactions.WorkflowRun{
+		Status:       "in_progress",
+		RunStartedAt: timeRef(runStart),
+	}
+	// build (8m) -> test (10m) -> deploy (3m); lint (2m) runs alongside.
+	profiles := map[string]ghactions.JobProfile{
+		"build":  {Name: "build", Duration: 8 * time.Minute},
+		"lint":   {Name: "lint", Duration: 2 * time.Minute},
+		"test":   {Name: "test", Duration: 10 * time.Minute, StartOffset: 8 * time.Minute, Needs: []string{"build"}},
+		"deploy": {Name: "deploy", Duration: 3 * time.Minute, StartOffset: 18 * time.Minute, Needs: []string{"build", "test"}},
+	}
+	jobs := []ghactions.Job{
+		{Name: "build", Status: "in_progress", StartedAt: timeRef(runStart)},
+		{Name: "lint", Status: "completed", StartedAt: timeRef(runStart), CompletedAt: timeRef(runStart.Add(2 * time.Minute))},
+	}
+	eta, ok := estimateRunETA(now, run, jobs, profiles, 20*time.Minute)
+	if !ok {
+		t.Fatal("estimateRunETA() ok = false")
+	}
+	// build has 3m left, then test 10m, then deploy 3m.
+	if got := eta.Finish.Sub(now); got != 16*time.Minute {
+		t.Errorf("remaining = %s, want 16m", got)
+	}
+
+	// If build is slow, everything downstream shifts.
+	jobs[0].StartedAt = timeRef(now.Add(-time.Minute))
+	eta, _ = estimateRunETA(now, run, jobs, profiles, 20*time.Minute)
+	if got := eta.Finish.Sub(now); got != 20*time.Minute {
+		t.Errorf("remaining with late build = %s, want 20m", got)
+	}
+}
+
+func TestRemainingInJobUsesSteps(t *testing.T) {
+	now := time.Now()
+	profile := ghactions.JobProfile{
+		Duration: 10 * time.Minute,
+		Steps: []ghactions.StepSample{
+			{Number: 1, Duration: time.Minute},
+			{Number: 2, Duration: 5 * time.Minute},
+			{Number: 3, Duration: 4 * time.Minute},
+		},
+	}
+	job := &ghactions.Job{
+		StartedAt: timeRef(now.Add(-3 * time.Minute)),
+		Steps: []ghactions.Step{
+			{Number: 1, Status: "completed"},
+			{Number: 2, Status: "in_progress", StartedAt: timeRef(now.Add(-2 * time.Minute))},
+			{Number: 3, Status: "queued"},
+		},
+	}
+	if got := remainingInJob(now, job, profile, true); got != 7*time.Minute {
+		t.Errorf("remainingInJob() = %s, want 7m (3m of step 2 + 4m of step 3)", got)
+	}
+	if got := remainingInJob(now, job, profile, false); got != 0 {
+		t.Errorf("remainingInJob() without a profile = %s, want 0", got)
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		fraction float64
+		want     string
+	}{
+		{0, "░░░░░░░░░░"},
+		{0.5, "█████░░░░░"},
+		{0.99, "██████████"},
+		{1.5, "██████████"},
+	}
+	for _, tt := range tests {
+		if got := progressBar(tt.fraction, 10); got != tt.want {
+			t.Errorf("progressBar(%v) = %q, want %q", tt.fraction, got, tt.want)
+		}
+	}
+}
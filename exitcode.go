@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// Exit codes for every command that fails through checkError, so scripts can
+// tell a failed build apart from a problem reaching GitHub. has-workflows has
+// its own; see hasWorkflowsHelp.
+const (
+	exitOK = 0
+	// exitBuildFailed means a workflow run or job failed.
+	exitBuildFailed = 1
+	// exitError covers usage errors, and errors without a more specific
+	// code, e.g. a git command failing.
+	exitError = 2
+	// exitTimeout means --timeout ran out before the runs finished.
+	exitTimeout = 3
+	// exitNoRuns means there were no workflow runs to wait on: none
+	// appeared before --no-runs-timeout, none matched the filters, or the
+	// repository has no active workflows.
+	exitNoRuns = 4
+	// exitUnavailable means GitHub couldn't be reached, returned a server
+	// error, or rate limited the requests. Trying again later may work.
+	exitUnavailable = 5
+	// exitNeedsAttention means the runs are blocked until someone approves
+	// them or their deployments.
+	exitNeedsAttention = 6
+	// exitAuth means there is no token for the host, or GitHub rejected it.
+	exitAuth = 7
+	// exitStopped means the user pressed q in wait --interactive before
+	// the runs finished.
+	exitStopped = 8
+	// exitInterrupted is the conventional code for a command stopped by
+	// Ctrl-C, 128 + SIGINT.
+	exitInterrupted = 130
+)
+
+// buildFailedError is returned when one or more workflow runs failed.
+type buildFailedError struct {
+	target target
+	runs   []ghactions.WorkflowRun
+}
+
+func (e *buildFailedError) Error() string {
+	if len(e.runs) > 1 {
+		return fmt.Sprintf("build on %s failed: %d workflow runs failed (%s)", e.target, len(e.runs), runNames(e.runs))
+	}
+	return fmt.Sprintf("build on %s failed", e.target)
+}
+
+func (e *buildFailedError) ExitCode() int { return exitBuildFailed }
+
+// timeoutError is returned when --timeout runs out.
+type timeoutError struct {
+	msg string
+}
+
+func (e *timeoutError) Error() string { return e.msg }
+
+func (e *timeoutError) ExitCode() int { return exitTimeout }
+
+// noRunsError is returned when there are no workflow runs to wait on.
+type noRunsError struct {
+	msg string
+}
+
+func (e *noRunsError) Error() string { return e.msg }
+
+func (e *noRunsError) ExitCode() int { return exitNoRuns }
+
+// unreachableError is returned when GitHub couldn't be reached for longer
+// than the network stall budget. err is the last error seen.
+type unreachableError struct {
+	msg string
+	err error
+}
+
+func (e *unreachableError) Error() string { return e.msg }
+
+func (e *unreachableError) Unwrap() error { return e.err }
+
+func (e *unreachableError) ExitCode() int { return exitUnavailable }
+
+// needsAttentionErr is returned when every run that hasn't finished is
+// waiting for someone to act on it.
+type needsAttentionErr struct {
+	msg string
+}
+
+func (e *needsAttentionErr) Error() string { return e.msg }
+
+func (e *needsAttentionErr) ExitCode() int { return exitNeedsAttention }
+
+// stoppedError is returned when the user stops wait --interactive before
+// the runs finish, so a script doesn't mistake it for a passing build.
+type stoppedError struct {
+	target target
+	// interrupted is set if the user pressed Ctrl-C rather than q.
+	interrupted bool
+}
+
+func (e *stoppedError) Error() string {
+	return fmt.Sprintf("stopped waiting for GitHub Actions on %s; runs still in progress were not cancelled", e.target)
+}
+
+func (e *stoppedError) ExitCode() int {
+	if e.interrupted {
+		return exitInterrupted
+	}
+	return exitStopped
+}
+
+// exitCode returns the exit code for err: the code of the first error in
+// its chain with an ExitCode method, otherwise a code picked from the kind
+// of error.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var coder interface{ ExitCode() int }
+	if errors.As(err, &coder) {
+		return coder.ExitCode()
+	}
+	var tokenErr *ghactions.TokenNotFoundError
+	if errors.As(err, &tokenErr) {
+		return exitAuth
+	}
+	if _, ok := ghactions.IsRateLimitError(err); ok {
+		return exitUnavailable
+	}
+	var apiErr *ghactions.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized, apiErr.StatusCode == http.StatusForbidden:
+			return exitAuth
+		case apiErr.StatusCode >= 500:
+			return exitUnavailable
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return exitTimeout
+	}
+	if ghactions.IsRetryableError(err) {
+		return exitUnavailable
+	}
+	return exitError
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestExitCode(t *testing.T) {
+	now := time.Now()
+	tip := "0123456789abcdef"
+	netErr := &url.Error{Op: "Get", URL: "https://api.github.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"build failed", &buildFailedError{target: target{Ref: "main", Branch: "main"}}, exitBuildFailed},
+		{"wrapped build failure", fmt.Errorf("waiting: %w", &buildFailedError{}), exitBuildFailed},
+		{"--timeout", waitTimeoutError(now, now.Add(-time.Hour), now, tip, []ghactions.WorkflowRun{{Status: "in_progress"}}, nil), exitTimeout},
+		{"network stall", waitTimeoutError(now, now.Add(-time.Hour), now.Add(-10*time.Minute), tip, nil, netErr), exitUnavailable},
+		{"no runs", errNoWorkflowRuns, exitNoRuns},
+		{"no workflows", workflowConfigurationError("o", "r", &ghactions.WorkflowsResponse{}), exitNoRuns},
+		{"needs attention", needsAttentionError(target{Ref: "main"}, []ghactions.WorkflowRun{{Status: ghactions.StatusWaiting}}, nil), exitNeedsAttention},
+		{"no token", &ghactions.TokenNotFoundError{Host: "github.com"}, exitAuth},
+		{"bad credentials", &ghactions.Error{StatusCode: 401, Message: "Bad credentials"}, exitAuth},
+		{"server error", &ghactions.Error{StatusCode: 502, Message: "Bad Gateway"}, exitUnavailable},
+		{"not found", &ghactions.Error{StatusCode: 404, Message: "Not Found"}, exitError},
+		{"rate limited", &ghactions.RateLimitError{StatusCode: 403}, exitUnavailable},
+		{"network error", netErr, exitUnavailable},
+		{"deadline", fmt.Errorf("listing runs: %w", context.DeadlineExceeded), exitTimeout},
+		{"stopped with q", &stoppedError{target: target{Ref: "main"}}, exitStopped},
+		{"stopped with Ctrl-C", &stoppedError{target: target{Ref: "main"}, interrupted: true}, exitInterrupted},
+		{"other", errors.New("not a git repository"), exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildFailedErrorMessage(t *testing.T) {
+	tgt := target{Ref: "main", Branch: "main"}
+	if got, want := (&buildFailedError{target: tgt, runs: []ghactions.WorkflowRun{{Name: "CI"}}}).Error(), "build on main failed"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	err := &buildFailedError{target: tgt, runs: []ghactions.WorkflowRun{{Name: "CI"}, {Name: "Lint"}}}
+	if got, want := err.Error(), "build on main failed: 2 workflow runs failed (CI, Lint)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
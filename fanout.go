@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sync"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// maxConcurrentRequests is the most API requests a fan-out has in flight at
+// once.
+const maxConcurrentRequests = 4
+
+// requestConcurrency returns how many requests a fan-out should have in
+// flight, given the most recently observed rate limit. Once a quarter of the
+// budget or less is left - the point at which pollIntervalForRateLimit starts
+// backing off - requests go one at a time.
+func requestConcurrency(rl *ghactions.RateLimit) int {
+	if rl == nil || rl.Limit <= 0 || rl.Remaining*4 > rl.Limit {
+		return maxConcurrentRequests
+	}
+	return 1
+}
+
+// fanOut calls fn(i) for every i in [0, n), with up to requestConcurrency
+// calls running at once, and returns when they have all returned. The limit
+// is checked again before each call, so the fan-out slows down as the budget
+// shrinks. rateLimit may be nil, e.g. for requests spread across clients.
+// fn should store its result at index i, so callers can report results in
+// order.
+func fanOut(n int, rateLimit func() *ghactions.RateLimit, fn func(i int)) {
+	var (
+		mu       sync.Mutex
+		done     = sync.NewCond(&mu)
+		inFlight int
+		wg       sync.WaitGroup
+	)
+	limit := func() int {
+		if rateLimit == nil {
+			return maxConcurrentRequests
+		}
+		return requestConcurrency(rateLimit())
+	}
+	for i := range n {
+		mu.Lock()
+		for inFlight >= limit() {
+			done.Wait()
+		}
+		inFlight++
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(i)
+			mu.Lock()
+			inFlight--
+			done.Signal()
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
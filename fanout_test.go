@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// fanOutPeak runs a fan-out of n slow calls and returns the most that were
+// in flight at once.
+func fanOutPeak(t *testing.T, n int, rateLimit func() *ghactions.RateLimit) int32 {
+	t.Helper()
+	var inFlight, peak atomic.Int32
+	called := make([]bool, n)
+	fanOut(n, rateLimit, func(i int) {
+		cur := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if cur <= p || peak.CompareAndSwap(p, cur) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		called[i] = true
+		inFlight.Add(-1)
+	})
+	for i, ok := range called {
+		if !ok {
+			t.Errorf("fn(%d) was not called", i)
+		}
+	}
+	return peak.Load()
+}
+
+func TestFanOut(t *testing.T) {
+	if p := fanOutPeak(t, 12, nil); p < 2 || p > maxConcurrentRequests {
+		t.Errorf("peak concurrency = %d, want between 2 and %d", p, maxConcurrentRequests)
+	}
+	plenty := func() *ghactions.RateLimit { return &ghactions.RateLimit{Limit: 5000, Remaining: 4000} }
+	if p := fanOutPeak(t, 12, plenty); p > maxConcurrentRequests {
+		t.Errorf("peak concurrency = %d, want at most %d", p, maxConcurrentRequests)
+	}
+	low := func() *ghactions.RateLimit { return &ghactions.RateLimit{Limit: 5000, Remaining: 1000} }
+	if p := fanOutPeak(t, 6, low); p != 1 {
+		t.Errorf("peak concurrency with a low rate limit = %d, want 1", p)
+	}
+	fanOutPeak(t, 0, nil)
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/url"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
 )
 
 // gitTimeout is the maximum time to wait for a local git command to complete.
@@ -14,30 +20,113 @@ const gitTimeout = 10 * time.Second
 
 // RemoteURL holds parsed components of a git remote URL.
 type RemoteURL struct {
-	// Host is the hostname (e.g. "github.com")
+	// Host is the hostname (e.g. "github.com"). For an HTTPS remote on a
+	// non-standard port it includes the port, since the web UI and API are
+	// served there too.
 	Host string
 	// Path is the user or organization (e.g. "kevinburke" in github.com/kevinburke/repo)
 	Path string
 	// RepoName is the repository name (e.g. "repo")
 	RepoName string
+	// Scheme is "ssh" for SSH remotes, including the git@host:path form,
+	// and otherwise the URL scheme, e.g. "https".
+	Scheme string
+	// HostConfig is the [hosts] entry for Host in the user config file, if
+	// any. It holds the api_url, proxy and TLS settings for the host.
+	HostConfig ghactions.Host
 }
 
-// getRemoteURL returns a parsed RemoteURL for the named git remote.
+// getRemoteURL returns a parsed RemoteURL for the named git remote, after
+// applying url.<base>.insteadOf rewrites and SSH host aliases.
 func getRemoteURL(ctx context.Context, remoteName string) (*RemoteURL, error) {
-	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	gitCtx, cancel := context.WithTimeout(ctx, gitTimeout)
 	defer cancel()
-	out, err := exec.CommandContext(ctx, "git", "config", "--get", fmt.Sprintf("remote.%s.url", remoteName)).Output()
+	out, err := exec.CommandContext(gitCtx, "git", "remote", "get-url", remoteName).Output()
 	if err != nil {
 		return nil, fmt.Errorf("getting remote %q URL: %w", remoteName, err)
 	}
-	return parseRemoteURL(strings.TrimSpace(string(out)))
+	return resolveRemoteURL(ctx, strings.TrimSpace(string(out)))
+}
+
+// resolveRemoteURL parses a remote URL, maps an SSH host alias to the real
+// hostname, and looks up the host's api_url.
+func resolveRemoteURL(ctx context.Context, raw string) (*RemoteURL, error) {
+	remote, err := parseRemoteURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	host, ok, err := ghactions.LookupHost(ctx, remote.Host)
+	if err != nil {
+		return nil, err
+	}
+	if remote.Scheme == "ssh" {
+		resolved := resolveSSHHost(remote.Host, ok, func(alias string) string { return sshHostname(ctx, alias) })
+		if resolved != remote.Host {
+			remote.Host = resolved
+			host, ok, err = ghactions.LookupHost(ctx, remote.Host)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if ok {
+		remote.HostConfig = host
+	}
+	return remote, nil
+}
+
+// sshGitHubHost is where GitHub's SSH-over-port-443 setup sends github.com;
+// the API and tokens are still github.com's.
+const sshGitHubHost = "ssh.github.com"
+
+// resolveSSHHost returns the GitHub host for an SSH remote's host, following
+// an ~/.ssh/config alias with lookup. Hosts that are already github.com or
+// have a [hosts] entry (configured) are kept: an alias for them, like
+// "Hostname ssh.github.com", only changes how ssh connects.
+func resolveSSHHost(host string, configured bool, lookup func(string) string) string {
+	if host == "github.com" || configured {
+		return host
+	}
+	switch hostname := lookup(host); hostname {
+	case "":
+		return host
+	case sshGitHubHost:
+		return "github.com"
+	default:
+		return hostname
+	}
+}
+
+// sshHostname returns the hostname that ssh connects to for host, following
+// Host aliases in ~/.ssh/config (via "ssh -G"). It returns an empty string if
+// ssh isn't available.
+func sshHostname(ctx context.Context, host string) string {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ssh", "-G", host).Output()
+	if err != nil {
+		slog.Debug("could not resolve ssh host", "host", host, "error", err)
+		return ""
+	}
+	return parseSSHConfigHostname(string(out))
+}
+
+// parseSSHConfigHostname returns the hostname from "ssh -G" output.
+func parseSSHConfigHostname(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok && key == "hostname" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
 }
 
 // parseRemoteURL extracts the host, org/user and repo name from a git remote URL.
 // Supports:
-//   - SSH short form: git@github.com:user/repo.git
-//   - HTTPS: https://github.com/user/repo.git
-//   - SSH long form: ssh://git@github.com/user/repo.git
+//   - SSH short form: git@github.com:user/repo.git, or work-gh:user/repo
+//   - HTTPS: https://github.com/user/repo.git, or https://ghe.example.com:8443/user/repo
+//   - SSH long form: ssh://git@github.com:2222/user/repo.git
 func parseRemoteURL(raw string) (*RemoteURL, error) {
 	raw = strings.TrimSpace(raw)
 
@@ -50,7 +139,13 @@ func parseRemoteURL(raw string) (*RemoteURL, error) {
 		}
 		host := raw[i+1 : i+colonIdx]
 		pathRepo := raw[i+colonIdx+1:]
-		return splitPathRepo(host, pathRepo, raw)
+		return splitPathRepo("ssh", host, pathRepo, raw)
+	}
+	// SSH short form without a user, e.g. an ~/.ssh/config alias:
+	// host:path/repo.git. Git treats it that way if the colon comes before
+	// any slash.
+	if colonIdx := strings.Index(raw, ":"); colonIdx > 0 && !strings.Contains(raw, "://") && !strings.Contains(raw[:colonIdx], "/") {
+		return splitPathRepo("ssh", raw[:colonIdx], raw[colonIdx+1:], raw)
 	}
 
 	// URL form (https://, ssh://, etc.)
@@ -59,10 +154,21 @@ func parseRemoteURL(raw string) (*RemoteURL, error) {
 		return nil, fmt.Errorf("could not parse git remote URL %q: %w", raw, err)
 	}
 	pathRepo := strings.TrimPrefix(u.Path, "/")
-	return splitPathRepo(u.Hostname(), pathRepo, raw)
+	scheme, host := u.Scheme, u.Hostname()
+	switch scheme {
+	case "http", "https":
+		// Keep a non-default port; the API is served on it too.
+		if port := u.Port(); port != "" && !(scheme == "https" && port == "443") && !(scheme == "http" && port == "80") {
+			host = u.Host
+		}
+	case "ssh", "git+ssh", "ssh+git":
+		// The SSH port has nothing to do with where the API is.
+		scheme = "ssh"
+	}
+	return splitPathRepo(scheme, host, pathRepo, raw)
 }
 
-func splitPathRepo(host, pathRepo, raw string) (*RemoteURL, error) {
+func splitPathRepo(scheme, host, pathRepo, raw string) (*RemoteURL, error) {
 	pathRepo = strings.TrimSuffix(pathRepo, "/")
 	pathRepo = strings.TrimSuffix(pathRepo, ".git")
 	parts := strings.Split(pathRepo, "/")
@@ -73,6 +179,7 @@ func splitPathRepo(host, pathRepo, raw string) (*RemoteURL, error) {
 		Host:     host,
 		Path:     strings.Join(parts[:len(parts)-1], "/"),
 		RepoName: parts[len(parts)-1],
+		Scheme:   scheme,
 	}, nil
 }
 
@@ -95,28 +202,151 @@ func listRemoteNames(ctx context.Context) ([]string, error) {
 	return remotes, nil
 }
 
-// currentBranch returns the name of the current Git branch.
+// currentBranch returns the name of the current Git branch, or
+// errDetachedHead if HEAD doesn't point at a branch.
 func currentBranch(ctx context.Context) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
 	defer cancel()
-	out, err := exec.CommandContext(ctx, "git", "symbolic-ref", "--short", "HEAD").Output()
+	out, err := exec.CommandContext(ctx, "git", "symbolic-ref", "--quiet", "--short", "HEAD").Output()
 	if err != nil {
+		// With --quiet, exit status 1 means HEAD is not a symbolic ref.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", errDetachedHead
+		}
 		return "", fmt.Errorf("getting current branch: %w", err)
 	}
 	return strings.TrimSpace(string(out)), nil
 }
 
-// gitTip returns the full commit SHA for the given branch or ref.
-// If branch is empty, defaults to HEAD.
-func gitTip(ctx context.Context, branch string) (string, error) {
-	if branch == "" {
-		branch = "HEAD"
+// repoRoot returns the top-level directory of the working tree.
+func repoRoot(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", fmt.Errorf("finding the repository root: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitTip returns the full commit SHA for the given branch, tag or SHA.
+// Annotated tags are peeled to the commit they point at. If ref is empty,
+// defaults to HEAD.
+func gitTip(ctx context.Context, ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
 	}
 	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
 	defer cancel()
-	out, err := exec.CommandContext(ctx, "git", "rev-parse", branch).CombinedOutput()
+	out, err := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", ref+"^{commit}").Output()
 	if err != nil {
-		return "", fmt.Errorf("getting tip of %q: %s", branch, strings.TrimSpace(string(out)))
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", fmt.Errorf("getting tip of %q: not a branch, tag or commit in this repository", ref)
+		}
+		return "", fmt.Errorf("getting tip of %q: %w", ref, err)
 	}
 	return strings.TrimSpace(string(out)), nil
 }
+
+// gitNetworkTimeout is the maximum time to wait for a git command that talks
+// to a remote.
+const gitNetworkTimeout = 30 * time.Second
+
+// remoteHeads asks the named remote which commit each of its branches points
+// to (git ls-remote --heads), so the answer doesn't depend on how recently
+// we fetched.
+func remoteHeads(ctx context.Context, remoteName string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitNetworkTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", "ls-remote", "--heads", remoteName).Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing branches on %q: %w", remoteName, err)
+	}
+	return parseLsRemote(string(out), "refs/heads/"), nil
+}
+
+// parseLsRemote parses "git ls-remote" output into a map from ref name, with
+// prefix removed, to commit SHA. Refs without the prefix are skipped.
+func parseLsRemote(out, prefix string) map[string]string {
+	refs := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		sha, ref, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok || !strings.HasPrefix(ref, prefix) {
+			continue
+		}
+		refs[strings.TrimPrefix(ref, prefix)] = sha
+	}
+	return refs
+}
+
+// remoteRefCommit asks the named remote which commit ref, e.g.
+// "refs/heads/main" or "refs/tags/v1.2.0", points to. Annotated tags are
+// peeled to their commit. ok is false if the remote has no such ref.
+func remoteRefCommit(ctx context.Context, remoteName, ref string) (sha string, ok bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, gitNetworkTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", "ls-remote", remoteName, ref, ref+"^{}").Output()
+	if err != nil {
+		return "", false, fmt.Errorf("looking up %s on %q: %w", ref, remoteName, err)
+	}
+	refs := parseLsRemote(string(out), "")
+	if sha, ok := refs[ref+"^{}"]; ok {
+		return sha, true, nil
+	}
+	sha, ok = refs[ref]
+	return sha, ok, nil
+}
+
+// isAncestor reports whether commit a is an ancestor of (or the same as)
+// commit b. It returns an error if either commit isn't in the local clone.
+func isAncestor(ctx context.Context, a, b string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	err := exec.CommandContext(ctx, "git", "merge-base", "--is-ancestor", a, b).Run()
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("comparing %s and %s: %w", shortRef(a), shortRef(b), err)
+}
+
+// countCommits returns the number of commits reachable from to but not from
+// from.
+func countCommits(ctx context.Context, from, to string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", "rev-list", "--count", from+".."+to).Output()
+	if err != nil {
+		return 0, fmt.Errorf("counting commits in %s..%s: %w", shortRef(from), shortRef(to), err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+// gitPush runs "git push" with args, sending its output to stdout and its
+// progress and errors to stderr.
+func gitPush(ctx context.Context, stdout, stderr io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"push"}, args...)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git push %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// gitConfig returns the value of a git config key, or an empty string if it
+// isn't set.
+func gitConfig(ctx context.Context, key string) string {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", "config", "--get", key).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -61,6 +61,34 @@ func TestParseRemoteURL(t *testing.T) {
 			wantPath: "kevinburke",
 			wantRepo: "github-actions",
 		},
+		{
+			name:     "ssh alias without user",
+			raw:      "work-gh:org/repo.git",
+			wantHost: "work-gh",
+			wantPath: "org",
+			wantRepo: "repo",
+		},
+		{
+			name:     "ssh long form with port",
+			raw:      "ssh://git@ghe.example.com:2222/org/repo.git",
+			wantHost: "ghe.example.com",
+			wantPath: "org",
+			wantRepo: "repo",
+		},
+		{
+			name:     "https with port",
+			raw:      "https://ghe.example.com:8443/org/repo.git",
+			wantHost: "ghe.example.com:8443",
+			wantPath: "org",
+			wantRepo: "repo",
+		},
+		{
+			name:     "https with default port",
+			raw:      "https://github.com:443/kevinburke/github-actions",
+			wantHost: "github.com",
+			wantPath: "kevinburke",
+			wantRepo: "github-actions",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -81,6 +109,65 @@ func TestParseRemoteURL(t *testing.T) {
 	}
 }
 
+func TestParseRemoteURLScheme(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"git@github.com:kevinburke/github-actions.git", "ssh"},
+		{"work-gh:org/repo", "ssh"},
+		{"ssh://git@github.com/kevinburke/github-actions.git", "ssh"},
+		{"git+ssh://git@github.com/kevinburke/github-actions.git", "ssh"},
+		{"https://github.com/kevinburke/github-actions", "https"},
+	}
+	for _, tt := range tests {
+		got, err := parseRemoteURL(tt.raw)
+		if err != nil {
+			t.Fatalf("parseRemoteURL(%q): %v", tt.raw, err)
+		}
+		if got.Scheme != tt.want {
+			t.Errorf("parseRemoteURL(%q).Scheme = %q, want %q", tt.raw, got.Scheme, tt.want)
+		}
+	}
+}
+
+func TestResolveSSHHost(t *testing.T) {
+	// GitHub's documented SSH-over-443 config, and a work alias.
+	aliases := map[string]string{
+		"github.com": "ssh.github.com",
+		"gh":         "ssh.github.com",
+		"work-gh":    "ghe.example.com",
+		"ghe":        "ghe-ssh.example.com",
+	}
+	lookup := func(host string) string { return aliases[host] }
+	tests := []struct {
+		host       string
+		configured bool
+		want       string
+	}{
+		{"github.com", false, "github.com"},
+		{"gh", false, "github.com"},
+		{"work-gh", false, "ghe.example.com"},
+		{"ghe", true, "ghe"},
+		{"unknown", false, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := resolveSSHHost(tt.host, tt.configured, lookup); got != tt.want {
+			t.Errorf("resolveSSHHost(%q, %v) = %q, want %q", tt.host, tt.configured, got, tt.want)
+		}
+	}
+}
+
+func TestParseSSHConfigHostname(t *testing.T) {
+	out := "user git\nhostname ghe.example.com\nport 2222\nidentityfile ~/.ssh/work\n"
+	if got := parseSSHConfigHostname(out); got != "ghe.example.com" {
+		t.Errorf("parseSSHConfigHostname() = %q, want ghe.example.com", got)
+	}
+	if got := parseSSHConfigHostname(""); got != "" {
+		t.Errorf("parseSSHConfigHostname(empty) = %q, want empty", got)
+	}
+}
+
 func TestParseRemoteURLErrors(t *testing.T) {
 	tests := []struct {
 		name string
@@ -99,3 +186,13 @@ func TestParseRemoteURLErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLsRemote(t *testing.T) {
+	out := "1111111111111111111111111111111111111111\trefs/heads/main\n" +
+		"2222222222222222222222222222222222222222\trefs/heads/feature/x\n" +
+		"3333333333333333333333333333333333333333\trefs/tags/v1.0\n"
+	heads := parseLsRemote(out, "refs/heads/")
+	if len(heads) != 2 || heads["main"] != "1111111111111111111111111111111111111111" || heads["feature/x"] == "" {
+		t.Errorf("parseLsRemote() = %v", heads)
+	}
+}
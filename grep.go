@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// logCacheMaxAge is how long a cached job log is kept after it was last
+// searched.
+const logCacheMaxAge = 14 * 24 * time.Hour
+
+// grepOptions configures the grep subcommand.
+type grepOptions struct {
+	Pattern *regexp.Regexp
+	// Context is how many lines to print before and after each match.
+	Context int
+	// Runs also searches the last Runs completed runs of each workflow on
+	// the branch, not just the runs for the commit.
+	Runs int
+	// Workflows only searches runs of workflows matching the filter.
+	Workflows workflowFilter
+}
+
+// grepLine is a log line to print, either a match or context around one.
+type grepLine struct {
+	Num   int // 1-based, as GitHub numbers the log
+	Text  string
+	Match bool
+}
+
+// grepLines returns the lines matching re, and context lines either side of
+// each, in order.
+func grepLines(lines []string, re *regexp.Regexp, context int) []grepLine {
+	var matched []int
+	for i, line := range lines {
+		if re.MatchString(line) {
+			matched = append(matched, i)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	var out []grepLine
+	next := 0 // the first line not yet printed
+	for k, i := range matched {
+		start := max(i-context, next)
+		end := min(i+context, len(lines)-1)
+		if k+1 < len(matched) {
+			// Stop before the next match; it adds its own context.
+			end = min(end, matched[k+1]-1)
+		}
+		for j := start; j <= end; j++ {
+			out = append(out, grepLine{Num: j + 1, Text: lines[j], Match: j == i})
+		}
+		next = end + 1
+	}
+	return out
+}
+
+// grepPrinter writes lines like grep -n with several files: "label:12: text"
+// for a match, "label-11- text" for context, and "--" between
+// non-adjacent groups of lines when context is shown.
+type grepPrinter struct {
+	w       io.Writer
+	context int
+
+	printed bool
+	label   string
+	num     int
+}
+
+func (p *grepPrinter) print(label string, line grepLine) {
+	if p.context > 0 && p.printed && (label != p.label || line.Num != p.num+1) {
+		fmt.Fprintln(p.w, "--")
+	}
+	sep := '-'
+	if line.Match {
+		sep = ':'
+	}
+	fmt.Fprintf(p.w, "%s%c%d%c %s\n", label, sep, line.Num, sep, line.Text)
+	p.printed, p.label, p.num = true, label, line.Num
+}
+
+// grepRuns returns the runs to search: the runs for the commit, then, with
+// opts.Runs, the most recent completed runs of each of those workflows on
+// the branch.
+func grepRuns(ctx context.Context, repoSvc *ghactions.RepoService, t target, opts grepOptions) ([]ghactions.WorkflowRun, error) {
+	runs, err := commitRuns(ctx, repoSvc, t.SHA, opts.Workflows)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Runs <= 0 {
+		return runs, nil
+	}
+	seen := make(map[int64]bool)
+	var workflows []int64
+	for _, run := range runs {
+		seen[run.ID] = true
+		if !slices.Contains(workflows, run.WorkflowID) {
+			workflows = append(workflows, run.WorkflowID)
+		}
+	}
+	for _, id := range workflows {
+		params := url.Values{"status": []string{"completed"}}
+		if t.Branch != "" {
+			params.Set("branch", t.Branch)
+		}
+		recent, err := repoSvc.ListAllWorkflowRunsByWorkflow(ctx, id, params, opts.Runs)
+		if err != nil {
+			return nil, fmt.Errorf("listing recent runs: %w", err)
+		}
+		for _, run := range recent {
+			if !seen[run.ID] {
+				seen[run.ID] = true
+				runs = append(runs, run)
+			}
+		}
+	}
+	return runs, nil
+}
+
+// labeledJob is a job whose log is searched or printed, and the label that
+// names it in the output.
+type labeledJob struct {
+	label string
+	job   ghactions.Job
+}
+
+// doGrep searches the logs of every finished job in the runs for t, printing
+// matches to w, and reports whether anything matched. Logs are cached, so
+// searching the same runs again doesn't download them again.
+func doGrep(ctx context.Context, client *ghactions.Client, remote *RemoteURL, w, errw io.Writer, t target, opts grepOptions) (bool, error) {
+	repoSvc := client.Repo(remote.Path, remote.RepoName)
+	// Keeping the cache tidy is best effort.
+	ghactions.PruneLogCache(logCacheMaxAge)
+
+	runs, err := grepRuns(ctx, repoSvc, t, opts)
+	if err != nil {
+		return false, err
+	}
+	runJobs := make([][]ghactions.Job, len(runs))
+	jobErrs := make([]error, len(runs))
+	fanOut(len(runs), client.RateLimit, func(i int) {
+		runJobs[i], jobErrs[i] = repoSvc.ListAllJobs(ctx, runs[i].ID)
+	})
+	var jobs []labeledJob
+	running := 0
+	for i, run := range runs {
+		if jobErrs[i] != nil {
+			return false, fmt.Errorf("listing jobs for %q: %w", run.Name, jobErrs[i])
+		}
+		for _, job := range runJobs[i] {
+			if job.Status != ghactions.StatusCompleted {
+				running++
+				continue
+			}
+			if job.Conclusion != nil && *job.Conclusion == ghactions.ConclusionSkipped {
+				continue
+			}
+			// Like grep, only name the run when there's more than one.
+			label := job.Name
+			if len(runs) > 1 {
+				label = workflowRunDisplayName(run) + " / " + job.Name
+			}
+			jobs = append(jobs, labeledJob{label: label, job: job})
+		}
+	}
+
+	results := make([][]grepLine, len(jobs))
+	logErrs := make([]error, len(jobs))
+	fanOut(len(jobs), client.RateLimit, func(i int) {
+		data, err := repoSvc.CachedJobLogs(ctx, jobs[i].job)
+		if err != nil {
+			logErrs[i] = err
+			return
+		}
+		results[i] = grepLines(ghactions.LogLines(data), opts.Pattern, opts.Context)
+	})
+
+	p := &grepPrinter{w: w, context: opts.Context}
+	var firstErr error
+	failed := 0
+	for i, job := range jobs {
+		if logErrs[i] != nil {
+			fmt.Fprintf(errw, "Could not fetch the log for %s: %v\n", job.label, logErrs[i])
+			if firstErr == nil {
+				firstErr = logErrs[i]
+			}
+			failed++
+			continue
+		}
+		for _, line := range results[i] {
+			p.print(job.label, line)
+		}
+	}
+	if running > 0 {
+		fmt.Fprintf(errw, "Skipped %d unfinished %s\n", running, pluralize(running, "job"))
+	}
+	if firstErr != nil {
+		return p.printed, fmt.Errorf("fetching %d of %d job logs: %w", failed, len(jobs), firstErr)
+	}
+	return p.printed, nil
+}
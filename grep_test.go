@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestGrepLines(t *testing.T) {
+	lines := []string{"a", "FAIL one", "b", "c", "d", "e", "FAIL two", "FAIL three", "f"}
+	re := regexp.MustCompile("FAIL")
+
+	got := grepLines(lines, re, 0)
+	var nums []int
+	for _, l := range got {
+		nums = append(nums, l.Num)
+	}
+	if !slices.Equal(nums, []int{2, 7, 8}) {
+		t.Errorf("without context, got lines %v", nums)
+	}
+
+	got = grepLines(lines, re, 1)
+	nums = nil
+	var matches []int
+	for _, l := range got {
+		nums = append(nums, l.Num)
+		if l.Match {
+			matches = append(matches, l.Num)
+		}
+	}
+	if !slices.Equal(nums, []int{1, 2, 3, 6, 7, 8, 9}) || !slices.Equal(matches, []int{2, 7, 8}) {
+		t.Errorf("with context, got lines %v, matches %v", nums, matches)
+	}
+
+	if got := grepLines(lines, regexp.MustCompile("panic"), 2); got != nil {
+		t.Errorf("grepLines(no match) = %v", got)
+	}
+}
+
+func TestGrepPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	p := &grepPrinter{w: &buf, context: 1}
+	p.print("test", grepLine{Num: 1, Text: "a"})
+	p.print("test", grepLine{Num: 2, Text: "FAIL", Match: true})
+	p.print("test", grepLine{Num: 9, Text: "FAIL", Match: true})
+	p.print("lint", grepLine{Num: 10, Text: "FAIL", Match: true})
+	want := "test-1- a\ntest:2: FAIL\n--\ntest:9: FAIL\n--\nlint:10: FAIL\n"
+	if buf.String() != want {
+		t.Errorf("printed:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestDoGrep(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	var logDownloads atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_count": 1, "workflow_runs": [
+			{"id": 1, "name": "CI", "workflow_id": 10, "run_number": 5, "status": "completed", "conclusion": "failure"}
+		]}`))
+	})
+	mux.HandleFunc("/repos/o/r/actions/workflows/10/runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("branch") != "main" || r.URL.Query().Get("per_page") != "2" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"total_count": 2, "workflow_runs": [
+			{"id": 1, "name": "CI", "workflow_id": 10, "run_number": 5, "status": "completed", "conclusion": "failure"},
+			{"id": 2, "name": "CI", "workflow_id": 10, "run_number": 4, "status": "completed", "conclusion": "success"}
+		]}`))
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_count": 3, "jobs": [
+			{"id": 11, "name": "test", "status": "completed", "conclusion": "failure"},
+			{"id": 12, "name": "deploy", "status": "completed", "conclusion": "skipped"},
+			{"id": 13, "name": "lint", "status": "in_progress"}
+		]}`))
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs/2/jobs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_count": 1, "jobs": [{"id": 21, "name": "test", "status": "completed", "conclusion": "success"}]}`))
+	})
+	mux.HandleFunc("/repos/o/r/actions/jobs/11/logs", func(w http.ResponseWriter, r *http.Request) {
+		logDownloads.Add(1)
+		w.Write([]byte("2024-05-01T17:03:22.1234567Z === RUN TestFlaky\n2024-05-01T17:03:23.1234567Z --- FAIL: TestFlaky (0.01s)\n"))
+	})
+	mux.HandleFunc("/repos/o/r/actions/jobs/21/logs", func(w http.ResponseWriter, r *http.Request) {
+		logDownloads.Add(1)
+		w.Write([]byte("2024-05-01T17:03:22.1234567Z --- PASS: TestFlaky (0.01s)\n"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	client := ghactions.NewClient("token", "github.com")
+	client.Client.Base = srv.URL
+	remote := &RemoteURL{Host: "github.com", Path: "o", RepoName: "r"}
+	tgt := target{Ref: "main", Branch: "main", SHA: "0123456789abcdef"}
+
+	opts := grepOptions{Pattern: regexp.MustCompile(`(FAIL|PASS): TestFlaky`), Runs: 2}
+	for i := 0; i < 2; i++ {
+		var out, errOut bytes.Buffer
+		found, err := doGrep(context.Background(), client, remote, &out, &errOut, tgt, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found {
+			t.Error("doGrep() found nothing")
+		}
+		want := "CI [run 5] / test:2: --- FAIL: TestFlaky (0.01s)\nCI [run 4] / test:1: --- PASS: TestFlaky (0.01s)\n"
+		if out.String() != want {
+			t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+		}
+		if !strings.Contains(errOut.String(), "Skipped 1 unfinished job") {
+			t.Errorf("stderr = %q", errOut.String())
+		}
+	}
+	if n := logDownloads.Load(); n != 2 {
+		t.Errorf("downloaded %d logs, want 2: the second search should use the cache", n)
+	}
+
+	var out bytes.Buffer
+	found, err := doGrep(context.Background(), client, remote, &out, &bytes.Buffer{}, tgt, grepOptions{Pattern: regexp.MustCompile("panic:")})
+	if err != nil || found || out.Len() != 0 {
+		t.Errorf("doGrep(no match) = %v, %v, output %q", found, err, out.String())
+	}
+}
+
+func TestGrepRunsPaginates(t *testing.T) {
+	const total = 160
+	var pages []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_count": 1, "workflow_runs": [{"id": 1000, "workflow_id": 10, "status": "completed"}]}`))
+	})
+	mux.HandleFunc("/repos/o/r/actions/workflows/10/runs", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("per_page") != "100" {
+			t.Errorf("per_page = %q, want 100, the API's maximum", q.Get("per_page"))
+		}
+		pages = append(pages, q.Get("page"))
+		page, _ := strconv.Atoi(q.Get("page"))
+		var runs []string
+		for id := (page-1)*100 + 1; id <= min(page*100, total); id++ {
+			runs = append(runs, fmt.Sprintf(`{"id": %d, "workflow_id": 10, "status": "completed"}`, id))
+		}
+		fmt.Fprintf(w, `{"total_count": %d, "workflow_runs": [%s]}`, total, strings.Join(runs, ","))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	client := ghactions.NewClient("token", "github.com")
+	client.Client.Base = srv.URL
+
+	runs, err := grepRuns(context.Background(), client.Repo("o", "r"), target{SHA: "0123456789abcdef"}, grepOptions{Runs: 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 151 {
+		t.Errorf("got %d runs, want the commit's run and the 150 most recent", len(runs))
+	}
+	if !slices.Equal(pages, []string{"1", "2"}) {
+		t.Errorf("fetched pages %q, want 1 and 2", pages)
+	}
+}
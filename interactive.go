@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+	"golang.org/x/term"
+)
+
+// uiKey is a key wait --interactive acts on.
+type uiKey int
+
+const (
+	keyUp uiKey = iota + 1
+	keyDown
+	keyOpen
+	keyLogs
+	keyCancel
+	keyRerun
+	keyQuit
+	// keyInterrupt is Ctrl-C, which doesn't send SIGINT in raw mode.
+	keyInterrupt
+	keyConfirm
+)
+
+var (
+	arrowUp   = [][]byte{[]byte("\x1b[A"), []byte("\x1bOA")}
+	arrowDown = [][]byte{[]byte("\x1b[B"), []byte("\x1bOB")}
+)
+
+// parseKeys returns the keys in b, as read from a terminal in raw mode.
+// Bytes that aren't one of the keys, like other escape sequences, are
+// skipped.
+func parseKeys(b []byte) []uiKey {
+	hasPrefix := func(prefixes [][]byte) bool {
+		return slices.ContainsFunc(prefixes, func(p []byte) bool { return bytes.HasPrefix(b, p) })
+	}
+	var keys []uiKey
+	for len(b) > 0 {
+		switch {
+		case hasPrefix(arrowUp):
+			keys, b = append(keys, keyUp), b[3:]
+			continue
+		case hasPrefix(arrowDown):
+			keys, b = append(keys, keyDown), b[3:]
+			continue
+		}
+		switch b[0] {
+		case 'k':
+			keys = append(keys, keyUp)
+		case 'j':
+			keys = append(keys, keyDown)
+		case 'o':
+			keys = append(keys, keyOpen)
+		case 'l':
+			keys = append(keys, keyLogs)
+		case 'c':
+			keys = append(keys, keyCancel)
+		case 'r':
+			keys = append(keys, keyRerun)
+		case 'q':
+			keys = append(keys, keyQuit)
+		case 0x03:
+			keys = append(keys, keyInterrupt)
+		case 'y', 'Y':
+			keys = append(keys, keyConfirm)
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// waitActions does what the keys in wait --interactive ask for.
+type waitActions interface {
+	openURL(url string) error
+	listJobs(ctx context.Context, run ghactions.WorkflowRun) ([]ghactions.Job, error)
+	showLogs(ctx context.Context, job ghactions.Job) error
+	cancelRun(ctx context.Context, run ghactions.WorkflowRun) error
+	rerunFailedJobs(ctx context.Context, run ghactions.WorkflowRun) error
+}
+
+// apiWaitActions carries out waitActions with the GitHub API.
+type apiWaitActions struct {
+	repoSvc *ghactions.RepoService
+	rawLogs bool
+}
+
+func (a apiWaitActions) openURL(url string) error { return openURL(url) }
+
+func (a apiWaitActions) listJobs(ctx context.Context, run ghactions.WorkflowRun) ([]ghactions.Job, error) {
+	return a.repoSvc.ListAllJobs(ctx, run.ID)
+}
+
+// showLogs downloads a job's log and shows it in $PAGER, or "less -R".
+func (a apiWaitActions) showLogs(ctx context.Context, job ghactions.Job) error {
+	logs, err := a.repoSvc.GetJobLogs(ctx, job.ID)
+	if err != nil {
+		return fmt.Errorf("fetching logs for %q: %w", job.Name, err)
+	}
+	if !a.rawLogs {
+		logs = ghactions.NormalizeLog(logs, ghactions.LogOptions{Color: os.Getenv("NO_COLOR") == ""})
+	}
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less", "-R"}
+	}
+	cmd := exec.CommandContext(ctx, pager[0], pager[1:]...)
+	cmd.Stdin = bytes.NewReader(logs)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (a apiWaitActions) cancelRun(ctx context.Context, run ghactions.WorkflowRun) error {
+	return a.repoSvc.CancelWorkflowRun(ctx, run.ID)
+}
+
+func (a apiWaitActions) rerunFailedJobs(ctx context.Context, run ghactions.WorkflowRun) error {
+	return a.repoSvc.RerunFailedJobs(ctx, run.ID)
+}
+
+// waitUI is the keyboard state of wait --interactive: the selected run or
+// job, and the last thing it did. The terminal is only in raw mode while
+// wait sleeps between polls, so output printed while polling needs no
+// special handling.
+type waitUI struct {
+	fd    int // the terminal, or -1 in tests
+	state *term.State
+
+	keys   chan []byte
+	resume chan struct{}
+	closed bool
+
+	// The selected run, and job in it; job is 0 if the run is selected.
+	run, job int64
+	// confirmCancel is the run waiting for "y" to cancel it.
+	confirmCancel int64
+	message       string
+}
+
+// startInteractive starts reading keys from in, which must be a terminal.
+func (s *statusRenderer) startInteractive(in *os.File) error {
+	fd := int(in.Fd())
+	if !s.isTTY || s.quiet || !term.IsTerminal(fd) {
+		return errors.New("--interactive needs a terminal for stdin and stdout, and no --quiet")
+	}
+	u := &waitUI{
+		fd:     fd,
+		keys:   make(chan []byte),
+		resume: make(chan struct{}),
+	}
+	go u.readKeys(in)
+	s.ui = u
+	return nil
+}
+
+// readKeys sends what is typed on in to u.keys, one read at a time. It
+// doesn't read again until the keys have been handled, so a pager started
+// to show logs gets all of the input.
+func (u *waitUI) readKeys(in io.Reader) {
+	buf := make([]byte, 64)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			close(u.keys)
+			return
+		}
+		u.keys <- slices.Clone(buf[:n])
+		<-u.resume
+	}
+}
+
+// keys returns the channel of keys read from the terminal, or nil if there
+// is nothing to read.
+func (s *statusRenderer) keys() <-chan []byte {
+	if s.ui == nil || s.ui.closed {
+		return nil
+	}
+	return s.ui.keys
+}
+
+// rawInput puts the terminal in raw mode, so keys arrive as they are typed
+// without being echoed, or restores it.
+func (s *statusRenderer) rawInput(raw bool) {
+	u := s.ui
+	if u == nil || u.fd < 0 {
+		return
+	}
+	if raw && u.state == nil {
+		state, err := term.MakeRaw(u.fd)
+		if err != nil {
+			return
+		}
+		u.state = state
+	} else if !raw && u.state != nil {
+		term.Restore(u.fd, u.state)
+		u.state = nil
+	}
+}
+
+// stopInteractive restores the terminal and stops drawing the selection.
+func (s *statusRenderer) stopInteractive() {
+	s.rawInput(false)
+	s.ui = nil
+}
+
+// uiItem is a line that can be selected: a run, or a job in a run.
+type uiItem struct {
+	run ghactions.WorkflowRun
+	job *ghactions.Job
+}
+
+// items returns the selectable lines: every run, with the jobs of the
+// selected run below it.
+func (s *statusRenderer) items(runs []ghactions.WorkflowRun) []uiItem {
+	items := make([]uiItem, 0, len(runs))
+	for _, run := range runs {
+		items = append(items, uiItem{run: run})
+		if run.ID != s.ui.run {
+			continue
+		}
+		for i := range s.jobs[run.ID] {
+			items = append(items, uiItem{run: run, job: &s.jobs[run.ID][i]})
+		}
+	}
+	return items
+}
+
+// selected returns the index of the selected item, selecting the first run
+// if the selected one is gone. It returns -1 if there are no items.
+func (s *statusRenderer) selected(items []uiItem) int {
+	u := s.ui
+	runIdx := -1
+	for i, item := range items {
+		if item.run.ID != u.run {
+			continue
+		}
+		if item.job == nil {
+			runIdx = i
+			if u.job == 0 {
+				return i
+			}
+		} else if item.job.ID == u.job {
+			return i
+		}
+	}
+	if runIdx >= 0 {
+		u.job = 0
+		return runIdx
+	}
+	if len(items) == 0 {
+		return -1
+	}
+	u.run, u.job = items[0].run.ID, 0
+	return 0
+}
+
+func (s *statusRenderer) selectItem(item uiItem) {
+	s.ui.run, s.ui.job = item.run.ID, 0
+	if item.job != nil {
+		s.ui.job = item.job.ID
+	}
+}
+
+const interactiveHelp = "↑/↓ select  o open  l logs  c cancel  r re-run failed jobs  q quit"
+
+// interactiveLines lays out the status table for wait --interactive: the
+// selected line is marked, the selected run's jobs are listed below it, and
+// the keys and the result of the last one are shown at the bottom.
+func (s *statusRenderer) interactiveLines(header []string, runs []ghactions.WorkflowRun, rows []string) []string {
+	items := s.items(runs)
+	sel := s.selected(items)
+	lines := slices.Clone(header)
+	row := 0
+	maxJob := 0
+	for _, job := range s.jobs[s.ui.run] {
+		maxJob = max(maxJob, len(job.Name))
+	}
+	for i, item := range items {
+		marker := "  "
+		if i == sel {
+			marker = "› "
+		}
+		if item.job == nil {
+			lines = append(lines, marker+strings.TrimPrefix(rows[row], "  "))
+			row++
+			continue
+		}
+		job := *item.job
+		// Jobs have the same statuses and conclusions as runs.
+		icon, color := s.statusIcon(ghactions.WorkflowRun{Status: job.Status, Conclusion: job.Conclusion})
+		if color != "" && !s.noColor {
+			icon = color + icon + "\033[0m"
+		}
+		status := string(job.Status)
+		if job.Conclusion != nil {
+			status = string(*job.Conclusion)
+		}
+		var dur string
+		if job.StartedAt != nil {
+			dur = durationString(jobDuration(job))
+		}
+		lines = append(lines, strings.TrimRight(fmt.Sprintf("%s    %s %-*s  %-12s %s", marker, icon, maxJob, job.Name, status, dur), " "))
+	}
+	help := interactiveHelp
+	if !s.noColor {
+		help = "\033[90m" + help + "\033[0m"
+	}
+	lines = append(lines, "", "  "+help)
+	if s.ui.message != "" {
+		lines = append(lines, "  "+s.ui.message)
+	}
+	return lines
+}
+
+// handleKeys acts on keys read from the terminal. If the user asked to stop
+// waiting, it returns the key they stopped with, keyQuit or keyInterrupt,
+// and otherwise 0. ok is false if the terminal was closed.
+func (s *statusRenderer) handleKeys(ctx context.Context, b []byte, ok bool, runs []ghactions.WorkflowRun, a waitActions) (stop uiKey) {
+	u := s.ui
+	if !ok {
+		u.closed = true
+		return 0
+	}
+	defer func() { u.resume <- struct{}{} }()
+	for _, key := range parseKeys(b) {
+		if s.handleKey(ctx, key, runs, a) {
+			return key
+		}
+	}
+	return 0
+}
+
+func (s *statusRenderer) handleKey(ctx context.Context, key uiKey, runs []ghactions.WorkflowRun, a waitActions) (quit bool) {
+	u := s.ui
+	items := s.items(runs)
+	sel := s.selected(items)
+	if sel < 0 {
+		return key == keyQuit || key == keyInterrupt
+	}
+	item := items[sel]
+	confirmCancel := u.confirmCancel
+	u.confirmCancel = 0
+	u.message = ""
+
+	switch key {
+	case keyQuit, keyInterrupt:
+		return true
+	case keyUp, keyDown:
+		if key == keyUp {
+			sel = max(sel-1, 0)
+		} else {
+			sel = min(sel+1, len(items)-1)
+		}
+		s.selectItem(items[sel])
+		run := items[sel].run
+		if _, ok := s.jobs[run.ID]; !ok {
+			jobs, err := a.listJobs(ctx, run)
+			if err != nil {
+				u.message = fmt.Sprintf("Could not list the jobs of %q: %v", run.Name, err)
+				break
+			}
+			s.setJobs(run.ID, jobs)
+		}
+	case keyOpen:
+		url := item.run.HTMLURL
+		if item.job != nil {
+			url = item.job.HTMLURL
+			if item.job.Failed() && item.job.FailedStepURL() != "" {
+				url = item.job.FailedStepURL()
+			}
+		}
+		if err := a.openURL(url); err != nil {
+			u.message = fmt.Sprintf("Could not open %s: %v", url, err)
+		} else {
+			u.message = "Opened " + url
+		}
+	case keyLogs:
+		job := item.job
+		if job == nil {
+			job = firstFailedJob(s.jobs[item.run.ID])
+		}
+		if job == nil {
+			u.message = "Select a job to see its logs"
+			break
+		}
+		s.clearStatus()
+		s.rawInput(false)
+		err := a.showLogs(ctx, *job)
+		s.rawInput(true)
+		if err != nil {
+			u.message = err.Error()
+		}
+	case keyCancel:
+		if item.run.IsCompleted() {
+			u.message = fmt.Sprintf("%q has already finished", item.run.Name)
+			break
+		}
+		u.confirmCancel = item.run.ID
+		u.message = fmt.Sprintf("Cancel %s? Press y to confirm", workflowRunDisplayName(item.run))
+	case keyConfirm:
+		if confirmCancel == 0 {
+			break
+		}
+		for _, run := range runs {
+			if run.ID != confirmCancel {
+				continue
+			}
+			if err := a.cancelRun(ctx, run); err != nil {
+				u.message = fmt.Sprintf("Could not cancel %q: %v", run.Name, err)
+			} else {
+				u.message = fmt.Sprintf("Cancelling %s", workflowRunDisplayName(run))
+			}
+		}
+	case keyRerun:
+		if !item.run.IsFailed() {
+			u.message = fmt.Sprintf("%q has no failed jobs to re-run", item.run.Name)
+			break
+		}
+		if err := a.rerunFailedJobs(ctx, item.run); err != nil {
+			u.message = fmt.Sprintf("Could not re-run %q: %v", item.run.Name, err)
+		} else {
+			u.message = fmt.Sprintf("Re-running the failed jobs of %s", workflowRunDisplayName(item.run))
+		}
+	}
+	return false
+}
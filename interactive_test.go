@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("\x1b[Aj\x1bOB\x1b[Cxoq\x03y"))
+	want := []uiKey{keyUp, keyDown, keyDown, keyOpen, keyQuit, keyInterrupt, keyConfirm}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseKeys() = %v, want %v", got, want)
+	}
+}
+
+type fakeWaitActions struct {
+	opened    []string
+	cancelled []int64
+	reruns    []int64
+	logs      []int64
+	jobs      map[int64][]ghactions.Job
+	err       error
+}
+
+func (a *fakeWaitActions) openURL(url string) error {
+	a.opened = append(a.opened, url)
+	return a.err
+}
+
+func (a *fakeWaitActions) listJobs(ctx context.Context, run ghactions.WorkflowRun) ([]ghactions.Job, error) {
+	return a.jobs[run.ID], a.err
+}
+
+func (a *fakeWaitActions) showLogs(ctx context.Context, job ghactions.Job) error {
+	a.logs = append(a.logs, job.ID)
+	return a.err
+}
+
+func (a *fakeWaitActions) cancelRun(ctx context.Context, run ghactions.WorkflowRun) error {
+	a.cancelled = append(a.cancelled, run.ID)
+	return a.err
+}
+
+func (a *fakeWaitActions) rerunFailedJobs(ctx context.Context, run ghactions.WorkflowRun) error {
+	a.reruns = append(a.reruns, run.ID)
+	return a.err
+}
+
+func interactiveTestRuns() []ghactions.WorkflowRun {
+	now := time.Now()
+	return []ghactions.WorkflowRun{
+		{ID: 1, Name: "CI", WorkflowID: 1, Status: "in_progress", RunStartedAt: timePtr(now.Add(-time.Minute)), UpdatedAt: now, HTMLURL: "https://github.com/o/r/actions/runs/1"},
+		{ID: 2, Name: "Lint", WorkflowID: 2, Status: "completed", Conclusion: ptr("failure"), RunStartedAt: timePtr(now.Add(-time.Minute)), UpdatedAt: now, HTMLURL: "https://github.com/o/r/actions/runs/2"},
+	}
+}
+
+func newInteractiveTestRenderer() *statusRenderer {
+	return &statusRenderer{
+		isTTY:   true,
+		noColor: true,
+		screen:  screen{out: new(bytes.Buffer)},
+		ui:      &waitUI{fd: -1},
+	}
+}
+
+func press(t *testing.T, s *statusRenderer, runs []ghactions.WorkflowRun, a waitActions, keys ...uiKey) {
+	t.Helper()
+	for _, key := range keys {
+		if s.handleKey(context.Background(), key, runs, a) {
+			t.Fatalf("key %v quit", key)
+		}
+	}
+}
+
+func TestInteractiveSelection(t *testing.T) {
+	s := newInteractiveTestRenderer()
+	runs := interactiveTestRuns()
+	start := time.Now().Add(-30 * time.Second)
+	a := &fakeWaitActions{jobs: map[int64][]ghactions.Job{
+		2: {
+			{ID: 20, Name: "vet", Status: "completed", Conclusion: ptr("success"), StartedAt: &start, CompletedAt: &start},
+			{ID: 21, Name: "staticcheck", Status: "completed", Conclusion: ptr("failure"), HTMLURL: "https://github.com/o/r/actions/runs/2/job/21"},
+		},
+	}}
+	s.setJobs(1, nil)
+
+	header, rows := s.statusLines(time.Now(), runs)
+	lines := s.interactiveLines(header, runs, rows)
+	if !strings.HasPrefix(lines[0], "› ") || !strings.Contains(lines[0], "CI") {
+		t.Errorf("first run should be selected, got %q", lines[0])
+	}
+
+	// Moving to Lint lists its jobs, fetched on demand.
+	press(t, s, runs, a, keyDown)
+	header, rows = s.statusLines(time.Now(), runs)
+	lines = s.interactiveLines(header, runs, rows)
+	out := strings.Join(lines, "\n")
+	for _, want := range []string{"› ✗ Lint", "      ✓ vet          success      0s", "      ✗ staticcheck  failure", interactiveHelp} {
+		if !strings.Contains(out, want) {
+			t.Errorf("lines missing %q\ngot:\n%s", want, out)
+		}
+	}
+
+	// o on a failed job opens the job; l shows its logs.
+	press(t, s, runs, a, keyDown, keyDown, keyOpen, keyLogs)
+	if s.ui.job != 21 {
+		t.Errorf("selected job = %d, want 21", s.ui.job)
+	}
+	if !slices.Equal(a.opened, []string{"https://github.com/o/r/actions/runs/2/job/21"}) {
+		t.Errorf("opened %v", a.opened)
+	}
+	if !slices.Equal(a.logs, []int64{21}) {
+		t.Errorf("showed logs for %v, want [21]", a.logs)
+	}
+
+	// Moving up past the first job selects the run again.
+	press(t, s, runs, a, keyUp, keyUp, keyUp)
+	if s.ui.run != 1 || s.ui.job != 0 {
+		t.Errorf("selection = run %d job %d, want run 1", s.ui.run, s.ui.job)
+	}
+}
+
+func TestInteractiveCancelNeedsConfirmation(t *testing.T) {
+	s := newInteractiveTestRenderer()
+	runs := interactiveTestRuns()
+	a := &fakeWaitActions{}
+	s.setJobs(1, nil)
+	s.setJobs(2, nil)
+
+	press(t, s, runs, a, keyCancel, keyDown, keyConfirm)
+	if len(a.cancelled) != 0 {
+		t.Errorf("cancelled %v without confirmation", a.cancelled)
+	}
+	press(t, s, runs, a, keyUp, keyCancel)
+	if !strings.Contains(s.ui.message, "Press y to confirm") {
+		t.Errorf("message = %q", s.ui.message)
+	}
+	press(t, s, runs, a, keyConfirm)
+	if !slices.Equal(a.cancelled, []int64{1}) {
+		t.Errorf("cancelled %v, want [1]", a.cancelled)
+	}
+
+	// A finished run can't be cancelled.
+	press(t, s, runs, a, keyDown, keyCancel)
+	if !strings.Contains(s.ui.message, "already finished") {
+		t.Errorf("message = %q", s.ui.message)
+	}
+	press(t, s, runs, a, keyConfirm)
+	if len(a.cancelled) != 1 {
+		t.Errorf("cancelled %v, want only run 1", a.cancelled)
+	}
+}
+
+func TestInteractiveRerun(t *testing.T) {
+	s := newInteractiveTestRenderer()
+	runs := interactiveTestRuns()
+	a := &fakeWaitActions{}
+	s.setJobs(1, nil)
+	s.setJobs(2, nil)
+
+	press(t, s, runs, a, keyRerun)
+	if len(a.reruns) != 0 || !strings.Contains(s.ui.message, "no failed jobs") {
+		t.Errorf("reruns %v, message %q", a.reruns, s.ui.message)
+	}
+	press(t, s, runs, a, keyDown, keyRerun)
+	if !slices.Equal(a.reruns, []int64{2}) {
+		t.Errorf("reruns %v, want [2]", a.reruns)
+	}
+
+	a.err = errors.New("HTTP 403")
+	press(t, s, runs, a, keyRerun)
+	if !strings.Contains(s.ui.message, "HTTP 403") {
+		t.Errorf("message = %q, want the error", s.ui.message)
+	}
+}
+
+func TestInteractiveQuit(t *testing.T) {
+	s := newInteractiveTestRenderer()
+	s.ui.resume = make(chan struct{}, 2)
+	if stop := s.handleKeys(context.Background(), []byte("jq"), true, interactiveTestRuns(), &fakeWaitActions{}); stop != keyQuit {
+		t.Errorf("handleKeys() = %v, want keyQuit after q", stop)
+	}
+	if stop := s.handleKeys(context.Background(), []byte("\x03"), true, interactiveTestRuns(), &fakeWaitActions{}); stop != keyInterrupt {
+		t.Errorf("handleKeys() = %v, want keyInterrupt after Ctrl-C", stop)
+	}
+	if s.handleKeys(context.Background(), nil, false, interactiveTestRuns(), &fakeWaitActions{}); s.keys() != nil {
+		t.Error("keys() should be nil once the terminal is closed")
+	}
+}
+
+func TestScreenDrawAndClear(t *testing.T) {
+	var buf bytes.Buffer
+	sc := screen{out: &buf}
+	sc.draw([]string{"a", "b"})
+	if got, want := buf.String(), "\r\033[2Ka\r\n\033[2Kb\r\n\033[J"; got != want {
+		t.Errorf("first draw = %q, want %q", got, want)
+	}
+	buf.Reset()
+	sc.draw([]string{"c"})
+	if got, want := buf.String(), "\r\033[2A\033[2Kc\r\n\033[J"; got != want {
+		t.Errorf("redraw = %q, want %q", got, want)
+	}
+	buf.Reset()
+	sc.clear()
+	if got, want := buf.String(), "\r\033[1A\033[J"; got != want {
+		t.Errorf("clear = %q, want %q", got, want)
+	}
+	buf.Reset()
+	sc.clear()
+	if buf.Len() != 0 || sc.lines != 0 {
+		t.Errorf("second clear wrote %q", buf.String())
+	}
+}
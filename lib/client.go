@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"text/tabwriter"
 	"time"
@@ -77,6 +78,19 @@ type Client struct {
 	*restclient.Client
 	host    string
 	rateLim atomic.Pointer[RateLimit]
+	// graphqlRateLim is tracked apart from rateLim, since the GraphQL API
+	// has its own budget.
+	graphqlRateLim atomic.Pointer[RateLimit]
+	// transport is the bottom of the transport chain, the one that talks to
+	// the network. ConfigureHost replaces what it wraps.
+	transport *restclient.Transport
+
+	// RawLogs prints failed job output exactly as GitHub returns it, instead
+	// of passing it through NormalizeLog.
+	RawLogs bool
+	// AllFailedJobs makes BuildSummary report every failed job in the run,
+	// instead of only the first.
+	AllFailedJobs bool
 }
 
 // RateLimit returns the most recently observed rate limit, or nil if no
@@ -85,6 +99,12 @@ func (c *Client) RateLimit() *RateLimit {
 	return c.rateLim.Load()
 }
 
+// GraphQLRateLimit returns the most recently observed rate limit for the
+// GraphQL API, or nil if no GraphQL query has been made yet.
+func (c *Client) GraphQLRateLimit() *RateLimit {
+	return c.graphqlRateLim.Load()
+}
+
 // rateLimitTransport records X-RateLimit-* headers from each response onto the
 // owning Client.
 type rateLimitTransport struct {
@@ -96,7 +116,11 @@ func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error
 	resp, err := t.base.RoundTrip(req)
 	if resp != nil {
 		if rl := parseRateLimit(resp.Header); rl != nil {
-			t.client.rateLim.Store(rl)
+			if rl.Resource == "graphql" {
+				t.client.graphqlRateLim.Store(rl)
+			} else {
+				t.client.rateLim.Store(rl)
+			}
 		}
 	}
 	return resp, err
@@ -125,29 +149,42 @@ func parseRateLimit(h http.Header) *RateLimit {
 	return rl
 }
 
+// APIURL returns the REST API base URL for a GitHub host:
+// https://api.github.com for github.com, and https://<host>/api/v3 for GitHub
+// Enterprise Server. host may include a port.
+func APIURL(host string) string {
+	if host == "" || host == "github.com" {
+		return "https://api.github.com"
+	}
+	return "https://" + host + "/api/v3"
+}
+
 // NewClient creates a new GitHub API client.
 func NewClient(token string, host string) *Client {
 	if host == "" {
 		host = "github.com"
 	}
-	var apiHost string
-	if host == "github.com" {
-		apiHost = "https://api.github.com"
-	} else {
-		apiHost = "https://" + host + "/api/v3"
-	}
 
-	rc := restclient.NewBearerClient(token, apiHost)
+	rc := restclient.NewBearerClient(token, APIURL(host))
 	c := &Client{
 		Client: rc,
 		host:   host,
+		transport: &restclient.Transport{
+			RoundTripper: http.DefaultTransport,
+			Debug:        restclient.DefaultTransport.Debug,
+			Output:       restclient.DefaultTransport.Output,
+		},
 	}
-	rc.Client.Transport = &rateLimitTransport{
-		base: &retryTransport{
-			base:       rc.Client.Transport,
-			maxRetries: 3,
+	// Every restclient shares one *http.Client; give ours its own, so that
+	// wrapping the transport doesn't change it for anyone else.
+	rc.Client = &http.Client{
+		Transport: &rateLimitTransport{
+			base: &retryTransport{
+				base:       c.transport,
+				maxRetries: 3,
+			},
+			client: c,
 		},
-		client: c,
 	}
 	rc.ErrorParser = func(r *http.Response) error {
 		data, err := io.ReadAll(r.Body)
@@ -178,6 +215,36 @@ func NewClient(token string, host string) *Client {
 	return c
 }
 
+// SetAPIURL points the client at a different REST API base URL, e.g. one
+// configured with api_url for a GitHub Enterprise Server install.
+func (c *Client) SetAPIURL(apiURL string) {
+	c.Client.Base = strings.TrimSuffix(apiURL, "/")
+}
+
+// ConfigureHost applies the settings from the host's [hosts] entry in the
+// config file: api_url, and the proxy and TLS settings, which also apply to
+// log downloads.
+func (c *Client) ConfigureHost(h Host) error {
+	tr, err := NewTransport(h)
+	if err != nil {
+		return fmt.Errorf("configuring %s: %w", c.host, err)
+	}
+	c.transport.RoundTripper = tr
+	if h.APIURL != "" {
+		c.SetAPIURL(h.APIURL)
+	}
+	return nil
+}
+
+// downloadClient returns an HTTP client for the pre-signed URLs GitHub
+// redirects downloads to. It uses the same proxy and TLS settings as the API
+// client, but doesn't send the token.
+func (c *Client) downloadClient() *http.Client {
+	return &http.Client{
+		Transport: &retryTransport{base: c.transport, maxRetries: 3},
+	}
+}
+
 // RepoService provides access to repository-related API endpoints.
 type RepoService struct {
 	client *Client
@@ -259,6 +326,38 @@ func (r *RepoService) GetWorkflowRun(ctx context.Context, runID int64) (*Workflo
 	return &resp, nil
 }
 
+// GetWorkflowRunAttempt gets a specific attempt of a workflow run. Attempts
+// are numbered from 1; each re-run of the workflow adds one.
+// https://docs.github.com/en/rest/actions/workflow-runs#get-a-workflow-run-attempt
+func (r *RepoService) GetWorkflowRunAttempt(ctx context.Context, runID int64, attempt int) (*WorkflowRun, error) {
+	path := fmt.Sprintf("/repos/%s/%s/actions/runs/%d/attempts/%d", r.owner, r.repo, runID, attempt)
+
+	req, err := r.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp WorkflowRun
+	if err := r.client.Do(req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListWorkflowRunAttempts returns every attempt of run, oldest first. The
+// latest attempt is run itself, so only earlier attempts are fetched.
+func (r *RepoService) ListWorkflowRunAttempts(ctx context.Context, run WorkflowRun) ([]WorkflowRun, error) {
+	attempts := make([]WorkflowRun, 0, max(run.RunAttempt, 1))
+	for n := 1; n < run.RunAttempt; n++ {
+		attempt, err := r.GetWorkflowRunAttempt(ctx, run.ID, n)
+		if err != nil {
+			return nil, fmt.Errorf("getting attempt %d of run %d: %w", n, run.ID, err)
+		}
+		attempts = append(attempts, *attempt)
+	}
+	return append(attempts, run), nil
+}
+
 // ListJobs lists jobs for a workflow run. Results are paginated; set "page"
 // and "per_page" in params to control pagination.
 // https://docs.github.com/en/rest/actions/workflow-jobs#list-jobs-for-a-workflow-run
@@ -325,11 +424,47 @@ func (r *RepoService) FindFailedJob(ctx context.Context, runID int64) (*Job, err
 	return nil, nil
 }
 
+// ListAllJobs returns every job in a workflow run, following pagination.
+func (r *RepoService) ListAllJobs(ctx context.Context, runID int64) ([]Job, error) {
+	var jobs []Job
+	page := 1
+	for {
+		params := url.Values{
+			"per_page": []string{"100"},
+			"page":     []string{strconv.Itoa(page)},
+		}
+		resp, err := r.ListJobs(ctx, runID, params)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, resp.Jobs...)
+		if len(resp.Jobs) == 0 || page*100 >= resp.TotalCount {
+			break
+		}
+		page++
+	}
+	return jobs, nil
+}
+
 // GetJobLogs downloads the logs for a job.
 // https://docs.github.com/en/rest/actions/workflow-jobs#download-job-logs-for-a-workflow-run
 func (r *RepoService) GetJobLogs(ctx context.Context, jobID int64) ([]byte, error) {
 	path := fmt.Sprintf("/repos/%s/%s/actions/jobs/%d/logs", r.owner, r.repo, jobID)
+	return r.downloadLogs(ctx, path)
+}
 
+// DownloadRunLogs downloads the log archive for a workflow run: a zip file
+// with the full log of each job, and a directory for each job with a log for
+// each step, including the steps of cancelled jobs. See UnpackRunLogs.
+// https://docs.github.com/en/rest/actions/workflow-runs#download-workflow-run-logs
+func (r *RepoService) DownloadRunLogs(ctx context.Context, runID int64) ([]byte, error) {
+	path := fmt.Sprintf("/repos/%s/%s/actions/runs/%d/logs", r.owner, r.repo, runID)
+	return r.downloadLogs(ctx, path)
+}
+
+// downloadLogs fetches a logs endpoint, following the redirect GitHub
+// answers with to a pre-signed download URL.
+func (r *RepoService) downloadLogs(ctx context.Context, path string) ([]byte, error) {
 	req, err := r.newRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
@@ -352,11 +487,15 @@ func (r *RepoService) GetJobLogs(ctx context.Context, jobID int64) ([]byte, erro
 		if err != nil {
 			return nil, err
 		}
-		resp2, err := http.DefaultClient.Do(req2)
+		resp2, err := r.client.downloadClient().Do(req2)
 		if err != nil {
 			return nil, err
 		}
 		defer resp2.Body.Close()
+		if resp2.StatusCode >= 300 {
+			body, _ := io.ReadAll(io.LimitReader(resp2.Body, 1024))
+			return nil, fmt.Errorf("downloading logs: HTTP %d: %s", resp2.StatusCode, string(body))
+		}
 		return readPossiblyCompressed(resp2)
 	}
 
@@ -386,12 +525,19 @@ func IsATTY() bool {
 	return term.IsTerminal(int(os.Stdout.Fd()))
 }
 
-func buildJobsSummary(jobs []Job) ([]byte, *Job) {
+// useColor reports whether output written to stdout should be coloured.
+func useColor() bool {
+	return IsATTY() && os.Getenv("NO_COLOR") == ""
+}
+
+// buildJobsSummary returns a table of the jobs and their durations, and the
+// jobs that failed, in order.
+func buildJobsSummary(jobs []Job) ([]byte, []*Job) {
 	var buf bytes.Buffer
 	buf.WriteByte('\n')
 	writer := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
 
-	var failedJob *Job
+	var failedJobs []*Job
 	for i := range jobs {
 		job := &jobs[i]
 		var duration time.Duration
@@ -405,107 +551,39 @@ func buildJobsSummary(jobs []Job) ([]byte, *Job) {
 		}
 
 		durString := duration.String()
-		if job.Failed() && IsATTY() && os.Getenv("NO_COLOR") == "" {
+		if job.Failed() && useColor() {
 			durString = fmt.Sprintf("\033[38;05;160m%-8s\033[0m", duration.String())
 		}
 
-		if job.Failed() && failedJob == nil {
-			failedJob = job
+		if job.Failed() {
+			failedJobs = append(failedJobs, job)
 		}
 
 		fmt.Fprintf(writer, "%s\t%s\n", job.Name, durString)
 	}
 	writer.Flush()
 
-	return buf.Bytes(), failedJob
+	return buf.Bytes(), failedJobs
 }
 
 func failedJobURL(job *Job) string {
-	if job == nil || job.HTMLURL == "" {
+	if job == nil {
 		return ""
 	}
-	for _, step := range job.Steps {
-		if step.Conclusion != nil && *step.Conclusion == "failure" && step.Number > 0 {
-			return fmt.Sprintf("%s#step:%d:1", job.HTMLURL, step.Number)
-		}
-	}
-	return job.HTMLURL
+	return job.FailedStepURL()
 }
 
 // BuildJobsSummary generates a summary of a workflow run's jobs.
 func (c *Client) BuildJobsSummary(ctx context.Context, owner, repo string, run WorkflowRun) []byte {
-	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
-	defer cancel()
-
-	jobs, err := c.Repo(owner, repo).ListJobs(ctx, run.ID, url.Values{"per_page": []string{"100"}})
-	if err != nil {
-		var buf bytes.Buffer
-		buf.WriteByte('\n')
-		fmt.Fprintf(&buf, "Error fetching jobs: %v\n", err)
-		return buf.Bytes()
-	}
-
-	summary, _ := buildJobsSummary(jobs.Jobs)
-	return summary
+	return c.NewRunReport(ctx, owner, repo, run, RunReportOptions{}).JobsTable()
 }
 
-// BuildSummary generates a summary of a workflow run's jobs.
+// BuildSummary generates a summary of a workflow run's jobs, followed by the
+// URL, failure annotations and log excerpt of the first failed job, or of
+// every failed job with AllFailedJobs.
 func (c *Client) BuildSummary(ctx context.Context, owner, repo string, run WorkflowRun, numOutputLines int) []byte {
-	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
-	defer cancel()
-
-	repoSvc := c.Repo(owner, repo)
-
-	jobs, err := repoSvc.ListJobs(ctx, run.ID, url.Values{"per_page": []string{"100"}})
-	if err != nil {
-		var buf bytes.Buffer
-		fmt.Fprintf(&buf, "\nError fetching jobs: %v\n", err)
-		return buf.Bytes()
-	}
-
-	summary, failedJob := buildJobsSummary(jobs.Jobs)
-
-	var buf bytes.Buffer
-	buf.WriteByte('\n')
-	if linelen := bytes.IndexByte(summary[1:], '\n'); linelen > 0 {
-		buf.Write(bytes.Repeat([]byte{'='}, linelen))
-		buf.WriteByte('\n')
-	}
-
-	if url := failedJobURL(failedJob); url != "" {
-		fmt.Fprintf(&buf, "\nFailed job URL:\n%s\n", url)
-	}
-
-	if failedJob != nil {
-		// Check-run annotations surface run-level failure reasons that
-		// never appear in the job logs (e.g. billing/quota errors that
-		// prevent the job from starting). Print them before the log
-		// output since they're usually the most actionable line.
-		annots, err := repoSvc.ListCheckRunAnnotations(ctx, failedJob.ID)
-		if err != nil {
-			fmt.Fprintf(&buf, "\nError fetching annotations: %v\n", err)
-		} else {
-			for _, a := range annots {
-				if a.AnnotationLevel != "failure" {
-					continue
-				}
-				fmt.Fprintf(&buf, "\nFailure annotation: %s\n", a.Message)
-			}
-		}
-
-		logs, err := repoSvc.GetJobLogs(ctx, failedJob.ID)
-		switch {
-		case err != nil:
-			fmt.Fprintf(&buf, "\nError fetching job logs: %v\n", err)
-		case len(logs) > 0:
-			if failure := findBuildFailure(logs, numOutputLines); len(failure) > 0 {
-				fmt.Fprintf(&buf, "\nFailed build output:\n\n")
-				buf.Write(failure)
-			}
-		}
-	}
-
-	return append(summary, buf.Bytes()...)
+	rep := c.NewRunReport(ctx, owner, repo, run, RunReportOptions{Failures: true, OutputLines: numOutputLines})
+	return c.FormatRunReport(rep)
 }
 
 // errorContextLines is the number of lines shown before each ##[error] line.
@@ -608,6 +686,49 @@ func (r *RepoService) ListWorkflowRunsByWorkflow(ctx context.Context, workflowID
 	return &resp, nil
 }
 
+// ListAllWorkflowRuns pages through ListWorkflowRuns until every run matching
+// params has been fetched, or limit runs have been collected. A limit of 0
+// means no limit. Any "page" or "per_page" values in params are overwritten.
+func (r *RepoService) ListAllWorkflowRuns(ctx context.Context, params url.Values, limit int) ([]WorkflowRun, error) {
+	return listAllWorkflowRuns(ctx, params, limit, r.ListWorkflowRuns)
+}
+
+// ListAllWorkflowRunsByWorkflow is ListAllWorkflowRuns for the runs of one
+// workflow.
+func (r *RepoService) ListAllWorkflowRunsByWorkflow(ctx context.Context, workflowID int64, params url.Values, limit int) ([]WorkflowRun, error) {
+	return listAllWorkflowRuns(ctx, params, limit, func(ctx context.Context, p url.Values) (*WorkflowRunsResponse, error) {
+		return r.ListWorkflowRunsByWorkflow(ctx, workflowID, p)
+	})
+}
+
+func listAllWorkflowRuns(ctx context.Context, params url.Values, limit int, list func(context.Context, url.Values) (*WorkflowRunsResponse, error)) ([]WorkflowRun, error) {
+	p := url.Values{}
+	for k, v := range params {
+		p[k] = v
+	}
+	// The API returns at most 100 runs a page.
+	perPage := 100
+	if limit > 0 && limit < perPage {
+		perPage = limit
+	}
+	p.Set("per_page", strconv.Itoa(perPage))
+	var runs []WorkflowRun
+	for page := 1; ; page++ {
+		p.Set("page", strconv.Itoa(page))
+		resp, err := list(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, resp.WorkflowRuns...)
+		if limit > 0 && len(runs) >= limit {
+			return runs[:limit], nil
+		}
+		if len(resp.WorkflowRuns) == 0 || page*perPage >= resp.TotalCount {
+			return runs, nil
+		}
+	}
+}
+
 // FindWorkflowRunsForCommit finds workflow runs matching a specific commit SHA.
 func (r *RepoService) FindWorkflowRunsForCommit(ctx context.Context, sha string) ([]WorkflowRun, error) {
 	params := url.Values{
@@ -660,3 +781,54 @@ func (r *RepoService) CancelWorkflowRun(ctx context.Context, runID int64) error
 	body, _ := io.ReadAll(resp.Body)
 	return fmt.Errorf("cancelling run %d: HTTP %d: %s", runID, resp.StatusCode, string(body))
 }
+
+// RerunFailedJobs re-runs the failed jobs of a completed workflow run, and
+// the jobs that depend on them, as a new attempt of the run.
+// https://docs.github.com/en/rest/actions/workflow-runs#re-run-failed-jobs-from-a-workflow-run
+func (r *RepoService) RerunFailedJobs(ctx context.Context, runID int64) error {
+	path := fmt.Sprintf("/repos/%s/%s/actions/runs/%d/rerun-failed-jobs", r.owner, r.repo, runID)
+
+	req, err := r.newRequest(ctx, "POST", path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.client.Client.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusCreated {
+		return nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("re-running failed jobs of run %d: HTTP %d: %s", runID, resp.StatusCode, string(body))
+}
+
+// ForceCancelWorkflowRun cancels a workflow run, bypassing conditions like
+// always() that would otherwise keep jobs running. Use it for runs that are
+// stuck after a normal cancel.
+// https://docs.github.com/en/rest/actions/workflow-runs#force-cancel-a-workflow-run
+func (r *RepoService) ForceCancelWorkflowRun(ctx context.Context, runID int64) error {
+	path := fmt.Sprintf("/repos/%s/%s/actions/runs/%d/force-cancel", r.owner, r.repo, runID)
+
+	req, err := r.newRequest(ctx, "POST", path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.client.Client.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 409 means the run can't be cancelled, usually because it already
+	// finished; callers confirm with GetWorkflowRun.
+	if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusConflict {
+		return nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("force cancelling run %d: HTTP %d: %s", runID, resp.StatusCode, string(body))
+}
@@ -13,6 +13,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/kevinburke/rest/restclient"
 )
 
 func TestFailedJobURL(t *testing.T) {
@@ -54,7 +56,7 @@ func TestFailedJobURL(t *testing.T) {
 	}
 }
 
-func stringPtr(s string) *string { return &s }
+func stringPtr(c Conclusion) *Conclusion { return &c }
 
 func TestFindBuildFailure(t *testing.T) {
 	tests := []struct {
@@ -496,3 +498,199 @@ func TestClientReturnsGenericErrorOn403WithRemaining(t *testing.T) {
 		t.Errorf("403 with remaining=100 should not be a RateLimitError: %v", err)
 	}
 }
+
+func TestListWorkflowRunAttempts(t *testing.T) {
+	var fetched []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/actions/runs/9/attempts/", func(w http.ResponseWriter, r *http.Request) {
+		n := strings.TrimPrefix(r.URL.Path, "/repos/o/r/actions/runs/9/attempts/")
+		fetched = append(fetched, n)
+		fmt.Fprintf(w, `{"id":9,"run_attempt":%s,"status":"completed","conclusion":"failure"}`, n)
+	})
+	c, cleanup := newTestClient(t, mux)
+	defer cleanup()
+
+	latest := WorkflowRun{ID: 9, RunAttempt: 3, Status: "completed", Conclusion: stringPtr("success")}
+	attempts, err := c.Repo("o", "r").ListWorkflowRunAttempts(context.Background(), latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 2 || fetched[0] != "1" || fetched[1] != "2" {
+		t.Errorf("fetched attempts %v, want [1 2]", fetched)
+	}
+	if len(attempts) != 3 || attempts[0].RunAttempt != 1 || attempts[2].StatusText() != "success" {
+		t.Errorf("ListWorkflowRunAttempts() = %+v", attempts)
+	}
+}
+
+func TestNewClientDoesNotShareTransport(t *testing.T) {
+	c1 := NewClient("token", "github.com")
+	c2 := NewClient("token", "github.com")
+	if c1.Client.Client == c2.Client.Client {
+		t.Error("clients share an *http.Client")
+	}
+	if rc := restclient.NewBearerClient("token", "https://example.com"); rc.Client.Transport != restclient.DefaultTransport {
+		t.Errorf("NewClient changed the transport restclient clients share: %T", rc.Client.Transport)
+	}
+}
+
+func TestConfigureHostLogDownload(t *testing.T) {
+	logs := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "log line\n")
+	}))
+	defer logs.Close()
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, logs.URL+"/signed", http.StatusFound)
+	}))
+	defer api.Close()
+
+	// Both test servers use the same certificate.
+	c := NewClient("token", "ghe.example.com")
+	if err := c.ConfigureHost(Host{APIURL: api.URL + "/", CAFile: writeCertPEM(t, api)}); err != nil {
+		t.Fatal(err)
+	}
+	if c.Client.Base != api.URL {
+		t.Errorf("Base = %q, want %q", c.Client.Base, api.URL)
+	}
+	data, err := c.Repo("o", "r").GetJobLogs(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetJobLogs: %v", err)
+	}
+	if string(data) != "log line\n" {
+		t.Errorf("GetJobLogs = %q", data)
+	}
+}
+
+func TestBuildSummaryAllFailedJobs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/actions/runs/42/jobs", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"total_count": 3, "jobs": [
+			{"id": 98, "name": "setup", "status": "completed", "conclusion": "success"},
+			{"id": 99, "name": "lint", "status": "completed", "conclusion": "failure", "html_url": "https://github.com/o/r/actions/runs/42/job/99"},
+			{"id": 100, "name": "test", "status": "completed", "conclusion": "failure", "html_url": "https://github.com/o/r/actions/runs/42/job/100"}
+		]}`)
+	})
+	for _, id := range []string{"99", "100"} {
+		mux.HandleFunc("/repos/o/r/check-runs/"+id+"/annotations", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `[{"annotation_level": "failure", "message": "annotation for job `+id+`"}]`)
+		})
+		mux.HandleFunc("/repos/o/r/actions/jobs/"+id+"/logs", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "log for job "+id+"\n")
+		})
+	}
+	c, cleanup := newTestClient(t, mux)
+	defer cleanup()
+	c.RawLogs = true
+
+	out := string(c.BuildSummary(context.Background(), "o", "r", WorkflowRun{ID: 42}, 100))
+	if strings.Contains(out, "job 100") || strings.Contains(out, "--- Job") {
+		t.Errorf("without AllFailedJobs, only the first failed job should be reported\ngot:\n%s", out)
+	}
+
+	c.AllFailedJobs = true
+	out = string(c.BuildSummary(context.Background(), "o", "r", WorkflowRun{ID: 42}, 100))
+	for _, want := range []string{
+		`--- Job "lint" failed ---`,
+		"annotation for job 99",
+		"log for job 99",
+		`--- Job "test" failed ---`,
+		"https://github.com/o/r/actions/runs/42/job/100",
+		"annotation for job 100",
+		"log for job 100",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\ngot:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "job 99") > strings.Index(out, "job 100") {
+		t.Errorf("failed jobs should be reported in order\ngot:\n%s", out)
+	}
+}
+
+func TestRerunFailedJobs(t *testing.T) {
+	var gotMethod, gotPath string
+	c, cleanup := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		if r.URL.Path == "/repos/o/r/actions/runs/43/rerun-failed-jobs" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"This workflow run is not completed"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}))
+	defer cleanup()
+
+	repo := c.Repo("o", "r")
+	if err := repo.RerunFailedJobs(context.Background(), 42); err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != "POST" || gotPath != "/repos/o/r/actions/runs/42/rerun-failed-jobs" {
+		t.Errorf("request = %s %s, want POST to the rerun-failed-jobs endpoint", gotMethod, gotPath)
+	}
+	err := repo.RerunFailedJobs(context.Background(), 43)
+	if err == nil || !strings.Contains(err.Error(), "HTTP 403") {
+		t.Errorf("RerunFailedJobs() = %v, want an HTTP 403 error", err)
+	}
+}
+
+func TestDownloadRunLogs(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/o/r/actions/runs/42/logs":
+			http.Redirect(w, r, srv.URL+"/download/42.zip", http.StatusFound)
+		case "/download/42.zip":
+			w.Write([]byte("PK archive"))
+		case "/repos/o/r/actions/runs/43/logs":
+			http.Redirect(w, r, srv.URL+"/expired", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "AuthenticationFailed")
+		}
+	}))
+	defer srv.Close()
+	c := NewClient("token", "github.com")
+	c.Client.Base = srv.URL
+	repo := c.Repo("o", "r")
+
+	data, err := repo.DownloadRunLogs(context.Background(), 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "PK archive" {
+		t.Errorf("DownloadRunLogs() = %q", data)
+	}
+	// An expired download URL must not be mistaken for the archive.
+	if _, err := repo.DownloadRunLogs(context.Background(), 43); err == nil || !strings.Contains(err.Error(), "HTTP 403") {
+		t.Errorf("DownloadRunLogs(expired) = %v, want an HTTP 403 error", err)
+	}
+}
+
+// TestNewRunReportPrefetchedAnnotations checks that annotations passed in
+// RunReportOptions are used instead of a REST request.
+func TestNewRunReportPrefetchedAnnotations(t *testing.T) {
+	srv := buildSummaryServer{
+		jobsBody:        failedJobJobsBody,
+		annotationsCode: http.StatusInternalServerError,
+		annotationsBody: `{"message": "should not be called"}`,
+		logsBody:        "2024-05-01T17:03:22.1234567Z boom\n",
+	}
+	c, cleanup := newTestClient(t, srv.handler(t))
+	defer cleanup()
+
+	rep := c.NewRunReport(context.Background(), "o", "r", WorkflowRun{ID: 42}, RunReportOptions{
+		Failures: true,
+		Annotations: map[int64][]Annotation{99: {
+			{AnnotationLevel: "failure", Message: "out of disk"},
+			{AnnotationLevel: "notice", Message: "ignore me"},
+		}},
+	})
+	if len(rep.Failed) != 1 {
+		t.Fatalf("got %d failed jobs, want 1", len(rep.Failed))
+	}
+	f := rep.Failed[0]
+	if f.AnnotationsErr != nil || len(f.Annotations) != 1 || f.Annotations[0].Message != "out of disk" {
+		t.Errorf("annotations = %+v, err %v, want the prefetched failure", f.Annotations, f.AnnotationsErr)
+	}
+}
@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Environment is a deployment environment, like "production".
+type Environment struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// DeploymentReviewer is a user or team that can approve a deployment.
+type DeploymentReviewer struct {
+	Type     string `json:"type"` // "User" or "Team"
+	Reviewer struct {
+		Login string `json:"login"` // users
+		Name  string `json:"name"`  // teams
+		Slug  string `json:"slug"`  // teams
+	} `json:"reviewer"`
+}
+
+// String returns "@login" for a user and "team slug" for a team.
+func (r DeploymentReviewer) String() string {
+	if r.Type == "Team" {
+		if r.Reviewer.Slug != "" {
+			return "team " + r.Reviewer.Slug
+		}
+		return "team " + r.Reviewer.Name
+	}
+	return "@" + r.Reviewer.Login
+}
+
+// PendingDeployment is a deployment that a workflow run is waiting on.
+type PendingDeployment struct {
+	Environment Environment `json:"environment"`
+	// WaitTimer is the number of minutes the environment's wait timer
+	// holds the deployment, or 0 if it has none.
+	WaitTimer             int                  `json:"wait_timer"`
+	WaitTimerStartedAt    *time.Time           `json:"wait_timer_started_at"`
+	CurrentUserCanApprove bool                 `json:"current_user_can_approve"`
+	Reviewers             []DeploymentReviewer `json:"reviewers"`
+}
+
+// WaitTimerEndsAt returns when the environment's wait timer expires. It
+// returns false if there is no wait timer or it hasn't started.
+func (d PendingDeployment) WaitTimerEndsAt() (time.Time, bool) {
+	if d.WaitTimer <= 0 || d.WaitTimerStartedAt == nil {
+		return time.Time{}, false
+	}
+	return d.WaitTimerStartedAt.Add(time.Duration(d.WaitTimer) * time.Minute), true
+}
+
+// ReviewerList returns the reviewers as a comma separated list, or "" if the
+// environment has no required reviewers.
+func (d PendingDeployment) ReviewerList() string {
+	names := make([]string, 0, len(d.Reviewers))
+	for _, r := range d.Reviewers {
+		names = append(names, r.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// DeploymentReviewState is the decision on a pending deployment.
+type DeploymentReviewState string
+
+const (
+	DeploymentApproved DeploymentReviewState = "approved"
+	DeploymentRejected DeploymentReviewState = "rejected"
+)
+
+// ListPendingDeployments lists the deployments a workflow run is waiting on.
+// https://docs.github.com/en/rest/actions/workflow-runs#get-pending-deployments-for-a-workflow-run
+func (r *RepoService) ListPendingDeployments(ctx context.Context, runID int64) ([]PendingDeployment, error) {
+	path := fmt.Sprintf("/repos/%s/%s/actions/runs/%d/pending_deployments", r.owner, r.repo, runID)
+
+	req, err := r.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []PendingDeployment
+	if err := r.client.Do(req, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ReviewPendingDeployments approves or rejects a workflow run's pending
+// deployments to the given environments.
+// https://docs.github.com/en/rest/actions/workflow-runs#review-pending-deployments-for-a-workflow-run
+func (r *RepoService) ReviewPendingDeployments(ctx context.Context, runID int64, environmentIDs []int64, state DeploymentReviewState, comment string) error {
+	path := fmt.Sprintf("/repos/%s/%s/actions/runs/%d/pending_deployments", r.owner, r.repo, runID)
+	body, err := json.Marshal(struct {
+		EnvironmentIDs []int64               `json:"environment_ids"`
+		State          DeploymentReviewState `json:"state"`
+		Comment        string                `json:"comment"`
+	}{environmentIDs, state, comment})
+	if err != nil {
+		return err
+	}
+
+	req, err := r.newRequest(ctx, "POST", path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return r.client.Do(req, nil)
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const pendingDeploymentsBody = `[{
+	"environment": {"id": 161088068, "name": "production", "html_url": "https://github.com/o/r/deployments/activity_log?environments_filter=production"},
+	"wait_timer": 30,
+	"wait_timer_started_at": "2026-01-01T10:00:00Z",
+	"current_user_can_approve": true,
+	"reviewers": [
+		{"type": "User", "reviewer": {"login": "octocat"}},
+		{"type": "Team", "reviewer": {"name": "Ops", "slug": "ops"}}
+	]
+}]`
+
+func TestListPendingDeployments(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/actions/runs/5/pending_deployments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("method = %s, want GET", r.Method)
+		}
+		io.WriteString(w, pendingDeploymentsBody)
+	})
+	c, cleanup := newTestClient(t, mux)
+	defer cleanup()
+
+	deployments, err := c.Repo("o", "r").ListPendingDeployments(context.Background(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != 1 {
+		t.Fatalf("got %d deployments, want 1", len(deployments))
+	}
+	d := deployments[0]
+	if d.Environment.Name != "production" || d.Environment.ID != 161088068 || !d.CurrentUserCanApprove {
+		t.Errorf("deployment = %+v", d)
+	}
+	if got, want := d.ReviewerList(), "@octocat, team ops"; got != want {
+		t.Errorf("ReviewerList() = %q, want %q", got, want)
+	}
+	ends, ok := d.WaitTimerEndsAt()
+	if !ok || !ends.Equal(time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC)) {
+		t.Errorf("WaitTimerEndsAt() = %v, %v, want 10:30", ends, ok)
+	}
+}
+
+func TestReviewPendingDeployments(t *testing.T) {
+	var got struct {
+		EnvironmentIDs []int64 `json:"environment_ids"`
+		State          string  `json:"state"`
+		Comment        string  `json:"comment"`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/actions/runs/5/pending_deployments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		io.WriteString(w, `[]`)
+	})
+	c, cleanup := newTestClient(t, mux)
+	defer cleanup()
+
+	err := c.Repo("o", "r").ReviewPendingDeployments(context.Background(), 5, []int64{1, 2}, DeploymentRejected, "not today")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.EnvironmentIDs) != 2 || got.State != "rejected" || got.Comment != "not today" {
+		t.Errorf("request body = %+v", got)
+	}
+}
@@ -0,0 +1,357 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GraphQLError is returned when GitHub answers a GraphQL query with errors,
+// e.g. because the token can't read check suites.
+type GraphQLError struct {
+	Errors []GraphQLErrorDetail
+}
+
+// GraphQLErrorDetail is one entry in the "errors" array of a GraphQL
+// response.
+type GraphQLErrorDetail struct {
+	Type    string `json:"type"` // e.g. "FORBIDDEN", "NOT_FOUND", "RATE_LIMITED"
+	Message string `json:"message"`
+	Path    []any  `json:"path"`
+}
+
+func (e *GraphQLError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, d := range e.Errors {
+		msgs = append(msgs, d.Message)
+	}
+	return "github GraphQL query failed: " + strings.Join(msgs, "; ")
+}
+
+// graphqlURL returns the GraphQL endpoint that goes with the client's REST
+// base URL: https://api.github.com/graphql for github.com, and
+// https://<host>/api/graphql for GitHub Enterprise Server.
+func (c *Client) graphqlURL() string {
+	if base, ok := strings.CutSuffix(c.Client.Base, "/api/v3"); ok {
+		return base + "/api/graphql"
+	}
+	return c.Client.Base + "/graphql"
+}
+
+// GraphQL runs a GraphQL query and decodes its "data" into v. It returns a
+// *GraphQLError if the response has errors, even if some data came back.
+// https://docs.github.com/en/graphql/guides/forming-calls-with-graphql
+func (c *Client) GraphQL(ctx context.Context, query string, variables map[string]any, v any) error {
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	// NewRequestWithContext would join the URL to the REST base, which
+	// isn't a prefix of the GraphQL URL on GitHub Enterprise Server.
+	req, err := http.NewRequestWithContext(ctx, "POST", c.graphqlURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token())
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	var resp struct {
+		Data   json.RawMessage      `json:"data"`
+		Errors []GraphQLErrorDetail `json:"errors"`
+	}
+	if err := c.Do(req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return &GraphQLError{Errors: resp.Errors}
+	}
+	if v == nil || len(resp.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, v)
+}
+
+// CheckRun is a check run in a check suite. For GitHub Actions, each job is a
+// check run, and the check run ID is the job ID.
+type CheckRun struct {
+	ID          int64
+	Name        string
+	Status      RunStatus
+	Conclusion  *Conclusion
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+	// HTMLURL is the check run's page; for an Actions job, the job's page.
+	HTMLURL string
+	// Annotations are set if CheckSuitesOptions.Annotations was, and
+	// MoreAnnotations if the check run has more than were returned.
+	Annotations     []Annotation
+	MoreAnnotations bool
+}
+
+// Job returns the check run as a job of the workflow run runID. Steps aren't
+// set.
+func (cr CheckRun) Job(runID int64) Job {
+	return Job{
+		ID:          cr.ID,
+		RunID:       runID,
+		Name:        cr.Name,
+		Status:      cr.Status,
+		Conclusion:  cr.Conclusion,
+		StartedAt:   cr.StartedAt,
+		CompletedAt: cr.CompletedAt,
+		HTMLURL:     cr.HTMLURL,
+	}
+}
+
+// CheckSuite is the set of check runs one app created for a commit. For
+// GitHub Actions, each workflow run has a check suite.
+type CheckSuite struct {
+	ID         int64
+	Status     RunStatus
+	Conclusion *Conclusion
+	// WorkflowRunID and WorkflowName are set if the suite belongs to a
+	// GitHub Actions workflow run.
+	WorkflowRunID int64
+	WorkflowName  string
+	CheckRuns     []CheckRun
+	// MoreCheckRuns is set if the suite has more check runs than the
+	// query returned, so CheckRuns is incomplete.
+	MoreCheckRuns bool
+}
+
+// CheckSuitesOptions controls what CheckSuitesForCommit fetches.
+type CheckSuitesOptions struct {
+	// Annotations fetches up to 10 annotations for each check run. They make the query cost more against the GraphQL
+	// rate limit, so only ask for them when they will be shown.
+	Annotations bool
+}
+
+const checkSuitesQuery = `query($owner: String!, $repo: String!, $sha: GitObjectID!, $annotations: Boolean!) {
+  repository(owner: $owner, name: $repo) {
+    object(oid: $sha) {
+      ... on Commit {
+        checkSuites(first: 50) {
+          pageInfo { hasNextPage }
+          nodes {
+            databaseId
+            status
+            conclusion
+            workflowRun {
+              databaseId
+              workflow { name }
+            }
+            checkRuns(first: 100, filterBy: {checkType: LATEST}) {
+              pageInfo { hasNextPage }
+              nodes {
+                databaseId
+                name
+                status
+                conclusion
+                startedAt
+                completedAt
+                detailsUrl
+                annotations(first: 10) @include(if: $annotations) {
+                  totalCount
+                  pageInfo { hasNextPage }
+                  nodes {
+                    path
+                    annotationLevel
+                    title
+                    message
+                    rawDetails
+                    location { start { line } end { line } }
+                  }
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+type graphqlPageInfo struct {
+	HasNextPage bool `json:"hasNextPage"`
+}
+
+type graphqlCheckSuites struct {
+	Repository *struct {
+		Object *struct {
+			CheckSuites *struct {
+				PageInfo graphqlPageInfo `json:"pageInfo"`
+				Nodes    []struct {
+					DatabaseID  int64  `json:"databaseId"`
+					Status      string `json:"status"`
+					Conclusion  string `json:"conclusion"`
+					WorkflowRun *struct {
+						DatabaseID int64 `json:"databaseId"`
+						Workflow   struct {
+							Name string `json:"name"`
+						} `json:"workflow"`
+					} `json:"workflowRun"`
+					CheckRuns struct {
+						PageInfo graphqlPageInfo `json:"pageInfo"`
+						Nodes    []struct {
+							DatabaseID  int64      `json:"databaseId"`
+							Name        string     `json:"name"`
+							Status      string     `json:"status"`
+							Conclusion  string     `json:"conclusion"`
+							StartedAt   *time.Time `json:"startedAt"`
+							CompletedAt *time.Time `json:"completedAt"`
+							DetailsURL  string     `json:"detailsUrl"`
+							Annotations *struct {
+								TotalCount int             `json:"totalCount"`
+								PageInfo   graphqlPageInfo `json:"pageInfo"`
+								Nodes      []struct {
+									Path            string `json:"path"`
+									AnnotationLevel string `json:"annotationLevel"`
+									Title           string `json:"title"`
+									Message         string `json:"message"`
+									RawDetails      string `json:"rawDetails"`
+									Location        struct {
+										Start struct {
+											Line int `json:"line"`
+										} `json:"start"`
+										End struct {
+											Line int `json:"line"`
+										} `json:"end"`
+									} `json:"location"`
+								} `json:"nodes"`
+							} `json:"annotations"`
+						} `json:"nodes"`
+					} `json:"checkRuns"`
+				} `json:"nodes"`
+			} `json:"checkSuites"`
+		} `json:"object"`
+	} `json:"repository"`
+}
+
+// graphqlConclusion converts a GraphQL enum value like "TIMED_OUT" to the
+// REST form, "timed_out". It returns nil for an empty value.
+func graphqlConclusion(s string) *Conclusion {
+	if s == "" {
+		return nil
+	}
+	c := Conclusion(strings.ToLower(s))
+	return &c
+}
+
+// CheckSuitesForCommit fetches the check suites for a commit, with their
+// check runs and, optionally, annotations, in a single GraphQL query. It
+// returns at most 50 suites, and reports whether the commit has more; each
+// suite has at most 100 check runs, with MoreCheckRuns set if it has more.
+// https://docs.github.com/en/graphql/reference/objects#checksuite
+func (r *RepoService) CheckSuitesForCommit(ctx context.Context, sha string, opts CheckSuitesOptions) (suites []CheckSuite, more bool, err error) {
+	vars := map[string]any{
+		"owner":       r.owner,
+		"repo":        r.repo,
+		"sha":         sha,
+		"annotations": opts.Annotations,
+	}
+	var data graphqlCheckSuites
+	if err := r.client.GraphQL(ctx, checkSuitesQuery, vars, &data); err != nil {
+		return nil, false, err
+	}
+	if data.Repository == nil {
+		return nil, false, fmt.Errorf("repository %s/%s not found", r.owner, r.repo)
+	}
+	if data.Repository.Object == nil || data.Repository.Object.CheckSuites == nil {
+		// GitHub hasn't seen the commit.
+		return nil, false, nil
+	}
+
+	nodes := data.Repository.Object.CheckSuites.Nodes
+	suites = make([]CheckSuite, 0, len(nodes))
+	for _, n := range nodes {
+		suite := CheckSuite{
+			ID:            n.DatabaseID,
+			Status:        RunStatus(strings.ToLower(n.Status)),
+			Conclusion:    graphqlConclusion(n.Conclusion),
+			MoreCheckRuns: n.CheckRuns.PageInfo.HasNextPage,
+		}
+		if n.WorkflowRun != nil {
+			suite.WorkflowRunID = n.WorkflowRun.DatabaseID
+			suite.WorkflowName = n.WorkflowRun.Workflow.Name
+		}
+		for _, cr := range n.CheckRuns.Nodes {
+			run := CheckRun{
+				ID:          cr.DatabaseID,
+				Name:        cr.Name,
+				Status:      RunStatus(strings.ToLower(cr.Status)),
+				Conclusion:  graphqlConclusion(cr.Conclusion),
+				StartedAt:   cr.StartedAt,
+				CompletedAt: cr.CompletedAt,
+				HTMLURL:     cr.DetailsURL,
+			}
+			if a := cr.Annotations; a != nil {
+				run.MoreAnnotations = a.PageInfo.HasNextPage || a.TotalCount > len(a.Nodes)
+				for _, n := range a.Nodes {
+					run.Annotations = append(run.Annotations, Annotation{
+						Path:            n.Path,
+						StartLine:       n.Location.Start.Line,
+						EndLine:         n.Location.End.Line,
+						AnnotationLevel: strings.ToLower(n.AnnotationLevel),
+						Title:           n.Title,
+						Message:         n.Message,
+						RawDetails:      n.RawDetails,
+					})
+				}
+			}
+			suite.CheckRuns = append(suite.CheckRuns, run)
+		}
+		suites = append(suites, suite)
+	}
+	return suites, data.Repository.Object.CheckSuites.PageInfo.HasNextPage, nil
+}
+
+// JobsForCommit returns the jobs of every workflow run for a commit, keyed
+// by run ID, using one GraphQL query instead of a ListJobs call per run.
+// Runs missing from the map, because GitHub hasn't created a check suite for
+// them yet or because the query's page limits left some of their jobs out,
+// need their jobs fetched with the REST API.
+func (r *RepoService) JobsForCommit(ctx context.Context, sha string) (map[int64][]Job, error) {
+	suites, _, err := r.CheckSuitesForCommit(ctx, sha, CheckSuitesOptions{})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make(map[int64][]Job, len(suites))
+	for _, suite := range suites {
+		if suite.WorkflowRunID == 0 || suite.MoreCheckRuns {
+			continue
+		}
+		runJobs := make([]Job, 0, len(suite.CheckRuns))
+		for _, cr := range suite.CheckRuns {
+			runJobs = append(runJobs, cr.Job(suite.WorkflowRunID))
+		}
+		jobs[suite.WorkflowRunID] = runJobs
+	}
+	return jobs, nil
+}
+
+// AnnotationsForCommit returns the annotations of the check runs for a
+// commit, keyed by check run ID, which for an Actions job is the job ID,
+// using one GraphQL query instead of a ListCheckRunAnnotations call per job.
+// Check runs with more annotations than the query returns are left out, for
+// the caller to fetch with the REST API.
+func (r *RepoService) AnnotationsForCommit(ctx context.Context, sha string) (map[int64][]Annotation, error) {
+	suites, _, err := r.CheckSuitesForCommit(ctx, sha, CheckSuitesOptions{Annotations: true})
+	if err != nil {
+		return nil, err
+	}
+	annots := make(map[int64][]Annotation)
+	for _, suite := range suites {
+		for _, cr := range suite.CheckRuns {
+			if !cr.MoreAnnotations {
+				annots[cr.ID] = cr.Annotations
+			}
+		}
+	}
+	return annots, nil
+}
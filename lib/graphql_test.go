@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+const checkSuitesBody = `{"data":{"repository":{"object":{"checkSuites":{"pageInfo":{"hasNextPage":true},"nodes":[
+  {"databaseId":10,"status":"IN_PROGRESS","conclusion":null,
+   "workflowRun":{"databaseId":5,"workflow":{"name":"CI"}},
+   "checkRuns":{"nodes":[
+     {"databaseId":100,"name":"test","status":"COMPLETED","conclusion":"TIMED_OUT",
+      "startedAt":"2026-01-01T10:00:00Z","completedAt":"2026-01-01T10:05:00Z",
+      "detailsUrl":"https://github.com/o/r/actions/runs/5/job/100",
+      "annotations":{"totalCount":1,"pageInfo":{"hasNextPage":false},"nodes":[{"path":".github","annotationLevel":"FAILURE","title":"","message":"The job has exceeded the maximum execution time","rawDetails":"","location":{"start":{"line":1},"end":{"line":2}}}]}},
+     {"databaseId":101,"name":"lint","status":"IN_PROGRESS","conclusion":null,
+      "startedAt":"2026-01-01T10:00:00Z","completedAt":null,"detailsUrl":"",
+      "annotations":{"totalCount":12,"pageInfo":{"hasNextPage":true},"nodes":[{"annotationLevel":"WARNING","message":"1 of 12"}]}}
+   ]}},
+  {"databaseId":11,"status":"COMPLETED","conclusion":"SUCCESS","workflowRun":null,
+   "checkRuns":{"nodes":[{"databaseId":200,"name":"external","status":"COMPLETED","conclusion":"SUCCESS"}]}},
+  {"databaseId":12,"status":"IN_PROGRESS","conclusion":null,
+   "workflowRun":{"databaseId":6,"workflow":{"name":"Matrix"}},
+   "checkRuns":{"pageInfo":{"hasNextPage":true},"nodes":[{"databaseId":300,"name":"shard 1","status":"IN_PROGRESS","conclusion":null}]}}
+]}}}}}`
+
+func TestCheckSuitesForCommit(t *testing.T) {
+	var got struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		io.WriteString(w, checkSuitesBody)
+	})
+	c, cleanup := newTestClient(t, mux)
+	defer cleanup()
+
+	suites, more, err := c.Repo("o", "r").CheckSuitesForCommit(context.Background(), "abc123", CheckSuitesOptions{Annotations: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Variables["sha"] != "abc123" || got.Variables["owner"] != "o" || got.Variables["annotations"] != true {
+		t.Errorf("variables = %v", got.Variables)
+	}
+	if len(suites) != 3 || !more {
+		t.Fatalf("got %d suites, more = %v, want 3 and more", len(suites), more)
+	}
+	s := suites[0]
+	if s.WorkflowRunID != 5 || s.WorkflowName != "CI" || s.Status != StatusInProgress || s.Conclusion != nil {
+		t.Errorf("suite = %+v", s)
+	}
+	if len(s.CheckRuns) != 2 {
+		t.Fatalf("got %d check runs, want 2", len(s.CheckRuns))
+	}
+	cr := s.CheckRuns[0]
+	if cr.ID != 100 || cr.Conclusion == nil || *cr.Conclusion != ConclusionTimedOut || cr.CompletedAt == nil {
+		t.Errorf("check run = %+v", cr)
+	}
+	if len(cr.Annotations) != 1 || cr.Annotations[0].AnnotationLevel != "failure" || cr.Annotations[0].EndLine != 2 || cr.MoreAnnotations {
+		t.Errorf("annotations = %+v, more = %v", cr.Annotations, cr.MoreAnnotations)
+	}
+	if !s.CheckRuns[1].MoreAnnotations {
+		t.Errorf("check run with 12 annotations should have MoreAnnotations set")
+	}
+	if s.MoreCheckRuns || !suites[2].MoreCheckRuns {
+		t.Errorf("MoreCheckRuns = %v, %v, want false, true", s.MoreCheckRuns, suites[2].MoreCheckRuns)
+	}
+	if suites[1].WorkflowRunID != 0 {
+		t.Errorf("suite without a workflow run has WorkflowRunID %d", suites[1].WorkflowRunID)
+	}
+}
+
+func TestJobsForCommit(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, checkSuitesBody)
+	})
+	c, cleanup := newTestClient(t, mux)
+	defer cleanup()
+
+	jobs, err := c.Repo("o", "r").JobsForCommit(context.Background(), "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Run 6 has more jobs than the query returned, so it's left for the
+	// REST API.
+	if len(jobs) != 1 || len(jobs[5]) != 2 {
+		t.Fatalf("jobs = %+v, want 2 jobs for run 5 and nothing for run 6", jobs)
+	}
+	if j := jobs[5][0]; j.ID != 100 || j.RunID != 5 || !j.Failed() || j.FailedStepURL() != "https://github.com/o/r/actions/runs/5/job/100" {
+		t.Errorf("job = %+v", j)
+	}
+	if jobs[5][1].Failed() || jobs[5][1].Status != StatusInProgress {
+		t.Errorf("job = %+v", jobs[5][1])
+	}
+}
+
+func TestAnnotationsForCommit(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, checkSuitesBody)
+	})
+	c, cleanup := newTestClient(t, mux)
+	defer cleanup()
+
+	annots, err := c.Repo("o", "r").AnnotationsForCommit(context.Background(), "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annots[100]) != 1 || annots[100][0].Message != "The job has exceeded the maximum execution time" {
+		t.Errorf("annotations for 100 = %+v", annots[100])
+	}
+	// Check run 101 has more annotations than the query returned, so it's
+	// left for the REST API.
+	if _, ok := annots[101]; ok {
+		t.Errorf("truncated annotations for 101 were returned: %+v", annots[101])
+	}
+	// 200 has no annotations, which is a complete answer.
+	if a, ok := annots[200]; !ok || len(a) != 0 {
+		t.Errorf("annotations for 200 = %+v, %v, want an empty entry", a, ok)
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "4990")
+		w.Header().Set("X-RateLimit-Resource", "graphql")
+		io.WriteString(w, `{"data":null,"errors":[{"type":"FORBIDDEN","message":"Resource not accessible by integration"}]}`)
+	})
+	c, cleanup := newTestClient(t, mux)
+	defer cleanup()
+
+	_, err := c.Repo("o", "r").JobsForCommit(context.Background(), "abc123")
+	var gqlErr *GraphQLError
+	if !errors.As(err, &gqlErr) || gqlErr.Errors[0].Type != "FORBIDDEN" {
+		t.Fatalf("err = %v, want a FORBIDDEN *GraphQLError", err)
+	}
+	if rl := c.GraphQLRateLimit(); rl == nil || rl.Remaining != 4990 {
+		t.Errorf("GraphQLRateLimit() = %+v, want 4990 remaining", rl)
+	}
+	if c.RateLimit() != nil {
+		t.Errorf("GraphQL rate limit was recorded as the REST rate limit")
+	}
+}
+
+func TestGraphQLURL(t *testing.T) {
+	tests := map[string]string{
+		"github.com":           "https://api.github.com/graphql",
+		"ghe.example.com":      "https://ghe.example.com/api/graphql",
+		"ghe.example.com:8443": "https://ghe.example.com:8443/api/graphql",
+	}
+	for host, want := range tests {
+		if got := NewClient("token", host).graphqlURL(); got != want {
+			t.Errorf("graphqlURL() for %q = %q, want %q", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxHistorySamples is the number of runs kept per workflow in the on-disk
+// duration history. Older samples are dropped as new runs complete.
+const maxHistorySamples = 50
+
+// maxJobFetchesPerRefresh bounds the number of ListJobs calls a single
+// RefreshDurationHistory makes. Runs beyond the limit are still recorded, just
+// without per-job detail.
+const maxJobFetchesPerRefresh = 10
+
+// StepSample records how long one step of a job took.
+type StepSample struct {
+	Number   int           `json:"number"`
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// JobSample records the timing of one job within a historical run.
+type JobSample struct {
+	Name string `json:"name"`
+	// StartOffset is how long after the run started the job started.
+	StartOffset time.Duration `json:"start_offset"`
+	Duration    time.Duration `json:"duration"`
+	Steps       []StepSample  `json:"steps,omitempty"`
+}
+
+// RunSample records the timing of one successful historical run.
+type RunSample struct {
+	RunID       int64         `json:"run_id"`
+	CompletedAt time.Time     `json:"completed_at"`
+	Duration    time.Duration `json:"duration"`
+	// Jobs is empty if the job list was not fetched for this run.
+	Jobs []JobSample `json:"jobs,omitempty"`
+}
+
+// DurationHistory is the cached duration history for a single workflow.
+type DurationHistory struct {
+	Host       string      `json:"host"`
+	Owner      string      `json:"owner"`
+	Repo       string      `json:"repo"`
+	WorkflowID int64       `json:"workflow_id"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Samples    []RunSample `json:"samples"` // newest first
+
+	path string
+}
+
+// CacheDir returns the directory github-actions uses for cached data:
+// $XDG_CACHE_HOME/github-actions, falling back to the platform user cache
+// directory.
+func CacheDir() (string, error) {
+	if xdg := os.Getenv("XDG_CACHE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "github-actions"), nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("finding cache directory: %w", err)
+	}
+	return filepath.Join(dir, "github-actions"), nil
+}
+
+func (r *RepoService) historyPath(workflowID int64) (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "estimates", r.client.host, r.owner, r.repo, strconv.FormatInt(workflowID, 10)+".json"), nil
+}
+
+// LoadDurationHistory reads the cached duration history for a workflow. A
+// missing or unreadable cache file is not an error; it returns an empty
+// history that can be refreshed and saved.
+func (r *RepoService) LoadDurationHistory(workflowID int64) (*DurationHistory, error) {
+	path, err := r.historyPath(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	h := &DurationHistory{
+		Host:       r.client.host,
+		Owner:      r.owner,
+		Repo:       r.repo,
+		WorkflowID: workflowID,
+		path:       path,
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cached DurationHistory
+	if err := json.Unmarshal(data, &cached); err != nil {
+		// A corrupt cache just means we start over.
+		return h, nil
+	}
+	h.UpdatedAt = cached.UpdatedAt
+	h.Samples = cached.Samples
+	return h, nil
+}
+
+// Save writes the history back to the cache directory. The file is replaced
+// atomically so concurrent invocations never see a partial write.
+func (h *DurationHistory) Save() error {
+	if h.path == "" {
+		return errors.New("duration history was not loaded from the cache")
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(h.path, data)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, creating the directory if needed.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Median returns the median run duration across all samples.
+func (h *DurationHistory) Median() (time.Duration, bool) {
+	durations := make([]time.Duration, 0, len(h.Samples))
+	for _, s := range h.Samples {
+		if s.Duration > 0 {
+			durations = append(durations, s.Duration)
+		}
+	}
+	return median(durations)
+}
+
+// JobMedian returns the median duration of the named job across all samples
+// that include job detail.
+func (h *DurationHistory) JobMedian(name string) (time.Duration, bool) {
+	var durations []time.Duration
+	for _, s := range h.Samples {
+		for _, j := range s.Jobs {
+			if j.Name == name && j.Duration > 0 {
+				durations = append(durations, j.Duration)
+			}
+		}
+	}
+	return median(durations)
+}
+
+func median(durations []time.Duration) (time.Duration, bool) {
+	if len(durations) == 0 {
+		return 0, false
+	}
+	slices.Sort(durations)
+	return durations[len(durations)/2], true
+}
+
+func (h *DurationHistory) has(runID int64) bool {
+	for _, s := range h.Samples {
+		if s.RunID == runID {
+			return true
+		}
+	}
+	return false
+}
+
+// newRunSample converts a completed run and its jobs into a RunSample.
+func newRunSample(run WorkflowRun, jobs []Job) RunSample {
+	sample := RunSample{
+		RunID:       run.ID,
+		CompletedAt: run.UpdatedAt,
+		Duration:    run.Duration(),
+	}
+	for _, job := range jobs {
+		if job.StartedAt == nil || job.CompletedAt == nil {
+			continue
+		}
+		js := JobSample{
+			Name:     job.Name,
+			Duration: job.CompletedAt.Sub(*job.StartedAt),
+		}
+		if run.RunStartedAt != nil {
+			js.StartOffset = max(job.StartedAt.Sub(*run.RunStartedAt), 0)
+		}
+		for _, step := range job.Steps {
+			if step.StartedAt == nil || step.CompletedAt == nil {
+				continue
+			}
+			js.Steps = append(js.Steps, StepSample{
+				Number:   step.Number,
+				Name:     step.Name,
+				Duration: step.CompletedAt.Sub(*step.StartedAt),
+			})
+		}
+		sample.Jobs = append(sample.Jobs, js)
+	}
+	return sample
+}
+
+// RefreshDurationHistory adds successful runs that completed since the
+// history was last refreshed, fetching their jobs so per-job estimates are
+// available. It returns the number of samples added. An empty history is
+// seeded with up to maxHistorySamples runs.
+func (r *RepoService) RefreshDurationHistory(ctx context.Context, h *DurationHistory) (int, error) {
+	perPage := 20
+	if len(h.Samples) == 0 {
+		perPage = maxHistorySamples
+	}
+	params := url.Values{
+		"status":     {"completed"},
+		"conclusion": {"success"},
+		"per_page":   {strconv.Itoa(perPage)},
+	}
+	resp, err := r.ListWorkflowRunsByWorkflow(ctx, h.WorkflowID, params)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	jobFetches := 0
+	for _, run := range resp.WorkflowRuns {
+		if h.has(run.ID) || run.Duration() <= 0 {
+			continue
+		}
+		var jobs []Job
+		if jobFetches < maxJobFetchesPerRefresh {
+			jobFetches++
+			jobs, err = r.ListAllJobs(ctx, run.ID)
+			if err != nil {
+				// Keep the run-level sample; job detail is a bonus.
+				jobs = nil
+			}
+		}
+		h.Samples = append(h.Samples, newRunSample(run, jobs))
+		added++
+	}
+	sort.SliceStable(h.Samples, func(i, j int) bool {
+		return h.Samples[i].CompletedAt.After(h.Samples[j].CompletedAt)
+	})
+	if len(h.Samples) > maxHistorySamples {
+		h.Samples = h.Samples[:maxHistorySamples]
+	}
+	h.UpdatedAt = time.Now()
+	return added, nil
+}
+
+// JobProfile summarizes the historical timing of one job in a workflow.
+type JobProfile struct {
+	Name        string
+	Duration    time.Duration // median
+	StartOffset time.Duration // median time from run start to job start
+	// Needs lists the jobs that always finished before this job started, in
+	// every sample that contained both. The REST API does not expose the
+	// workflow's needs: graph, so it is inferred from start times.
+	Needs []string
+	// Samples is the number of historical runs that contained the job.
+	Samples int
+	// Steps holds the median duration of each step, ordered by step number.
+	Steps []StepSample
+}
+
+// dependencySlack allows for clock skew between a job's recorded completion
+// and its dependent's start.
+const dependencySlack = 5 * time.Second
+
+// JobProfiles returns a profile for every job that appears in at least half
+// of the samples that include job detail. Jobs that only ran occasionally -
+// conditional jobs, for example - are left out so they don't skew the ETA.
+func (h *DurationHistory) JobProfiles() map[string]JobProfile {
+	withJobs := 0
+	byName := make(map[string][]JobSample)
+	for _, s := range h.Samples {
+		if len(s.Jobs) == 0 {
+			continue
+		}
+		withJobs++
+		for _, j := range s.Jobs {
+			byName[j.Name] = append(byName[j.Name], j)
+		}
+	}
+	if withJobs == 0 {
+		return nil
+	}
+
+	profiles := make(map[string]JobProfile, len(byName))
+	for name, samples := range byName {
+		if len(samples)*2 < withJobs {
+			continue
+		}
+		durations := make([]time.Duration, 0, len(samples))
+		offsets := make([]time.Duration, 0, len(samples))
+		stepDurations := make(map[int][]time.Duration)
+		stepNames := make(map[int]string)
+		for _, j := range samples {
+			durations = append(durations, j.Duration)
+			offsets = append(offsets, j.StartOffset)
+			for _, step := range j.Steps {
+				stepDurations[step.Number] = append(stepDurations[step.Number], step.Duration)
+				stepNames[step.Number] = step.Name
+			}
+		}
+		d, _ := median(durations)
+		o, _ := median(offsets)
+		p := JobProfile{Name: name, Duration: d, StartOffset: o, Samples: len(samples)}
+		for number, ds := range stepDurations {
+			sd, _ := median(ds)
+			p.Steps = append(p.Steps, StepSample{Number: number, Name: stepNames[number], Duration: sd})
+		}
+		sort.Slice(p.Steps, func(i, j int) bool { return p.Steps[i].Number < p.Steps[j].Number })
+		profiles[name] = p
+	}
+
+	for name, p := range profiles {
+		for other := range profiles {
+			if other != name && alwaysFinishedBefore(h.Samples, other, name) {
+				p.Needs = append(p.Needs, other)
+			}
+		}
+		slices.Sort(p.Needs)
+		profiles[name] = p
+	}
+	return profiles
+}
+
+// alwaysFinishedBefore reports whether job before finished before job after
+// started in every sample containing both, and at least one sample does.
+func alwaysFinishedBefore(samples []RunSample, before, after string) bool {
+	shared := 0
+	for _, s := range samples {
+		var b, a *JobSample
+		for i := range s.Jobs {
+			switch s.Jobs[i].Name {
+			case before:
+				b = &s.Jobs[i]
+			case after:
+				a = &s.Jobs[i]
+			}
+		}
+		if a == nil || b == nil {
+			continue
+		}
+		shared++
+		if b.StartOffset+b.Duration > a.StartOffset+dependencySlack {
+			return false
+		}
+	}
+	return shared > 0
+}
@@ -0,0 +1,217 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheDirHonorsXDG(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	got, err := CacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "github-actions"); got != want {
+		t.Errorf("CacheDir() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadDurationHistoryMissing(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	c := NewClient("token", "github.com")
+	h, err := c.Repo("o", "r").LoadDurationHistory(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Samples) != 0 || h.WorkflowID != 7 || h.Host != "github.com" {
+		t.Errorf("LoadDurationHistory(missing) = %+v", h)
+	}
+	if _, ok := h.Median(); ok {
+		t.Error("Median() of empty history should report ok=false")
+	}
+}
+
+// historyRunsBody returns a list-runs response with the given run IDs, each
+// lasting id minutes.
+func historyRunsBody(ids ...int64) string {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var runs []string
+	for _, id := range ids {
+		start := base.Add(time.Duration(id) * time.Hour)
+		end := start.Add(time.Duration(id) * time.Minute)
+		runs = append(runs, fmt.Sprintf(`{"id":%d,"status":"completed","conclusion":"success","run_started_at":%q,"updated_at":%q}`,
+			id, start.Format(time.RFC3339), end.Format(time.RFC3339)))
+	}
+	return fmt.Sprintf(`{"total_count":%d,"workflow_runs":[%s]}`, len(ids), strings.Join(runs, ","))
+}
+
+func TestRefreshDurationHistory(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runsBody := historyRunsBody(3, 2, 1)
+	jobCalls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/actions/workflows/7/runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("conclusion") != "success" {
+			t.Errorf("expected conclusion=success filter, got %q", r.URL.RawQuery)
+		}
+		io.WriteString(w, runsBody)
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs/", func(w http.ResponseWriter, r *http.Request) {
+		jobCalls++
+		io.WriteString(w, `{"total_count":1,"jobs":[{"name":"test","status":"completed","started_at":"2026-01-01T03:00:30Z","completed_at":"2026-01-01T03:02:30Z","steps":[{"number":1,"name":"Set up job","started_at":"2026-01-01T03:00:30Z","completed_at":"2026-01-01T03:00:35Z"}]}]}`)
+	})
+	c, cleanup := newTestClient(t, mux)
+	defer cleanup()
+	repo := c.Repo("o", "r")
+
+	h, err := repo.LoadDurationHistory(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := repo.RefreshDurationHistory(context.Background(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 3 || jobCalls != 3 {
+		t.Fatalf("added = %d, job calls = %d, want 3 and 3", added, jobCalls)
+	}
+	if h.Samples[0].RunID != 3 {
+		t.Errorf("samples should be newest first, got first run %d", h.Samples[0].RunID)
+	}
+	if got, _ := h.Median(); got != 2*time.Minute {
+		t.Errorf("Median() = %s, want 2m", got)
+	}
+	if got, ok := h.JobMedian("test"); !ok || got != 2*time.Minute {
+		t.Errorf("JobMedian(test) = %s, %v, want 2m", got, ok)
+	}
+	if len(h.Samples[0].Jobs) != 1 || len(h.Samples[0].Jobs[0].Steps) != 1 {
+		t.Errorf("expected job and step detail, got %+v", h.Samples[0].Jobs)
+	}
+	if err := h.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second refresh only picks up the new run.
+	runsBody = historyRunsBody(4, 3, 2)
+	jobCalls = 0
+	reloaded, err := repo.LoadDurationHistory(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Samples) != 3 {
+		t.Fatalf("reloaded %d samples, want 3", len(reloaded.Samples))
+	}
+	added, err = repo.RefreshDurationHistory(context.Background(), reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 || jobCalls != 1 {
+		t.Errorf("incremental refresh added %d runs with %d job calls, want 1 and 1", added, jobCalls)
+	}
+	if len(reloaded.Samples) != 4 || reloaded.Samples[0].RunID != 4 {
+		t.Errorf("samples after incremental refresh = %+v", reloaded.Samples)
+	}
+}
+
+func TestRefreshDurationHistoryTrimsSamples(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	ids := make([]int64, 0, maxHistorySamples+5)
+	for i := maxHistorySamples + 5; i > 0; i-- {
+		ids = append(ids, int64(i))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/actions/workflows/7/runs", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, historyRunsBody(ids...))
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"total_count":0,"jobs":[]}`)
+	})
+	c, cleanup := newTestClient(t, mux)
+	defer cleanup()
+	repo := c.Repo("o", "r")
+
+	h, err := repo.LoadDurationHistory(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.RefreshDurationHistory(context.Background(), h); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Samples) != maxHistorySamples {
+		t.Errorf("len(Samples) = %d, want %d", len(h.Samples), maxHistorySamples)
+	}
+}
+
+func TestLoadDurationHistoryCorrupt(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	repo := NewClient("token", "github.com").Repo("o", "r")
+	path, err := repo.historyPath(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := repo.LoadDurationHistory(7)
+	if err != nil {
+		t.Fatalf("corrupt cache should not be an error: %v", err)
+	}
+	if len(h.Samples) != 0 {
+		t.Errorf("corrupt cache should load as empty, got %+v", h.Samples)
+	}
+}
+
+func TestJobProfilesInfersNeeds(t *testing.T) {
+	// test always starts right after build finishes. lint runs alongside
+	// and usually finishes first, but not always, so it isn't a dependency.
+	sample := func(id int64, lint time.Duration) RunSample {
+		return RunSample{
+			RunID:    id,
+			Duration: 20 * time.Minute,
+			Jobs: []JobSample{
+				{Name: "build", Duration: 5 * time.Minute, Steps: []StepSample{{Number: 1, Name: "Set up job", Duration: time.Minute}}},
+				{Name: "lint", Duration: lint},
+				{Name: "test", StartOffset: 5*time.Minute + 2*time.Second, Duration: 10 * time.Minute},
+			},
+		}
+	}
+	h := &DurationHistory{Samples: []RunSample{
+		sample(1, 2*time.Minute),
+		sample(2, 7*time.Minute),
+		{RunID: 3, Duration: 30 * time.Minute},
+		sample(4, 2*time.Minute),
+	}}
+	// One run where a conditional job ran; it should be left out.
+	h.Samples[0].Jobs = append(h.Samples[0].Jobs, JobSample{Name: "release", Duration: time.Minute})
+
+	profiles := h.JobProfiles()
+	if _, ok := profiles["release"]; ok {
+		t.Error("release ran in a minority of samples and should not be profiled")
+	}
+	test := profiles["test"]
+	if len(test.Needs) != 1 || test.Needs[0] != "build" {
+		t.Errorf("test.Needs = %v, want [build]", test.Needs)
+	}
+	if len(profiles["build"].Needs) != 0 {
+		t.Errorf("build.Needs = %v, want none", profiles["build"].Needs)
+	}
+	if steps := profiles["build"].Steps; len(steps) != 1 || steps[0].Duration != time.Minute {
+		t.Errorf("build.Steps = %+v", steps)
+	}
+
+	if got := (&DurationHistory{Samples: []RunSample{{Duration: time.Minute}}}).JobProfiles(); got != nil {
+		t.Errorf("JobProfiles() without job detail = %v, want nil", got)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -45,26 +46,34 @@ type PullRequestRef struct {
 
 // WorkflowRun represents a GitHub Actions workflow run.
 type WorkflowRun struct {
-	ID           int64      `json:"id"`
-	Name         string     `json:"name"`
-	HeadBranch   string     `json:"head_branch"`
-	HeadSha      string     `json:"head_sha"`
-	Path         string     `json:"path"`
-	RunNumber    int        `json:"run_number"`
-	RunAttempt   int        `json:"run_attempt"`
-	Event        string     `json:"event"`
-	DisplayTitle string     `json:"display_title"`
-	Status       string     `json:"status"`     // queued, in_progress, completed
-	Conclusion   *string    `json:"conclusion"` // success, failure, cancelled, skipped, etc.
-	WorkflowID   int64      `json:"workflow_id"`
-	URL          string     `json:"url"`
-	HTMLURL      string     `json:"html_url"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	RunStartedAt *time.Time `json:"run_started_at"`
-	JobsURL      string     `json:"jobs_url"`
+	ID           int64       `json:"id"`
+	Name         string      `json:"name"`
+	HeadBranch   string      `json:"head_branch"`
+	HeadSha      string      `json:"head_sha"`
+	Path         string      `json:"path"`
+	RunNumber    int         `json:"run_number"`
+	RunAttempt   int         `json:"run_attempt"`
+	Event        string      `json:"event"`
+	DisplayTitle string      `json:"display_title"`
+	Status       RunStatus   `json:"status"`
+	Conclusion   *Conclusion `json:"conclusion"`
+	WorkflowID   int64       `json:"workflow_id"`
+	URL          string      `json:"url"`
+	HTMLURL      string      `json:"html_url"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	RunStartedAt *time.Time  `json:"run_started_at"`
+	JobsURL      string      `json:"jobs_url"`
 
 	PullRequests []PullRequestRef `json:"pull_requests"`
+	// HeadRepository is the repository the commit was pushed to; for a pull
+	// request from a fork, it is the fork.
+	HeadRepository RepositoryRef `json:"head_repository"`
+}
+
+// RepositoryRef identifies a repository in a workflow run.
+type RepositoryRef struct {
+	FullName string `json:"full_name"` // "owner/repo"
 }
 
 // JobsResponse represents the response from listing jobs for a workflow run.
@@ -75,30 +84,51 @@ type JobsResponse struct {
 
 // Job represents a job within a workflow run.
 type Job struct {
-	ID          int64      `json:"id"`
-	RunID       int64      `json:"run_id"`
-	Name        string     `json:"name"`
-	Status      string     `json:"status"`
-	Conclusion  *string    `json:"conclusion"`
-	StartedAt   *time.Time `json:"started_at"`
-	CompletedAt *time.Time `json:"completed_at"`
-	Steps       []Step     `json:"steps"`
-	HTMLURL     string     `json:"html_url"`
+	ID          int64       `json:"id"`
+	RunID       int64       `json:"run_id"`
+	Name        string      `json:"name"`
+	Status      RunStatus   `json:"status"`
+	Conclusion  *Conclusion `json:"conclusion"`
+	CreatedAt   *time.Time  `json:"created_at"`
+	StartedAt   *time.Time  `json:"started_at"`
+	CompletedAt *time.Time  `json:"completed_at"`
+	Steps       []Step      `json:"steps"`
+	HTMLURL     string      `json:"html_url"`
 }
 
-// Failed returns true if the job failed.
+// Failed returns true if the job failed. Unlike WorkflowRun.IsFailed, a
+// cancelled job doesn't count: when one matrix job fails, GitHub cancels its
+// siblings, and the failure is the interesting one.
 func (j Job) Failed() bool {
-	return j.Conclusion != nil && *j.Conclusion == "failure"
+	if j.Conclusion == nil {
+		return false
+	}
+	c := *j.Conclusion
+	return c == ConclusionFailure || c == ConclusionTimedOut
+}
+
+// FailedStepURL returns a link to the job's first failed step, or to the job
+// itself if no step failed. It returns "" if the job has no URL.
+func (j Job) FailedStepURL() string {
+	if j.HTMLURL == "" {
+		return ""
+	}
+	for _, step := range j.Steps {
+		if step.Conclusion != nil && *step.Conclusion == ConclusionFailure && step.Number > 0 {
+			return fmt.Sprintf("%s#step:%d:1", j.HTMLURL, step.Number)
+		}
+	}
+	return j.HTMLURL
 }
 
 // Step represents a step within a job.
 type Step struct {
-	Name        string     `json:"name"`
-	Status      string     `json:"status"`
-	Conclusion  *string    `json:"conclusion"`
-	Number      int        `json:"number"`
-	StartedAt   *time.Time `json:"started_at"`
-	CompletedAt *time.Time `json:"completed_at"`
+	Name        string      `json:"name"`
+	Status      RunStatus   `json:"status"`
+	Conclusion  *Conclusion `json:"conclusion"`
+	Number      int         `json:"number"`
+	StartedAt   *time.Time  `json:"started_at"`
+	CompletedAt *time.Time  `json:"completed_at"`
 }
 
 // Annotation represents a check-run annotation. Annotations surface
@@ -117,6 +147,24 @@ type Annotation struct {
 // Host represents a GitHub host configuration.
 type Host struct {
 	Token string `toml:"token"`
+	// APIURL overrides the REST API base URL for the host, for GitHub
+	// Enterprise Server installs that don't serve it at
+	// https://<host>/api/v3.
+	APIURL string `toml:"api_url"`
+	// Proxy is the URL of the HTTP proxy to use for the host, e.g.
+	// "http://proxy.corp.example:3128". If it is unset, the HTTPS_PROXY and
+	// NO_PROXY environment variables apply.
+	Proxy string `toml:"proxy"`
+	// CAFile is a PEM file of CA certificates to trust for the host, in
+	// addition to the system roots.
+	CAFile string `toml:"ca_file"`
+	// ClientCert and ClientKey are PEM files holding a TLS client
+	// certificate and its key, for hosts that require one.
+	ClientCert string `toml:"client_cert"`
+	ClientKey  string `toml:"client_key"`
+	// InsecureSkipVerify turns off TLS certificate verification for the
+	// host. Prefer CAFile.
+	InsecureSkipVerify bool `toml:"insecure_skip_verify"`
 }
 
 // FileConfig represents the configuration file structure.
@@ -160,32 +208,20 @@ func getCfgPath() (string, error) {
 	return "", nil // No config file found, but that's OK - we'll use env vars
 }
 
-// GetToken retrieves a GitHub token for the given host.
-// It checks in order:
-// 1. GH_TOKEN environment variable
-// 2. GITHUB_TOKEN environment variable
-// 3. Config file
-func GetToken(ctx context.Context, host string) (string, error) {
-	// Check environment variables first
-	if token := os.Getenv("GH_TOKEN"); token != "" {
-		return token, nil
-	}
-	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-		return token, nil
-	}
-
-	// Try config file
+// readFileConfig reads the user config file. It returns nil if there is no
+// config file.
+func readFileConfig(ctx context.Context) (*FileConfig, error) {
 	cfgPath, err := getCfgPath()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if cfgPath == "" {
-		return "", errors.New(tokenNotFoundMessage(host))
+		return nil, nil
 	}
 
 	f, err := os.Open(cfgPath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer f.Close()
 
@@ -196,13 +232,60 @@ func GetToken(ctx context.Context, host string) (string, error) {
 
 	var cfg FileConfig
 	if _, err := toml.NewDecoder(bufio.NewReader(f)).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// LookupHost returns the [hosts."<host>"] table from the user config file,
+// trying host without its port if there is no entry for it. ok is false if
+// the config file has no entry for host.
+func LookupHost(ctx context.Context, host string) (h Host, ok bool, err error) {
+	cfg, err := readFileConfig(ctx)
+	if err != nil || cfg == nil {
+		return Host{}, false, err
+	}
+	if h, ok = cfg.Hosts[host]; ok {
+		return h, true, nil
+	}
+	if hostname, _, hasPort := strings.Cut(host, ":"); hasPort {
+		h, ok = cfg.Hosts[hostname]
+	}
+	return h, ok, nil
+}
+
+// GetToken retrieves a GitHub token for the given host.
+// It checks in order:
+// 1. GH_TOKEN environment variable
+// 2. GITHUB_TOKEN environment variable
+// 3. Config file
+func GetToken(ctx context.Context, host string) (string, error) {
+	// Check environment variables first
+	if token := os.Getenv("GH_TOKEN"); token != "" {
+		return token, nil
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	// Try config file
+	cfg, err := readFileConfig(ctx)
+	if err != nil {
 		return "", err
 	}
+	if cfg == nil {
+		return "", &TokenNotFoundError{Host: host}
+	}
 
-	// Try exact host match
+	// Try exact host match, then the host without a port
 	if h, ok := cfg.Hosts[host]; ok && h.Token != "" {
 		return h.Token, nil
 	}
+	if hostname, _, ok := strings.Cut(host, ":"); ok {
+		if h, ok := cfg.Hosts[hostname]; ok && h.Token != "" {
+			return h.Token, nil
+		}
+	}
 
 	// Try default host
 	if cfg.Default != "" {
@@ -216,10 +299,16 @@ func GetToken(ctx context.Context, host string) (string, error) {
 		return h.Token, nil
 	}
 
-	return "", errors.New(tokenNotFoundMessage(host))
+	return "", &TokenNotFoundError{Host: host}
 }
 
-func tokenNotFoundMessage(host string) string {
+// TokenNotFoundError is returned by GetToken when no token is configured for
+// a host.
+type TokenNotFoundError struct {
+	Host string
+}
+
+func (e *TokenNotFoundError) Error() string {
 	return fmt.Sprintf(`Couldn't find a GitHub token for host %q.
 
 Set the GH_TOKEN or GITHUB_TOKEN environment variable, or add a configuration file:
@@ -234,17 +323,17 @@ default = "github.com"
 token = "ghp_xxxx"
 
 Go to https://github.com/settings/tokens to create a token.
-`, host)
+`, e.Host)
 }
 
 // IsCompleted returns true if the workflow run has completed.
 func (r *WorkflowRun) IsCompleted() bool {
-	return r.Status == "completed"
+	return r.Status.IsTerminal()
 }
 
 // IsSuccess returns true if the workflow run completed successfully.
 func (r *WorkflowRun) IsSuccess() bool {
-	return r.IsCompleted() && r.Conclusion != nil && *r.Conclusion == "success"
+	return r.IsCompleted() && r.Conclusion != nil && *r.Conclusion == ConclusionSuccess
 }
 
 // IsFailed returns true if the workflow run failed.
@@ -252,8 +341,26 @@ func (r *WorkflowRun) IsFailed() bool {
 	if !r.IsCompleted() || r.Conclusion == nil {
 		return false
 	}
-	c := *r.Conclusion
-	return c == "failure" || c == "cancelled" || c == "timed_out"
+	return r.Conclusion.IsFailed()
+}
+
+// NeedsAttention returns true if the workflow run is blocked until someone
+// acts on it: approving a run from a first-time contributor
+// (action_required), or approving a deployment (waiting).
+func (r *WorkflowRun) NeedsAttention() bool {
+	if r.Status.NeedsAttention() {
+		return true
+	}
+	return r.IsCompleted() && r.Conclusion != nil && r.Conclusion.NeedsAttention()
+}
+
+// StatusText returns the conclusion of a completed run, or its status
+// otherwise.
+func (r *WorkflowRun) StatusText() string {
+	if r.IsCompleted() && r.Conclusion != nil {
+		return string(*r.Conclusion)
+	}
+	return string(r.Status)
 }
 
 // Duration returns the duration of the workflow run.
@@ -1,15 +1,18 @@
 package lib
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
-func ptr(s string) *string { return &s }
+func ptr(c Conclusion) *Conclusion { return &c }
 
 func TestWorkflowRunIsCompleted(t *testing.T) {
 	tests := []struct {
-		status string
+		status RunStatus
 		want   bool
 	}{
 		{"completed", true},
@@ -17,7 +20,7 @@ func TestWorkflowRunIsCompleted(t *testing.T) {
 		{"queued", false},
 	}
 	for _, tt := range tests {
-		t.Run(tt.status, func(t *testing.T) {
+		t.Run(string(tt.status), func(t *testing.T) {
 			r := &WorkflowRun{Status: tt.status}
 			if got := r.IsCompleted(); got != tt.want {
 				t.Errorf("IsCompleted() = %v, want %v", got, tt.want)
@@ -29,8 +32,8 @@ func TestWorkflowRunIsCompleted(t *testing.T) {
 func TestWorkflowRunIsSuccess(t *testing.T) {
 	tests := []struct {
 		name       string
-		status     string
-		conclusion *string
+		status     RunStatus
+		conclusion *Conclusion
 		want       bool
 	}{
 		{"success", "completed", ptr("success"), true},
@@ -51,13 +54,17 @@ func TestWorkflowRunIsSuccess(t *testing.T) {
 func TestWorkflowRunIsFailed(t *testing.T) {
 	tests := []struct {
 		name       string
-		status     string
-		conclusion *string
+		status     RunStatus
+		conclusion *Conclusion
 		want       bool
 	}{
 		{"failure", "completed", ptr("failure"), true},
 		{"cancelled", "completed", ptr("cancelled"), true},
 		{"timed_out", "completed", ptr("timed_out"), true},
+		{"startup_failure", "completed", ptr("startup_failure"), true},
+		{"stale", "completed", ptr("stale"), true},
+		{"neutral", "completed", ptr("neutral"), false},
+		{"action_required", "completed", ptr("action_required"), false},
 		{"success", "completed", ptr("success"), false},
 		{"skipped", "completed", ptr("skipped"), false},
 		{"nil_conclusion", "completed", nil, false},
@@ -73,13 +80,45 @@ func TestWorkflowRunIsFailed(t *testing.T) {
 	}
 }
 
+func TestWorkflowRunNeedsAttention(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     RunStatus
+		conclusion *Conclusion
+		want       bool
+	}{
+		{"action_required", "completed", ptr("action_required"), true},
+		{"waiting", "waiting", nil, true},
+		{"failure", "completed", ptr("failure"), false},
+		{"queued", "queued", nil, false},
+		{"in_progress", "in_progress", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &WorkflowRun{Status: tt.status, Conclusion: tt.conclusion}
+			if got := r.NeedsAttention(); got != tt.want {
+				t.Errorf("NeedsAttention() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkflowRunStatusText(t *testing.T) {
+	if got := (&WorkflowRun{Status: "completed", Conclusion: ptr("stale")}).StatusText(); got != "stale" {
+		t.Errorf("StatusText() = %q, want stale", got)
+	}
+	if got := (&WorkflowRun{Status: "waiting"}).StatusText(); got != "waiting" {
+		t.Errorf("StatusText() = %q, want waiting", got)
+	}
+}
+
 func TestWorkflowRunDuration(t *testing.T) {
 	now := time.Now()
 	tests := []struct {
 		name         string
 		runStartedAt *time.Time
 		updatedAt    time.Time
-		status       string
+		status       RunStatus
 		wantZero     bool
 	}{
 		{"nil_start", nil, now, "completed", true},
@@ -104,3 +143,61 @@ func TestWorkflowRunDuration(t *testing.T) {
 }
 
 func timePtr(t time.Time) *time.Time { return &t }
+
+const testHostsConfig = `
+[hosts."github.com"]
+token = "public"
+
+[hosts."ghe.example.com"]
+token = "enterprise"
+api_url = "https://ghe-api.example.com/v3"
+`
+
+func TestLookupHost(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.WriteFile(filepath.Join(dir, "github-actions"), []byte(testHostsConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h, ok, err := LookupHost(context.Background(), "ghe.example.com")
+	if err != nil || !ok {
+		t.Fatalf("LookupHost() = %v, %v, want the ghe.example.com entry", ok, err)
+	}
+	if h.APIURL != "https://ghe-api.example.com/v3" {
+		t.Errorf("APIURL = %q", h.APIURL)
+	}
+	if _, ok, _ := LookupHost(context.Background(), "other.example.com"); ok {
+		t.Errorf("LookupHost(other.example.com) = ok, want no entry")
+	}
+}
+
+func TestGetTokenIgnoresPort(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("GH_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "")
+	if err := os.WriteFile(filepath.Join(dir, "github-actions"), []byte(testHostsConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := GetToken(context.Background(), "ghe.example.com:8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "enterprise" {
+		t.Errorf("GetToken(ghe.example.com:8443) = %q, want enterprise", token)
+	}
+}
+
+func TestAPIURL(t *testing.T) {
+	tests := map[string]string{
+		"":                     "https://api.github.com",
+		"github.com":           "https://api.github.com",
+		"ghe.example.com":      "https://ghe.example.com/api/v3",
+		"ghe.example.com:8443": "https://ghe.example.com:8443/api/v3",
+	}
+	for host, want := range tests {
+		if got := APIURL(host); got != want {
+			t.Errorf("APIURL(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
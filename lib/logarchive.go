@@ -0,0 +1,195 @@
+package lib
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxRunLogsSize caps how much UnpackRunLogs extracts from one archive, so a
+// corrupt archive can't fill the disk.
+const maxRunLogsSize = 4 << 30
+
+// UnpackRunLogs extracts a run log archive from DownloadRunLogs into dir and
+// returns the files it wrote, relative to dir, with forward slashes.
+//
+// The archive holds the full log of each job at the top level, as
+// "<index>_<job name>.txt", and a directory for each job with a log for each
+// step, as "<job name>/<number>_<step name>.txt". GitHub's step file numbers
+// don't always match the step numbers the API reports, so step files are
+// renamed to use the Number of the matching step in jobs, when one is found
+// and the new name isn't taken by another entry.
+//
+// Entries that would be written outside dir are an error; anything but a
+// regular file, like a symlink, is skipped.
+func UnpackRunLogs(archive []byte, dir string, jobs []Job) ([]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("reading log archive: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	// Opening everything through root means a symlink already in dir can't
+	// send a write elsewhere either.
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	// Check every name first, so a step log isn't renamed over another
+	// entry that hasn't been extracted yet.
+	originals := make(map[string]bool, len(zr.File))
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		name := strings.ReplaceAll(f.Name, `\`, "/")
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return nil, fmt.Errorf("refusing to extract %q from the log archive: it is outside the directory", f.Name)
+		}
+		originals[name] = true
+	}
+
+	var written []string
+	used := make(map[string]bool, len(originals))
+	var total int64
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		name := strings.ReplaceAll(f.Name, `\`, "/")
+		// Steps with the same truncated name can match the same step;
+		// keep the archive's name rather than overwrite another log.
+		if renamed := renumberStepLog(name, jobs); !originals[renamed] && !used[renamed] {
+			name = renamed
+		}
+		if used[name] {
+			return written, fmt.Errorf("the log archive has two entries named %q", name)
+		}
+		used[name] = true
+		n, err := extractFile(root, f, name, maxRunLogsSize-total)
+		total += n
+		if err != nil {
+			return written, fmt.Errorf("extracting %q: %w", f.Name, err)
+		}
+		written = append(written, name)
+	}
+	return written, nil
+}
+
+func extractFile(root *os.Root, f *zip.File, name string, limit int64) (int64, error) {
+	if d := path.Dir(name); d != "." {
+		if err := root.MkdirAll(filepath.FromSlash(d), 0o755); err != nil {
+			return 0, err
+		}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	out, err := root.OpenFile(filepath.FromSlash(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, io.LimitReader(rc, limit+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > limit {
+		err = fmt.Errorf("the log archive is larger than %d bytes", int64(maxRunLogsSize))
+	}
+	return n, err
+}
+
+// renumberStepLog rewrites a step log's name, "<job>/<number>_<step>.txt",
+// so the number is that of the matching step in jobs. Other names are
+// returned unchanged.
+func renumberStepLog(name string, jobs []Job) string {
+	jobDir, file, ok := strings.Cut(name, "/")
+	if !ok || strings.Contains(file, "/") {
+		return name
+	}
+	prefix, stepName, ok := strings.Cut(file, "_")
+	if !ok {
+		return name
+	}
+	number, err := strconv.Atoi(prefix)
+	if err != nil {
+		return name
+	}
+	job := matchLogJob(jobDir, jobs)
+	if job == nil {
+		return name
+	}
+	step := matchLogStep(number, strings.TrimSuffix(stepName, ".txt"), job.Steps)
+	if step == nil || step.Number == number {
+		return name
+	}
+	return jobDir + "/" + strconv.Itoa(step.Number) + "_" + stepName
+}
+
+// logNameKey reduces a job or step name to its lowercase letters and digits.
+// GitHub replaces characters like "/" and ":" in archive file names and
+// truncates long ones, so names are compared by key, allowing the archive's
+// to be a prefix.
+func logNameKey(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func logNameMatches(archived, name string) bool {
+	a, n := logNameKey(archived), logNameKey(name)
+	return a != "" && strings.HasPrefix(n, a)
+}
+
+func matchLogJob(dir string, jobs []Job) *Job {
+	for i := range jobs {
+		if logNameKey(jobs[i].Name) == logNameKey(dir) {
+			return &jobs[i]
+		}
+	}
+	for i := range jobs {
+		if logNameMatches(dir, jobs[i].Name) {
+			return &jobs[i]
+		}
+	}
+	return nil
+}
+
+// matchLogStep returns the step an archived step log belongs to: the step
+// with that number, if its name matches, or else the step with a matching
+// name whose number is closest.
+func matchLogStep(number int, name string, steps []Step) *Step {
+	var best *Step
+	for i := range steps {
+		if !logNameMatches(name, steps[i].Name) {
+			continue
+		}
+		if best == nil || abs(steps[i].Number-number) < abs(best.Number-number) {
+			best = &steps[i]
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
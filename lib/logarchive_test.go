@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type archiveEntry struct {
+	name, body string
+	symlink    bool
+}
+
+func makeArchive(t *testing.T, entries ...archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.symlink {
+			hdr.SetMode(os.ModeSymlink | 0o777)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUnpackRunLogs(t *testing.T) {
+	jobs := []Job{{
+		Name: "test (ubuntu-latest, 1.22)",
+		Steps: []Step{
+			{Name: "Set up job", Number: 1},
+			{Name: "Run actions/checkout@v4", Number: 2},
+			{Name: "Run go test ./...", Number: 4},
+			{Name: "Complete job", Number: 7},
+		},
+	}}
+	archive := makeArchive(t,
+		archiveEntry{name: "0_test (ubuntu-latest, 1.22).txt", body: "full log\n"},
+		archiveEntry{name: "test (ubuntu-latest, 1.22)/1_Set up job.txt", body: "setup\n"},
+		archiveEntry{name: "test (ubuntu-latest, 1.22)/2_Run actions_checkout@v4.txt", body: "checkout\n"},
+		// GitHub's numbering skipped a step the API counts.
+		archiveEntry{name: "test (ubuntu-latest, 1.22)/3_Run go test ....txt", body: "FAIL\n"},
+		archiveEntry{name: "test (ubuntu-latest, 1.22)/6_Complete job.txt", body: "done\n"},
+		archiveEntry{name: "test (ubuntu-latest, 1.22)/link", symlink: true, body: "/etc/passwd"},
+	)
+	dir := t.TempDir()
+	got, err := UnpackRunLogs(archive, dir, jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"0_test (ubuntu-latest, 1.22).txt",
+		"test (ubuntu-latest, 1.22)/1_Set up job.txt",
+		"test (ubuntu-latest, 1.22)/2_Run actions_checkout@v4.txt",
+		"test (ubuntu-latest, 1.22)/4_Run go test ....txt",
+		"test (ubuntu-latest, 1.22)/7_Complete job.txt",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("UnpackRunLogs() wrote\n%q\nwant\n%q", got, want)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "test (ubuntu-latest, 1.22)", "4_Run go test ....txt"))
+	if err != nil || string(data) != "FAIL\n" {
+		t.Errorf("step 4 log = %q, %v", data, err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "test (ubuntu-latest, 1.22)", "link")); !os.IsNotExist(err) {
+		t.Errorf("symlink entry was extracted: %v", err)
+	}
+}
+
+func TestUnpackRunLogsSameTruncatedName(t *testing.T) {
+	// Both archive names truncate to "Run go test ...", and match both
+	// steps; the numbers are off by one, so both logs map to step 4.
+	jobs := []Job{{
+		Name: "test",
+		Steps: []Step{
+			{Name: "Set up job", Number: 1},
+			{Name: "Run go test ./internal/aaaaaaaaaaaaaaaaaaaa", Number: 4},
+			{Name: "Run go test ./internal/bbbbbbbbbbbbbbbbbbbb", Number: 5},
+		},
+	}}
+	archive := makeArchive(t,
+		archiveEntry{name: "test/3_Run go test ....txt", body: "aaa\n"},
+		archiveEntry{name: "test/4_Run go test ....txt", body: "bbb\n"},
+	)
+	dir := t.TempDir()
+	got, err := UnpackRunLogs(archive, dir, jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] == got[1] {
+		t.Fatalf("UnpackRunLogs() wrote %q, want two different files", got)
+	}
+	for i, body := range []string{"aaa\n", "bbb\n"} {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(got[i])))
+		if err != nil || string(data) != body {
+			t.Errorf("%s = %q, %v, want %q", got[i], data, err, body)
+		}
+	}
+
+	archive = makeArchive(t,
+		archiveEntry{name: "test/1_Set up job.txt", body: "one\n"},
+		archiveEntry{name: "test/1_Set up job.txt", body: "two\n"},
+	)
+	if _, err := UnpackRunLogs(archive, t.TempDir(), jobs); err == nil || !strings.Contains(err.Error(), "two entries") {
+		t.Errorf("UnpackRunLogs(duplicate entries) = %v, want an error", err)
+	}
+}
+
+func TestUnpackRunLogsRejectsEscapes(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "job/../../evil.txt", "/tmp/evil.txt", `..\evil.txt`} {
+		t.Run(name, func(t *testing.T) {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "logs")
+			archive := makeArchive(t, archiveEntry{name: name, body: "pwned"})
+			_, err := UnpackRunLogs(archive, dir, nil)
+			if err == nil || !strings.Contains(err.Error(), "refusing to extract") {
+				t.Errorf("UnpackRunLogs(%q) = %v, want an error", name, err)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "evil.txt")); !os.IsNotExist(err) {
+				t.Errorf("%q was written outside the directory", name)
+			}
+		})
+	}
+}
+
+func TestUnpackRunLogsThroughSymlink(t *testing.T) {
+	// A symlink left in the directory by an earlier extraction, or anyone
+	// else, mustn't redirect a write.
+	outside := t.TempDir()
+	dir := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "job")); err != nil {
+		t.Skip(err)
+	}
+	archive := makeArchive(t, archiveEntry{name: "job/1_Set up job.txt", body: "setup"})
+	if _, err := UnpackRunLogs(archive, dir, nil); err == nil {
+		t.Error("UnpackRunLogs() followed a symlink out of the directory")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "1_Set up job.txt")); !os.IsNotExist(err) {
+		t.Error("wrote through the symlink")
+	}
+}
+
+func TestUnpackRunLogsNotZip(t *testing.T) {
+	if _, err := UnpackRunLogs([]byte("<Error>AuthenticationFailed</Error>"), t.TempDir(), nil); err == nil {
+		t.Error("UnpackRunLogs() of a non-zip = nil, want an error")
+	}
+}
@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func (r *RepoService) logCachePath(jobID int64) (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "logs", r.client.host, r.owner, r.repo, strconv.FormatInt(jobID, 10)+".log"), nil
+}
+
+// CachedJobLogs returns the logs for a job, like GetJobLogs, keeping a copy
+// in the cache directory once the job has completed. The log of a completed
+// job never changes, so later calls for it don't touch the network. Logs of
+// jobs that are still running are never cached.
+func (r *RepoService) CachedJobLogs(ctx context.Context, job Job) ([]byte, error) {
+	if job.Status != StatusCompleted {
+		return r.GetJobLogs(ctx, job.ID)
+	}
+	path, err := r.logCachePath(job.ID)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		// Mark the log as used, so PruneLogCache keeps it.
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return data, nil
+	}
+	data, err := r.GetJobLogs(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Failing to cache the log shouldn't fail the caller, who has it.
+	writeFileAtomic(path, data)
+	return data, nil
+}
+
+// PruneLogCache removes cached job logs that haven't been used in maxAge.
+func PruneLogCache(maxAge time.Duration) error {
+	dir, err := CacheDir()
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	err = filepath.WalkDir(filepath.Join(dir, "logs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().Before(cutoff) {
+			os.Remove(path)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCachedJobLogs(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	downloads := map[string]int{}
+	c, done := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads[r.URL.Path]++
+		io.WriteString(w, "log for "+r.URL.Path+"\n")
+	}))
+	defer done()
+	repo := c.Repo("o", "r")
+	ctx := context.Background()
+
+	finished := Job{ID: 7, Status: StatusCompleted}
+	running := Job{ID: 8, Status: StatusInProgress}
+	for i := 0; i < 2; i++ {
+		for _, job := range []Job{finished, running} {
+			if _, err := repo.CachedJobLogs(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if n := downloads["/repos/o/r/actions/jobs/7/logs"]; n != 1 {
+		t.Errorf("downloaded the finished job's log %d times, want 1", n)
+	}
+	if n := downloads["/repos/o/r/actions/jobs/8/logs"]; n != 2 {
+		t.Errorf("downloaded the running job's log %d times, want 2", n)
+	}
+	path := filepath.Join(cache, "github-actions", "logs", "github.com", "o", "r", "7.log")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "log for /repos/o/r/actions/jobs/7/logs\n" {
+		t.Errorf("cached log = %q", data)
+	}
+
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := PruneLogCache(30 * 24 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("PruneLogCache kept a stale log: %v", err)
+	}
+}
+
+func TestPruneLogCacheMissingDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	if err := PruneLogCache(time.Hour); err != nil {
+		t.Errorf("PruneLogCache() = %v, want nil before anything is cached", err)
+	}
+}
@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// LogOptions controls how NormalizeLog rewrites raw job log output.
+type LogOptions struct {
+	// Color re-colours ##[error] and ##[warning] lines and keeps any ANSI
+	// escapes already present in the log. When false, all ANSI escapes are
+	// stripped.
+	Color bool
+}
+
+var (
+	// GitHub prefixes every log line with an RFC3339 timestamp with 7
+	// digits of fractional seconds, e.g. "2024-05-01T17:03:22.1234567Z ".
+	logTimestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?Z ?`)
+	ansiEscape   = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+)
+
+var (
+	groupMarker    = []byte("##[group]")
+	endGroupMarker = []byte("##[endgroup]")
+	debugMarker    = []byte("##[debug]")
+	errorMarker    = []byte("##[error]")
+	warningMarker  = []byte("##[warning]")
+	noticeMarker   = []byte("##[notice]")
+	utf8BOM        = []byte("\ufeff")
+)
+
+// NormalizeLog cleans up a job log downloaded from GitHub for display in a
+// terminal. It strips the per-line timestamps, drops ##[debug] lines, and
+// collapses each ##[group] into a single header line - the group body is
+// mostly the echoed script and environment, which GitHub also hides by
+// default. ##[error] and ##[warning] lines inside a group are kept.
+//
+// Gap markers and other lines that don't come from GitHub pass through
+// unchanged, so NormalizeLog can be applied to the output of
+// findBuildFailure.
+func NormalizeLog(log []byte, opts LogOptions) []byte {
+	if len(log) == 0 {
+		return log
+	}
+	log = bytes.TrimPrefix(log, utf8BOM)
+	lines := bytes.SplitAfter(log, []byte("\n"))
+	var buf bytes.Buffer
+	buf.Grow(len(log))
+	inGroup := false
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		hasNewline := line[len(line)-1] == '\n'
+		text := bytes.TrimRight(line, "\r\n")
+		text = logTimestamp.ReplaceAll(text, nil)
+		if !opts.Color {
+			text = ansiEscape.ReplaceAll(text, nil)
+		}
+
+		switch {
+		case bytes.HasPrefix(text, groupMarker):
+			inGroup = true
+			buf.Write(colorize("▸ "+string(text[len(groupMarker):]), "\033[1m", opts.Color))
+		case bytes.HasPrefix(text, endGroupMarker):
+			inGroup = false
+			continue
+		case bytes.HasPrefix(text, debugMarker):
+			continue
+		case bytes.HasPrefix(text, errorMarker):
+			buf.Write(colorize("Error: "+string(text[len(errorMarker):]), "\033[31m", opts.Color))
+		case bytes.HasPrefix(text, warningMarker):
+			buf.Write(colorize("Warning: "+string(text[len(warningMarker):]), "\033[33m", opts.Color))
+		case bytes.HasPrefix(text, noticeMarker):
+			buf.WriteString("Notice: ")
+			buf.Write(text[len(noticeMarker):])
+		case inGroup:
+			continue
+		default:
+			buf.Write(text)
+		}
+		if hasNewline {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+func colorize(s, color string, enabled bool) []byte {
+	if !enabled {
+		return []byte(s)
+	}
+	return []byte(color + s + "\033[0m")
+}
+
+// LogLines splits a raw job log into lines, with the timestamps, ANSI
+// escapes and trailing carriage returns removed. Unlike NormalizeLog it keeps
+// every line, so line i of the result is line i+1 of the log as GitHub
+// numbers it.
+func LogLines(log []byte) []string {
+	log = bytes.TrimPrefix(log, utf8BOM)
+	log = bytes.TrimSuffix(log, []byte("\n"))
+	if len(log) == 0 {
+		return nil
+	}
+	raw := bytes.Split(log, []byte("\n"))
+	lines := make([]string, len(raw))
+	for i, line := range raw {
+		line = bytes.TrimRight(line, "\r")
+		line = logTimestamp.ReplaceAll(line, nil)
+		lines[i] = string(ansiEscape.ReplaceAll(line, nil))
+	}
+	return lines
+}
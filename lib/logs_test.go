@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeLog(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		want string
+	}{
+		{"empty", "", ""},
+		{
+			name: "strips timestamps",
+			log:  "2024-05-01T17:03:22.1234567Z hello\n2024-05-01T17:03:23.0000000Z world\n",
+			want: "hello\nworld\n",
+		},
+		{
+			name: "strips byte order mark",
+			log:  "\ufeff2024-05-01T17:03:22.1234567Z hello\n",
+			want: "hello\n",
+		},
+		{
+			name: "collapses groups",
+			log: "2024-05-01T17:03:22.1234567Z ##[group]Run go test ./...\n" +
+				"2024-05-01T17:03:22.1234567Z go test ./...\n" +
+				"2024-05-01T17:03:22.1234567Z shell: /usr/bin/bash -e {0}\n" +
+				"2024-05-01T17:03:22.1234567Z ##[endgroup]\n" +
+				"2024-05-01T17:03:23.1234567Z --- FAIL: TestFoo\n",
+			want: "▸ Run go test ./...\n--- FAIL: TestFoo\n",
+		},
+		{
+			name: "keeps errors inside groups",
+			log:  "##[group]Setup\nnoise\n##[error]bad thing\n##[endgroup]\n",
+			want: "▸ Setup\nError: bad thing\n",
+		},
+		{
+			name: "drops debug lines",
+			log:  "##[debug]Evaluating condition\nkeep me\n",
+			want: "keep me\n",
+		},
+		{
+			name: "labels warnings",
+			log:  "##[warning]deprecated\n",
+			want: "Warning: deprecated\n",
+		},
+		{
+			name: "strips ansi",
+			log:  "\x1b[31mFAIL\x1b[0m pkg\n",
+			want: "FAIL pkg\n",
+		},
+		{
+			name: "passes gap markers through",
+			log:  "\n... (omitting lines 1..4, use --failed-output-lines to show more output) ...\n\nline5\n",
+			want: "\n... (omitting lines 1..4, use --failed-output-lines to show more output) ...\n\nline5\n",
+		},
+		{
+			name: "no trailing newline",
+			log:  "2024-05-01T17:03:22Z last",
+			want: "last",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(NormalizeLog([]byte(tt.log), LogOptions{}))
+			if got != tt.want {
+				t.Errorf("NormalizeLog(%q) = %q, want %q", tt.log, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeLogColor(t *testing.T) {
+	log := "\x1b[32mok\x1b[0m\n##[error]boom\n"
+	got := string(NormalizeLog([]byte(log), LogOptions{Color: true}))
+	if !strings.Contains(got, "\x1b[32mok\x1b[0m\n") {
+		t.Errorf("NormalizeLog with color should keep existing escapes\ngot: %q", got)
+	}
+	if !strings.Contains(got, "\x1b[31mError: boom\x1b[0m\n") {
+		t.Errorf("NormalizeLog with color should color error lines\ngot: %q", got)
+	}
+}
+
+func TestLogLines(t *testing.T) {
+	log := "\ufeff2024-05-01T17:03:22.1234567Z ##[group]Run go test\r\n2024-05-01T17:03:23.0000000Z \x1b[31mFAIL\x1b[0m pkg\n2024-05-01T17:03:24Z \n"
+	got := LogLines([]byte(log))
+	want := []string{"##[group]Run go test", "FAIL pkg", ""}
+	if !slices.Equal(got, want) {
+		t.Errorf("LogLines() = %q, want %q", got, want)
+	}
+	if got := LogLines(nil); got != nil {
+		t.Errorf("LogLines(nil) = %q, want nil", got)
+	}
+}
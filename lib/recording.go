@@ -0,0 +1,477 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// RecordingFile is the file in a recording directory that holds the
+// requests and responses, one JSON object per line.
+const RecordingFile = "exchanges.jsonl"
+
+// ReplaySpeedup is how many times faster than recorded a replayed response
+// arrives.
+const ReplaySpeedup = 10
+
+const redacted = "REDACTED"
+
+// Exchange is a recorded request and its response, or the error the request
+// failed with.
+type Exchange struct {
+	Seq int `json:"seq"`
+	// Time is when the request was sent.
+	Time time.Time `json:"time"`
+	// Latency is how long the response took.
+	Latency time.Duration `json:"latency"`
+
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	RequestHeader http.Header `json:"request_header,omitempty"`
+	RequestBody   string      `json:"request_body,omitempty"`
+
+	StatusCode int         `json:"status_code,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	// Body holds a UTF-8 response body, and BodyBytes any other, like a
+	// log archive.
+	Body      string `json:"body,omitempty"`
+	BodyBytes []byte `json:"body_bytes,omitempty"`
+
+	Error string `json:"error,omitempty"`
+	// Retryable is set if Error was a transient network error, so replaying
+	// it exercises the same retry path.
+	Retryable bool `json:"retryable,omitempty"`
+}
+
+// sensitiveHeaders are replaced with REDACTED in a recording.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// sensitiveParams are the query parameters of pre-signed download URLs that
+// grant access, matched case-insensitively.
+var sensitiveParams = []string{"sig", "signature", "token", "access_token", "x-amz-signature", "x-amz-credential", "x-amz-security-token"}
+
+// redactURL replaces the values of sensitiveParams in rawURL. It is applied
+// to URLs when recording and when replaying, so a redacted redirect URL
+// still matches the request that follows it.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	q := u.Query()
+	changed := false
+	for name := range q {
+		for _, p := range sensitiveParams {
+			if strings.EqualFold(name, p) {
+				q.Set(name, redacted)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return rawURL
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Recorder saves requests and their responses to a recording directory. One
+// Recorder can be shared by every client in a process, so they all append to
+// the same recording; see Client.RecordTo.
+type Recorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	seq int
+	// secrets are token values seen in Authorization headers, scrubbed
+	// from everything that is recorded.
+	secrets []string
+}
+
+// NewRecorder starts a recording in dir, replacing any recording already
+// there.
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, RecordingFile), os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{f: f}, nil
+}
+
+// Close closes the recording file.
+func (r *Recorder) Close() error {
+	return r.f.Close()
+}
+
+// addSecret remembers the credential in an Authorization header value like
+// "Bearer <token>".
+func (r *Recorder) addSecret(auth string) {
+	_, secret, ok := strings.Cut(auth, " ")
+	if !ok {
+		secret = auth
+	}
+	if secret = strings.TrimSpace(secret); secret == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.secrets {
+		if s == secret {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, secret)
+}
+
+func (r *Recorder) scrub(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+func (r *Recorder) scrubHeader(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	h = h.Clone()
+	for _, name := range sensitiveHeaders {
+		if _, ok := h[name]; ok {
+			h.Set(name, redacted)
+		}
+	}
+	if loc := h.Get("Location"); loc != "" {
+		h.Set("Location", redactURL(loc))
+	}
+	for name, values := range h {
+		for i := range values {
+			values[i] = r.scrub(values[i])
+		}
+		h[name] = values
+	}
+	return h
+}
+
+// write appends ex to the recording, numbering it.
+func (r *Recorder) write(ex *Exchange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	ex.Seq = r.seq
+	data, err := json.Marshal(ex)
+	if err != nil {
+		return err
+	}
+	_, err = r.f.Write(append(data, '\n'))
+	return err
+}
+
+// recordingTransport passes requests to base, and saves them and their
+// responses with rec.
+type recordingTransport struct {
+	base http.RoundTripper
+	rec  *Recorder
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		t.rec.addSecret(auth)
+	}
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	var body []byte
+	if err == nil {
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	ex := Exchange{
+		Time:          start,
+		Latency:       time.Since(start),
+		Method:        req.Method,
+		URL:           t.rec.scrub(redactURL(req.URL.String())),
+		RequestHeader: t.rec.scrubHeader(req.Header),
+		RequestBody:   t.rec.scrub(string(reqBody)),
+	}
+	if err != nil {
+		ex.Error = t.rec.scrub(err.Error())
+		ex.Retryable = IsRetryableError(err)
+	} else {
+		ex.StatusCode = resp.StatusCode
+		ex.Header = t.rec.scrubHeader(resp.Header)
+		switch {
+		case resp.StatusCode >= 300 && resp.StatusCode < 400:
+			// The body of a redirect repeats the Location URL, with
+			// its signature, and nothing reads it.
+		case utf8.Valid(body):
+			ex.Body = t.rec.scrub(string(body))
+		default:
+			ex.BodyBytes = body
+		}
+	}
+	if werr := t.rec.write(&ex); werr != nil {
+		return nil, fmt.Errorf("recording %s %s: %w", req.Method, ex.URL, werr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Replayer answers requests from a recording. Each request gets the next
+// unused exchange with the same method and URL, so requests made
+// concurrently don't have to arrive in exactly the recorded order. Like a
+// Recorder, one Replayer can be shared by every client in a process.
+//
+// A Replayer is also a clock: Now, After and WithTimeout keep the recording's
+// time, so code that sleeps between requests runs ReplaySpeedup times faster
+// too, and sees the same times it saw when recording.
+type Replayer struct {
+	mu        sync.Mutex
+	exchanges map[string][]*Exchange // "METHOD URL" -> exchanges, in recorded order
+	now       time.Time
+	timers    []*replayTimer
+}
+
+// replayTimer calls fire once the replay's clock reaches at.
+type replayTimer struct {
+	at   time.Time
+	fire func()
+}
+
+func replayKey(method, rawURL string) string {
+	return method + " " + redactURL(rawURL)
+}
+
+// ReadRecording reads the exchanges recorded in dir.
+func ReadRecording(dir string) ([]Exchange, error) {
+	f, err := os.Open(filepath.Join(dir, RecordingFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var exchanges []Exchange
+	scanner := bufio.NewScanner(f)
+	// Response bodies, like job logs, can be large.
+	scanner.Buffer(make([]byte, 64*1024), 256*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var ex Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &ex); err != nil {
+			return nil, fmt.Errorf("reading %s: exchange %d: %w", RecordingFile, len(exchanges)+1, err)
+		}
+		exchanges = append(exchanges, ex)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return exchanges, nil
+}
+
+// NewReplayer loads the recording in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	exchanges, err := ReadRecording(dir)
+	if err != nil {
+		return nil, err
+	}
+	t := &Replayer{exchanges: make(map[string][]*Exchange)}
+	for i := range exchanges {
+		ex := &exchanges[i]
+		key := replayKey(ex.Method, ex.URL)
+		t.exchanges[key] = append(t.exchanges[key], ex)
+		if !ex.Time.IsZero() && (t.now.IsZero() || ex.Time.Before(t.now)) {
+			t.now = ex.Time
+		}
+	}
+	if t.now.IsZero() {
+		// A recording made before exchanges had times.
+		t.now = time.Now()
+	}
+	return t, nil
+}
+
+// Now returns the time on the replay's clock. It starts when the first
+// recorded request was sent, and moves forward as responses arrive and as
+// After timers fire.
+func (t *Replayer) Now() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.now
+}
+
+// After is time.After on the replay's clock: when the channel fires, the
+// clock has moved forward by at least d, but only d/ReplaySpeedup has really
+// passed.
+func (t *Replayer) After(d time.Duration) <-chan time.Time {
+	at := t.Now().Add(d)
+	ch := make(chan time.Time, 1)
+	time.AfterFunc(d/ReplaySpeedup, func() {
+		t.advance(at)
+		ch <- t.Now()
+	})
+	return ch
+}
+
+// WithTimeout is context.WithTimeout on the replay's clock. The context's
+// Err is context.DeadlineExceeded once the clock passes the deadline.
+func (t *Replayer) WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	timer := &replayTimer{fire: func() { cancel(context.DeadlineExceeded) }}
+	t.mu.Lock()
+	timer.at = t.now.Add(d)
+	if d <= 0 {
+		timer.fire()
+	} else {
+		t.timers = append(t.timers, timer)
+	}
+	t.mu.Unlock()
+	return replayTimeoutContext{ctx}, func() {
+		t.mu.Lock()
+		for i, other := range t.timers {
+			if other == timer {
+				t.timers = append(t.timers[:i], t.timers[i+1:]...)
+				break
+			}
+		}
+		t.mu.Unlock()
+		cancel(context.Canceled)
+	}
+}
+
+// replayTimeoutContext reports a replayed deadline as
+// context.DeadlineExceeded, like a real one, instead of context.Canceled.
+type replayTimeoutContext struct {
+	context.Context
+}
+
+func (c replayTimeoutContext) Err() error {
+	if err := c.Context.Err(); err != nil && errors.Is(context.Cause(c.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
+
+// advance moves the replay's clock forward to at, firing any timers that
+// are due. It never moves the clock back.
+func (t *Replayer) advance(at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !at.After(t.now) {
+		return
+	}
+	t.now = at
+	remaining := t.timers[:0]
+	for _, timer := range t.timers {
+		if timer.at.After(t.now) {
+			remaining = append(remaining, timer)
+			continue
+		}
+		timer.fire()
+	}
+	t.timers = remaining
+}
+
+func (t *Replayer) next(req *http.Request) *Exchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := replayKey(req.Method, req.URL.String())
+	queue := t.exchanges[key]
+	if len(queue) == 0 {
+		return nil
+	}
+	t.exchanges[key] = queue[1:]
+	return queue[0]
+}
+
+// RoundTrip answers req with the next recorded response for it.
+func (t *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	ex := t.next(req)
+	if ex == nil {
+		return nil, fmt.Errorf("no recorded response left for %s %s", req.Method, redactURL(req.URL.String()))
+	}
+	select {
+	case <-time.After(ex.Latency / ReplaySpeedup):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	if !ex.Time.IsZero() {
+		t.advance(ex.Time.Add(ex.Latency))
+	}
+	if ex.Error != "" {
+		if ex.Retryable {
+			return nil, &net.OpError{Op: "replay", Net: "tcp", Err: errors.New(ex.Error)}
+		}
+		return nil, errors.New(ex.Error)
+	}
+	body := ex.BodyBytes
+	if ex.Body != "" {
+		body = []byte(ex.Body)
+	}
+	header := ex.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", ex.StatusCode, http.StatusText(ex.StatusCode)),
+		StatusCode:    ex.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// RecordTo saves every request the client makes, including log downloads,
+// and its response, with rec, for a Replayer to play back. Tokens and the
+// signatures of pre-signed URLs are replaced with REDACTED. Call it after
+// ConfigureHost.
+func (c *Client) RecordTo(rec *Recorder) {
+	c.transport.RoundTripper = &recordingTransport{base: c.transport.RoundTripper, rec: rec}
+}
+
+// ReplayFrom answers the client's requests from rep, a recording made with
+// RecordTo, instead of the network. Responses arrive ReplaySpeedup times
+// faster than they were recorded. The client's own sleeps between requests
+// are only sped up if they use rep as their clock. A request with no
+// recorded response left fails. Call it after ConfigureHost.
+func (c *Client) ReplayFrom(rep *Replayer) {
+	c.transport.RoundTripper = rep
+}
@@ -0,0 +1,276 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedactURL(t *testing.T) {
+	got := redactURL("https://blob.example/logs/1.txt?sv=2021&sig=abc%2Fdef&X-Amz-Signature=123")
+	if strings.Contains(got, "abc") || strings.Contains(got, "123") || !strings.Contains(got, "sv=2021") {
+		t.Errorf("redactURL() = %q", got)
+	}
+	if got := redactURL(got); got != redactURL(got) {
+		t.Errorf("redactURL() isn't stable: %q", got)
+	}
+	if u := "https://api.github.com/repos/o/r/actions/runs?head_sha=abc"; redactURL(u) != u {
+		t.Errorf("redactURL(%q) = %q, want it unchanged", u, redactURL(u))
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	const token = "ghp_secret123"
+	polls := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/o/r/actions/runs/42":
+			polls++
+			status := "in_progress"
+			if polls > 1 {
+				status = "completed"
+			}
+			w.Write([]byte(`{"id": 42, "status": "` + status + `", "name": "echo ` + token + `"}`))
+		case "/repos/o/r/actions/jobs/7/logs":
+			http.Redirect(w, r, srv.URL+"/download/7?sig=signed", http.StatusFound)
+		case "/download/7":
+			w.Write([]byte("2024-05-01T17:03:22.1234567Z hello\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not Found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c := NewClient(token, "github.com")
+	c.Client.Base = srv.URL
+	rec, err := NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+	c.RecordTo(rec)
+	ctx := context.Background()
+	repo := c.Repo("o", "r")
+	for _, want := range []RunStatus{"in_progress", "completed"} {
+		run, err := repo.GetWorkflowRun(ctx, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Status != want {
+			t.Errorf("recording: status = %q, want %q", run.Status, want)
+		}
+	}
+	if _, err := repo.GetJobLogs(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, RecordingFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), token) || strings.Contains(string(data), "signed") {
+		t.Errorf("recording contains a secret:\n%s", data)
+	}
+	exchanges, err := ReadRecording(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 4 {
+		t.Fatalf("recorded %d exchanges, want 4", len(exchanges))
+	}
+	if got := exchanges[0].RequestHeader.Get("Authorization"); got != redacted {
+		t.Errorf("Authorization = %q, want it redacted", got)
+	}
+	if exchanges[0].Time.IsZero() {
+		t.Error("exchange has no time")
+	}
+
+	// The server is gone; the replay must not need it.
+	srv.Close()
+	r := NewClient("", "github.com")
+	r.Client.Base = srv.URL
+	rep, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ReplayFrom(rep)
+	repo = r.Repo("o", "r")
+	for _, want := range []RunStatus{"in_progress", "completed"} {
+		run, err := repo.GetWorkflowRun(ctx, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Status != want {
+			t.Errorf("replay: status = %q, want %q", run.Status, want)
+		}
+	}
+	logs, err := repo.GetJobLogs(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(logs), "hello") {
+		t.Errorf("replayed logs = %q", logs)
+	}
+	_, err = repo.GetWorkflowRun(ctx, 42)
+	if err == nil || !strings.Contains(err.Error(), "no recorded response left") {
+		t.Errorf("GetWorkflowRun() = %v, want an error once the recording runs out", err)
+	}
+}
+
+type failingTransport struct{ err error }
+
+func (f failingTransport) RoundTrip(*http.Request) (*http.Response, error) { return nil, f.err }
+
+func TestReplayRetryableError(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+	rt := &recordingTransport{base: failingTransport{err: io.ErrUnexpectedEOF}, rec: rec}
+	req, _ := http.NewRequest("GET", "https://api.github.com/repos/o/r/actions/runs", nil)
+	if _, err := rt.RoundTrip(req); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("RoundTrip() = %v, want the transport's error", err)
+	}
+
+	rep, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = rep.RoundTrip(req)
+	if !IsRetryableError(err) {
+		t.Errorf("replayed error %v should be retryable", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("replay took %s", time.Since(start))
+	}
+}
+
+func TestReplayClock(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC)
+	var lines []byte
+	for i, ex := range []Exchange{
+		{Seq: 1, Time: start, Latency: time.Millisecond, Method: "GET", URL: "https://api.github.com/repos/o/r/actions/runs", StatusCode: 200, Body: "{}"},
+		{Seq: 2, Time: start.Add(10 * time.Minute), Latency: time.Millisecond, Method: "GET", URL: "https://api.github.com/repos/o/r/actions/runs", StatusCode: 200, Body: "{}"},
+	} {
+		data, err := json.Marshal(ex)
+		if err != nil {
+			t.Fatalf("exchange %d: %v", i, err)
+		}
+		lines = append(append(lines, data...), '\n')
+	}
+	if err := os.WriteFile(filepath.Join(dir, RecordingFile), lines, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rep.Now(); !got.Equal(start) {
+		t.Fatalf("Now() = %s, want the first request's time %s", got, start)
+	}
+	ctx, cancel := rep.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	realStart := time.Now()
+	<-rep.After(2 * time.Second)
+	if got := rep.Now().Sub(start); got < 2*time.Second {
+		t.Errorf("after After(2s), the clock moved %s, want at least 2s", got)
+	}
+	if real := time.Since(realStart); real >= 2*time.Second {
+		t.Errorf("After(2s) took %s, want it sped up", real)
+	}
+
+	req, _ := http.NewRequest("GET", "https://api.github.com/repos/o/r/actions/runs", nil)
+	for range 2 {
+		resp, err := rep.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if got, want := rep.Now(), start.Add(10*time.Minute+time.Millisecond); !got.Equal(want) {
+		t.Errorf("Now() = %s, want the last response's time %s", got, want)
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("WithTimeout context: Err() = %v, want DeadlineExceeded once the recording passes the deadline", ctx.Err())
+	}
+
+	ctx2, cancel2 := rep.WithTimeout(context.Background(), time.Hour)
+	if ctx2.Err() != nil {
+		t.Fatalf("Err() = %v before the deadline", ctx2.Err())
+	}
+	cancel2()
+	if !errors.Is(ctx2.Err(), context.Canceled) {
+		t.Errorf("Err() = %v after cancel, want Canceled", ctx2.Err())
+	}
+}
+
+func TestRecordSharedByClients(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 42, "status": "completed"}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+	const perClient = 20
+	var wg sync.WaitGroup
+	for _, token := range []string{"token-one", "token-two"} {
+		c := NewClient(token, "github.com")
+		c.Client.Base = srv.URL
+		c.RecordTo(rec)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perClient; i++ {
+				if _, err := c.Repo("o", "r").GetWorkflowRun(context.Background(), 42); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	exchanges, err := ReadRecording(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 2*perClient {
+		t.Fatalf("recorded %d exchanges, want %d", len(exchanges), 2*perClient)
+	}
+	seen := make(map[int]bool)
+	for _, ex := range exchanges {
+		if seen[ex.Seq] {
+			t.Errorf("two exchanges numbered %d", ex.Seq)
+		}
+		seen[ex.Seq] = true
+	}
+	data, err := os.ReadFile(filepath.Join(dir, RecordingFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "token-one") || strings.Contains(string(data), "token-two") {
+		t.Errorf("recording contains a token:\n%s", data)
+	}
+}
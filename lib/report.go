@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// RunReport holds what BuildSummary prints about a workflow run, for callers
+// that want to format it themselves.
+type RunReport struct {
+	Run  WorkflowRun
+	Jobs []Job
+	// JobsErr is set if the run's jobs couldn't be fetched.
+	JobsErr error
+	// Failed holds the details of the failed jobs that were looked at.
+	Failed []FailedJobReport
+}
+
+// FailedJobReport holds the details of a failed job.
+type FailedJobReport struct {
+	Job Job
+	// Annotations are the job's failure-level check run annotations.
+	Annotations    []Annotation
+	AnnotationsErr error
+	// Excerpt is the most relevant part of the job's log, as GitHub
+	// returned it; see NormalizeLog.
+	Excerpt []byte
+	LogsErr error
+}
+
+// RunReportOptions controls what NewRunReport fetches.
+type RunReportOptions struct {
+	// Failures fetches the annotations and a log excerpt of the run's first
+	// failed job, or of every failed job with Client.AllFailedJobs.
+	Failures bool
+	// OutputLines is the number of log lines in each excerpt.
+	OutputLines int
+	// Annotations holds check run annotations already fetched, e.g. with
+	// AnnotationsForCommit, keyed by job ID. The annotations of a failed
+	// job that isn't in it are fetched with the REST API.
+	Annotations map[int64][]Annotation
+}
+
+// NewRunReport fetches the jobs of run and, with opts.Failures, the details
+// of its failed jobs. Errors are recorded in the report.
+func (c *Client) NewRunReport(ctx context.Context, owner, repo string, run WorkflowRun, opts RunReportOptions) *RunReport {
+	rep := &RunReport{Run: run}
+	repoSvc := c.Repo(owner, repo)
+
+	listCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	jobs, err := repoSvc.ListJobs(listCtx, run.ID, url.Values{"per_page": []string{"100"}})
+	if err != nil {
+		rep.JobsErr = err
+		return rep
+	}
+	rep.Jobs = jobs.Jobs
+	if !opts.Failures {
+		return rep
+	}
+	for i := range rep.Jobs {
+		if !rep.Jobs[i].Failed() {
+			continue
+		}
+		rep.Failed = append(rep.Failed, fetchFailedJob(ctx, repoSvc, rep.Jobs[i], opts))
+		if !c.AllFailedJobs {
+			break
+		}
+	}
+	return rep
+}
+
+// fetchFailedJob fetches the failure annotations and log excerpt of job.
+func fetchFailedJob(ctx context.Context, repoSvc *RepoService, job Job, opts RunReportOptions) FailedJobReport {
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	f := FailedJobReport{Job: job}
+	annots, ok := opts.Annotations[job.ID]
+	if !ok {
+		var err error
+		annots, err = repoSvc.ListCheckRunAnnotations(ctx, job.ID)
+		if err != nil {
+			f.AnnotationsErr = err
+		}
+	}
+	for _, a := range annots {
+		if a.AnnotationLevel == "failure" {
+			f.Annotations = append(f.Annotations, a)
+		}
+	}
+	logs, err := repoSvc.GetJobLogs(ctx, job.ID)
+	if err != nil {
+		f.LogsErr = err
+	} else if len(logs) > 0 {
+		f.Excerpt = findBuildFailure(logs, opts.OutputLines)
+	}
+	return f
+}
+
+// JobsTable returns the table of job names and durations that starts the
+// BuildSummary output.
+func (rep *RunReport) JobsTable() []byte {
+	if rep.JobsErr != nil {
+		return fmt.Appendf(nil, "\nError fetching jobs: %v\n", rep.JobsErr)
+	}
+	table, _ := buildJobsSummary(rep.Jobs)
+	return table
+}
+
+// FormatRunReport formats rep the way BuildSummary prints it.
+func (c *Client) FormatRunReport(rep *RunReport) []byte {
+	if rep.JobsErr != nil {
+		return rep.JobsTable()
+	}
+	summary := rep.JobsTable()
+
+	var buf bytes.Buffer
+	buf.WriteByte('\n')
+	if linelen := bytes.IndexByte(summary[1:], '\n'); linelen > 0 {
+		buf.Write(bytes.Repeat([]byte{'='}, linelen))
+		buf.WriteByte('\n')
+	}
+
+	for _, f := range rep.Failed {
+		if len(rep.Failed) > 1 {
+			fmt.Fprintf(&buf, "\n--- Job %q failed ---\n", f.Job.Name)
+		}
+		if url := failedJobURL(&f.Job); url != "" {
+			fmt.Fprintf(&buf, "\nFailed job URL:\n%s\n", url)
+		}
+
+		// Check-run annotations surface run-level failure reasons that
+		// never appear in the job logs (e.g. billing/quota errors that
+		// prevent the job from starting). Print them before the log
+		// output since they're usually the most actionable line.
+		if f.AnnotationsErr != nil {
+			fmt.Fprintf(&buf, "\nError fetching annotations: %v\n", f.AnnotationsErr)
+		}
+		for _, a := range f.Annotations {
+			fmt.Fprintf(&buf, "\nFailure annotation: %s\n", a.Message)
+		}
+
+		switch {
+		case f.LogsErr != nil:
+			fmt.Fprintf(&buf, "\nError fetching job logs: %v\n", f.LogsErr)
+		case len(f.Excerpt) > 0:
+			failure := f.Excerpt
+			if !c.RawLogs {
+				failure = NormalizeLog(failure, LogOptions{Color: useColor()})
+			}
+			fmt.Fprintf(&buf, "\nFailed build output:\n\n")
+			buf.Write(failure)
+		}
+	}
+
+	return append(summary, buf.Bytes()...)
+}
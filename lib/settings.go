@@ -0,0 +1,155 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// RepoConfigFile is the name of the per-repository config file, read from
+// the root of the working tree.
+const RepoConfigFile = ".github-actions.toml"
+
+// WorkflowFilter limits which workflows a command considers. Entries are
+// globs matched against the workflow name and its file name.
+type WorkflowFilter struct {
+	Include []string `toml:"include"`
+	Exclude []string `toml:"exclude"`
+}
+
+// NotifySettings controls how wait announces that it has finished.
+type NotifySettings struct {
+	// Enabled turns the desktop notification and big-text banner on or
+	// off. Unset means on.
+	Enabled *bool `toml:"enabled"`
+	// Bell rings the terminal bell when wait finishes.
+	Bell *bool `toml:"bell"`
+}
+
+// IsEnabled reports whether notifications are on.
+func (n NotifySettings) IsEnabled() bool {
+	return n.Enabled == nil || *n.Enabled
+}
+
+// RingBell reports whether to ring the terminal bell.
+func (n NotifySettings) RingBell() bool {
+	return n.Bell != nil && *n.Bell
+}
+
+// Settings holds defaults read from the user config file or a repository's
+// .github-actions.toml:
+//
+//	[workflows]
+//	exclude = ["nightly*"]
+//
+//	[notify]
+//	bell = true
+//
+//	[wait]
+//	remote = "upstream"
+//	timeout = "2h"
+//	failed-output-lines = 300
+//
+// Every table other than hosts, workflows and notify holds flag defaults
+// for the subcommand of the same name.
+type Settings struct {
+	Workflows WorkflowFilter `toml:"workflows"`
+	Notify    NotifySettings `toml:"notify"`
+	// Commands maps a subcommand name to its flag defaults, keyed by flag
+	// name.
+	Commands map[string]map[string]any `toml:"-"`
+}
+
+// reservedTables are the config tables that don't hold subcommand flag
+// defaults.
+var reservedTables = map[string]bool{
+	"default":   true,
+	"hosts":     true,
+	"workflows": true,
+	"notify":    true,
+}
+
+// LoadSettings reads settings from a TOML file. A missing file returns empty
+// settings.
+func LoadSettings(path string) (*Settings, error) {
+	s := &Settings{Commands: make(map[string]map[string]any)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := toml.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	var raw map[string]any
+	if err := toml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for name, v := range raw {
+		if reservedTables[name] {
+			continue
+		}
+		// Top-level keys that aren't tables were never read by older
+		// versions, so don't start rejecting them now.
+		if table, ok := v.(map[string]any); ok {
+			s.Commands[name] = table
+		}
+	}
+	return s, nil
+}
+
+// UserSettings reads settings from the user config file, the same file
+// GetToken reads tokens from.
+func UserSettings() (*Settings, error) {
+	path, err := getCfgPath()
+	if err != nil {
+		return nil, err
+	}
+	return LoadSettings(path)
+}
+
+// Merge returns a copy of s with the values set in other layered on top.
+func (s *Settings) Merge(other *Settings) *Settings {
+	merged := &Settings{
+		Workflows: s.Workflows,
+		Notify:    s.Notify,
+		Commands:  make(map[string]map[string]any, len(s.Commands)),
+	}
+	for name, flags := range s.Commands {
+		merged.Commands[name] = make(map[string]any, len(flags))
+		for k, v := range flags {
+			merged.Commands[name][k] = v
+		}
+	}
+	if other == nil {
+		return merged
+	}
+	if len(other.Workflows.Include) > 0 {
+		merged.Workflows.Include = other.Workflows.Include
+	}
+	if len(other.Workflows.Exclude) > 0 {
+		merged.Workflows.Exclude = other.Workflows.Exclude
+	}
+	if other.Notify.Enabled != nil {
+		merged.Notify.Enabled = other.Notify.Enabled
+	}
+	if other.Notify.Bell != nil {
+		merged.Notify.Bell = other.Notify.Bell
+	}
+	for name, flags := range other.Commands {
+		if merged.Commands[name] == nil {
+			merged.Commands[name] = make(map[string]any, len(flags))
+		}
+		for k, v := range flags {
+			merged.Commands[name][k] = v
+		}
+	}
+	return merged
+}
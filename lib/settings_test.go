@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testRepoConfig = `
+default = "github.com"
+
+[workflows]
+exclude = ["nightly*"]
+
+[notify]
+bell = true
+
+[wait]
+remote = "upstream"
+timeout = "2h"
+failed-output-lines = 300
+cancel-previous-runs = true
+`
+
+func TestLoadSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), RepoConfigFile)
+	if err := os.WriteFile(path, []byte(testRepoConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"nightly*"}; !reflect.DeepEqual(s.Workflows.Exclude, want) {
+		t.Errorf("Workflows.Exclude = %q, want %q", s.Workflows.Exclude, want)
+	}
+	if !s.Notify.IsEnabled() || !s.Notify.RingBell() {
+		t.Errorf("Notify = %+v, want enabled with bell", s.Notify)
+	}
+	want := map[string]map[string]any{
+		"wait": {
+			"remote":               "upstream",
+			"timeout":              "2h",
+			"failed-output-lines":  int64(300),
+			"cancel-previous-runs": true,
+		},
+	}
+	if !reflect.DeepEqual(s.Commands, want) {
+		t.Errorf("Commands = %#v, want %#v", s.Commands, want)
+	}
+}
+
+func TestLoadSettingsMissingFile(t *testing.T) {
+	s, err := LoadSettings(filepath.Join(t.TempDir(), RepoConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Commands) != 0 || !s.Notify.IsEnabled() || s.Notify.RingBell() {
+		t.Errorf("LoadSettings(missing) = %+v, want empty settings", s)
+	}
+}
+
+func TestLoadSettingsInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), RepoConfigFile)
+	if err := os.WriteFile(path, []byte("[wait\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSettings(path); err == nil {
+		t.Fatal("LoadSettings: want error for invalid TOML")
+	}
+}
+
+func TestSettingsMerge(t *testing.T) {
+	off := false
+	user := &Settings{
+		Workflows: WorkflowFilter{Include: []string{"CI"}, Exclude: []string{"lint"}},
+		Notify:    NotifySettings{Enabled: &off},
+		Commands: map[string]map[string]any{
+			"wait": {"remote": "origin", "quiet": true},
+			"open": {"print": true},
+		},
+	}
+	repo := &Settings{
+		Workflows: WorkflowFilter{Exclude: []string{"nightly*"}},
+		Commands: map[string]map[string]any{
+			"wait": {"remote": "upstream"},
+		},
+	}
+	got := user.Merge(repo)
+	if want := (WorkflowFilter{Include: []string{"CI"}, Exclude: []string{"nightly*"}}); !reflect.DeepEqual(got.Workflows, want) {
+		t.Errorf("Workflows = %+v, want %+v", got.Workflows, want)
+	}
+	if got.Notify.IsEnabled() {
+		t.Errorf("Notify.IsEnabled() = true, want the user setting (false) to carry over")
+	}
+	want := map[string]map[string]any{
+		"wait": {"remote": "upstream", "quiet": true},
+		"open": {"print": true},
+	}
+	if !reflect.DeepEqual(got.Commands, want) {
+		t.Errorf("Commands = %#v, want %#v", got.Commands, want)
+	}
+	if user.Commands["wait"]["remote"] != "origin" {
+		t.Errorf("Merge modified the receiver")
+	}
+}
@@ -0,0 +1,69 @@
+package lib
+
+// RunStatus is the status of a workflow run, job or step.
+// https://docs.github.com/en/rest/actions/workflow-runs#list-workflow-runs-for-a-repository
+type RunStatus string
+
+const (
+	StatusRequested  RunStatus = "requested"
+	StatusQueued     RunStatus = "queued"
+	StatusPending    RunStatus = "pending"
+	StatusWaiting    RunStatus = "waiting" // blocked on an environment protection rule
+	StatusInProgress RunStatus = "in_progress"
+	StatusCompleted  RunStatus = "completed"
+	// StatusActionRequired is accepted by the list-runs status filter and
+	// occasionally reported as a status rather than a conclusion.
+	StatusActionRequired RunStatus = "action_required"
+)
+
+// IsTerminal reports whether the status is final.
+func (s RunStatus) IsTerminal() bool {
+	return s == StatusCompleted
+}
+
+// IsPending reports whether the run, job or step has not started yet.
+func (s RunStatus) IsPending() bool {
+	switch s {
+	case StatusRequested, StatusQueued, StatusPending, StatusWaiting:
+		return true
+	}
+	return false
+}
+
+// NeedsAttention reports whether the status will not change until a person
+// does something, like approving a deployment.
+func (s RunStatus) NeedsAttention() bool {
+	return s == StatusWaiting || s == StatusActionRequired
+}
+
+// Conclusion is the outcome of a completed workflow run, job or step.
+type Conclusion string
+
+const (
+	ConclusionSuccess        Conclusion = "success"
+	ConclusionFailure        Conclusion = "failure"
+	ConclusionNeutral        Conclusion = "neutral"
+	ConclusionCancelled      Conclusion = "cancelled"
+	ConclusionSkipped        Conclusion = "skipped"
+	ConclusionTimedOut       Conclusion = "timed_out"
+	ConclusionActionRequired Conclusion = "action_required" // e.g. a first-time contributor's run awaiting approval
+	ConclusionStale          Conclusion = "stale"           // never completed; GitHub gave up on it
+	ConclusionStartupFailure Conclusion = "startup_failure" // e.g. an invalid workflow file
+)
+
+// IsFailed reports whether the conclusion means the run did not succeed.
+// Skipped and neutral runs are not failures; action_required is reported by
+// NeedsAttention instead.
+func (c Conclusion) IsFailed() bool {
+	switch c {
+	case ConclusionFailure, ConclusionCancelled, ConclusionTimedOut, ConclusionStale, ConclusionStartupFailure:
+		return true
+	}
+	return false
+}
+
+// NeedsAttention reports whether the run stopped because it needs someone to
+// act on it.
+func (c Conclusion) NeedsAttention() bool {
+	return c == ConclusionActionRequired
+}
@@ -0,0 +1,61 @@
+package lib
+
+import "testing"
+
+func TestRunStatusClassification(t *testing.T) {
+	tests := []struct {
+		status         RunStatus
+		terminal       bool
+		pending        bool
+		needsAttention bool
+	}{
+		{StatusRequested, false, true, false},
+		{StatusQueued, false, true, false},
+		{StatusPending, false, true, false},
+		{StatusWaiting, false, true, true},
+		{StatusInProgress, false, false, false},
+		{StatusCompleted, true, false, false},
+		{StatusActionRequired, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			if got := tt.status.IsTerminal(); got != tt.terminal {
+				t.Errorf("IsTerminal() = %v, want %v", got, tt.terminal)
+			}
+			if got := tt.status.IsPending(); got != tt.pending {
+				t.Errorf("IsPending() = %v, want %v", got, tt.pending)
+			}
+			if got := tt.status.NeedsAttention(); got != tt.needsAttention {
+				t.Errorf("NeedsAttention() = %v, want %v", got, tt.needsAttention)
+			}
+		})
+	}
+}
+
+func TestConclusionClassification(t *testing.T) {
+	tests := []struct {
+		conclusion     Conclusion
+		failed         bool
+		needsAttention bool
+	}{
+		{ConclusionSuccess, false, false},
+		{ConclusionFailure, true, false},
+		{ConclusionNeutral, false, false},
+		{ConclusionCancelled, true, false},
+		{ConclusionSkipped, false, false},
+		{ConclusionTimedOut, true, false},
+		{ConclusionActionRequired, false, true},
+		{ConclusionStale, true, false},
+		{ConclusionStartupFailure, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.conclusion), func(t *testing.T) {
+			if got := tt.conclusion.IsFailed(); got != tt.failed {
+				t.Errorf("IsFailed() = %v, want %v", got, tt.failed)
+			}
+			if got := tt.conclusion.NeedsAttention(); got != tt.needsAttention {
+				t.Errorf("NeedsAttention() = %v, want %v", got, tt.needsAttention)
+			}
+		})
+	}
+}
@@ -2,12 +2,16 @@ package lib
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 )
@@ -161,3 +165,48 @@ func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 	return nil, lastErr
 }
+
+// NewTransport returns an http.Transport that uses the proxy and TLS settings
+// in h. It starts from a copy of http.DefaultTransport, so the settings don't
+// leak into other clients.
+func NewTransport(h Host) (*http.Transport, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if h.Proxy != "" {
+		u, err := url.Parse(h.Proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", h.Proxy)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+	if h.CAFile == "" && h.ClientCert == "" && h.ClientKey == "" && !h.InsecureSkipVerify {
+		return tr, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: h.InsecureSkipVerify}
+	if h.CAFile != "" {
+		data, err := os.ReadFile(h.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("ca_file %s doesn't contain any PEM certificates", h.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if (h.ClientCert == "") != (h.ClientKey == "") {
+		return nil, errors.New("client_cert and client_key must be set together")
+	}
+	if h.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(h.ClientCert, h.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	tr.TLSClientConfig = cfg
+	return tr, nil
+}
@@ -2,10 +2,17 @@ package lib
 
 import (
 	"context"
+	"encoding/pem"
 	"errors"
 	"io"
+	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -69,3 +76,89 @@ func TestShortRetryableError(t *testing.T) {
 		})
 	}
 }
+
+// writeCertPEM writes the TLS certificate of srv to a PEM file and returns its
+// path.
+func writeCertPEM(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewTransportProxy(t *testing.T) {
+	tr, err := NewTransport(Host{Proxy: "http://proxy.example.com:3128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "https://ghe.example.com/api/v3", nil)
+	u, err := tr.Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u == nil || u.Host != "proxy.example.com:3128" {
+		t.Errorf("proxy = %v, want proxy.example.com:3128", u)
+	}
+
+	if _, err := NewTransport(Host{Proxy: "proxy.example.com"}); err == nil {
+		t.Errorf("NewTransport with a proxy with no scheme: got nil error")
+	}
+}
+
+func TestNewTransportCAFile(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	// Don't log the rejected handshake below.
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	// Without the CA, the self-signed certificate is rejected.
+	plain, err := NewTransport(Host{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&http.Client{Transport: plain}).Get(srv.URL); err == nil {
+		t.Fatal("request to a server with an untrusted certificate succeeded")
+	}
+
+	tr, err := NewTransport(Host{CAFile: writeCertPEM(t, srv)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request with ca_file: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewTransportErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		host Host
+		want string
+	}{
+		{"missing ca_file", Host{CAFile: filepath.Join(dir, "missing.pem")}, "reading ca_file"},
+		{"ca_file without certificates", Host{CAFile: notPEM}, "doesn't contain any PEM certificates"},
+		{"client_cert without client_key", Host{ClientCert: notPEM}, "must be set together"},
+		{"bad client certificate", Host{ClientCert: notPEM, ClientKey: notPEM}, "loading client certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTransport(tt.host)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewTransport() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
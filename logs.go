@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// logsOptions configures the logs subcommand.
+type logsOptions struct {
+	// Archive, if set, is the directory to unpack each run's full log
+	// archive into, instead of printing job logs.
+	Archive string
+	// Failed only prints the logs of jobs that failed.
+	Failed bool
+	// Raw prints logs exactly as GitHub returns them; see NormalizeLog.
+	Raw bool
+	// Color keeps and adds color when printing normalized logs.
+	Color bool
+	// Workflows only includes runs of workflows matching the filter.
+	Workflows workflowFilter
+}
+
+// commitRuns returns the runs for the commit sha that match filter, or an
+// error if there are none.
+func commitRuns(ctx context.Context, repoSvc *ghactions.RepoService, sha string, filter workflowFilter) ([]ghactions.WorkflowRun, error) {
+	all, err := repoSvc.FindWorkflowRunsForCommit(ctx, sha)
+	if err != nil {
+		return nil, err
+	}
+	runs := filter.apply(all)
+	if len(runs) == 0 {
+		desc := "workflow runs"
+		if f := filter.String(); f != "" {
+			desc += " " + f
+		}
+		return nil, &noRunsError{msg: fmt.Sprintf("no %s for %s", desc, shortRef(sha))}
+	}
+	return runs, nil
+}
+
+// archiveDirName returns the directory a run's logs are unpacked into when
+// there is more than one run, e.g. "CI [run 12]". Path separators in the
+// workflow name are replaced.
+func archiveDirName(run ghactions.WorkflowRun) string {
+	name := strings.NewReplacer("/", "_", `\`, "_", ":", "_").Replace(workflowRunDisplayName(run))
+	if name == "" || name == "." || name == ".." {
+		name = fmt.Sprintf("run %d", run.ID)
+	}
+	return name
+}
+
+// unpackedRun is the result of downloading and unpacking one run's logs.
+type unpackedRun struct {
+	dir   string
+	files []string
+	err   error
+}
+
+// unpackRunLogs downloads the log archive of every finished run in runs and
+// unpacks it under opts.Archive: directly, for a single run, or in a
+// directory per run.
+func unpackRunLogs(ctx context.Context, client *ghactions.Client, repoSvc *ghactions.RepoService, w io.Writer, runs []ghactions.WorkflowRun, opts logsOptions) error {
+	results := make([]unpackedRun, len(runs))
+	fanOut(len(runs), client.RateLimit, func(i int) {
+		run := runs[i]
+		if !run.Status.IsTerminal() {
+			return
+		}
+		dir := opts.Archive
+		if len(runs) > 1 {
+			dir = filepath.Join(opts.Archive, archiveDirName(run))
+		}
+		results[i].dir = dir
+		// The job list is only used to number the step logs, so a
+		// failure to fetch it isn't fatal.
+		jobs, _ := repoSvc.ListAllJobs(ctx, run.ID)
+		archive, err := repoSvc.DownloadRunLogs(ctx, run.ID)
+		if err != nil {
+			results[i].err = fmt.Errorf("downloading the logs for %q: %w", run.Name, err)
+			return
+		}
+		results[i].files, results[i].err = ghactions.UnpackRunLogs(archive, dir, jobs)
+	})
+	var firstErr error
+	for i, run := range runs {
+		res := results[i]
+		switch {
+		case !run.Status.IsTerminal():
+			fmt.Fprintf(w, "Skipped %s: it hasn't finished\n", workflowRunDisplayName(run))
+		case res.err != nil:
+			fmt.Fprintf(w, "Error unpacking %s: %v\n", workflowRunDisplayName(run), res.err)
+			if firstErr == nil {
+				firstErr = res.err
+			}
+		default:
+			fmt.Fprintf(w, "Unpacked %d %s for %s into %s\n", len(res.files), pluralize(len(res.files), "log"), workflowRunDisplayName(run), res.dir)
+		}
+	}
+	return firstErr
+}
+
+// printJobLogs prints the log of every finished job in runs, each under a
+// "==> run / job <==" header.
+func printJobLogs(ctx context.Context, client *ghactions.Client, repoSvc *ghactions.RepoService, w io.Writer, runs []ghactions.WorkflowRun, opts logsOptions) error {
+	runJobs := make([][]ghactions.Job, len(runs))
+	jobErrs := make([]error, len(runs))
+	fanOut(len(runs), client.RateLimit, func(i int) {
+		runJobs[i], jobErrs[i] = repoSvc.ListAllJobs(ctx, runs[i].ID)
+	})
+	var jobs []labeledJob
+	for i, run := range runs {
+		if jobErrs[i] != nil {
+			return fmt.Errorf("listing jobs for %q: %w", run.Name, jobErrs[i])
+		}
+		for _, job := range runJobs[i] {
+			if job.Status != ghactions.StatusCompleted || (opts.Failed && !job.Failed()) {
+				continue
+			}
+			jobs = append(jobs, labeledJob{label: workflowRunDisplayName(run) + " / " + job.Name, job: job})
+		}
+	}
+	if len(jobs) == 0 {
+		what := "finished"
+		if opts.Failed {
+			what = "failed"
+		}
+		fmt.Fprintf(w, "No %s jobs in %s\n", what, runNames(runs))
+		return nil
+	}
+
+	logs := make([][]byte, len(jobs))
+	logErrs := make([]error, len(jobs))
+	fanOut(len(jobs), client.RateLimit, func(i int) {
+		logs[i], logErrs[i] = repoSvc.CachedJobLogs(ctx, jobs[i].job)
+	})
+	for i, job := range jobs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if logErrs[i] != nil {
+			return fmt.Errorf("fetching the log for %s: %w", job.label, logErrs[i])
+		}
+		fmt.Fprintf(w, "==> %s <==\n", job.label)
+		data := logs[i]
+		if !opts.Raw {
+			data = ghactions.NormalizeLog(data, ghactions.LogOptions{Color: opts.Color})
+		}
+		w.Write(data)
+	}
+	return nil
+}
+
+func doLogs(ctx context.Context, client *ghactions.Client, remote *RemoteURL, w io.Writer, t target, opts logsOptions) error {
+	repoSvc := client.Repo(remote.Path, remote.RepoName)
+	runs, err := commitRuns(ctx, repoSvc, t.SHA, opts.Workflows)
+	if err != nil {
+		return err
+	}
+	if opts.Archive != "" {
+		return unpackRunLogs(ctx, client, repoSvc, w, runs, opts)
+	}
+	return printJobLogs(ctx, client, repoSvc, w, runs, opts)
+}
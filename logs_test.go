@@ -0,0 +1,135 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestArchiveDirName(t *testing.T) {
+	tests := []struct {
+		run  ghactions.WorkflowRun
+		want string
+	}{
+		{ghactions.WorkflowRun{ID: 1, Name: "CI", RunNumber: 12}, "CI [run 12]"},
+		{ghactions.WorkflowRun{ID: 1, Name: "build/deploy", RunNumber: 3, RunAttempt: 2}, "build_deploy [run 3, attempt 2]"},
+		{ghactions.WorkflowRun{ID: 9, Name: ".."}, "run 9"},
+	}
+	for _, tt := range tests {
+		if got := archiveDirName(tt.run); got != tt.want {
+			t.Errorf("archiveDirName(%q) = %q, want %q", tt.run.Name, got, tt.want)
+		}
+	}
+}
+
+func logsTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, body := range map[string]string{
+		"0_test.txt":                 "full log\n",
+		"test/1_Set up job.txt":      "setup\n",
+		"test/2_Run go test ....txt": "FAIL\n",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_count": 2, "workflow_runs": [
+			{"id": 1, "name": "CI", "run_number": 5, "status": "completed", "conclusion": "failure"},
+			{"id": 2, "name": "Deploy", "run_number": 7, "status": "in_progress"}
+		]}`))
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_count": 2, "jobs": [
+			{"id": 11, "name": "test", "status": "completed", "conclusion": "failure", "steps": [
+				{"name": "Set up job", "number": 1},
+				{"name": "Run actions/checkout@v4", "number": 2},
+				{"name": "Run go test ./...", "number": 3}
+			]},
+			{"id": 12, "name": "lint", "status": "completed", "conclusion": "success"}
+		]}`))
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs/2/jobs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_count": 0, "jobs": []}`))
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs/1/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(archive.Bytes())
+	})
+	mux.HandleFunc("/repos/o/r/actions/jobs/11/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("2024-05-01T17:03:22.1234567Z --- FAIL: TestFlaky\n"))
+	})
+	mux.HandleFunc("/repos/o/r/actions/jobs/12/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("2024-05-01T17:03:22.1234567Z ok\n"))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestDoLogsArchive(t *testing.T) {
+	srv := logsTestServer(t)
+	defer srv.Close()
+	client := ghactions.NewClient("token", "github.com")
+	client.Client.Base = srv.URL
+	remote := &RemoteURL{Host: "github.com", Path: "o", RepoName: "r"}
+
+	dir := t.TempDir()
+	var out bytes.Buffer
+	err := doLogs(context.Background(), client, remote, &out, target{SHA: "0123456789abcdef"}, logsOptions{Archive: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Unpacked 3 logs for CI [run 5] into " + filepath.Join(dir, "CI [run 5]"), "Skipped Deploy [run 7]: it hasn't finished"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	// The archive numbered go test 2, but the API says it's step 3.
+	data, err := os.ReadFile(filepath.Join(dir, "CI [run 5]", "test", "3_Run go test ....txt"))
+	if err != nil || string(data) != "FAIL\n" {
+		t.Errorf("step log = %q, %v", data, err)
+	}
+}
+
+func TestDoLogsPrint(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	srv := logsTestServer(t)
+	defer srv.Close()
+	client := ghactions.NewClient("token", "github.com")
+	client.Client.Base = srv.URL
+	remote := &RemoteURL{Host: "github.com", Path: "o", RepoName: "r"}
+	tgt := target{SHA: "0123456789abcdef"}
+
+	var out bytes.Buffer
+	if err := doLogs(context.Background(), client, remote, &out, tgt, logsOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "==> CI [run 5] / test <==\n--- FAIL: TestFlaky\n\n==> CI [run 5] / lint <==\nok\n"
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := doLogs(context.Background(), client, remote, &out, tgt, logsOptions{Failed: true, Workflows: workflowFilter{Include: []string{"CI"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "lint") || !strings.Contains(out.String(), "FAIL: TestFlaky") {
+		t.Errorf("--failed output:\n%s", out.String())
+	}
+}
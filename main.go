@@ -7,20 +7,30 @@
 // The commands are:
 //
 //	version             Print the current version
+//	approve             Approve or reject deployments waiting on a branch.
+//	cancel              Cancel older workflow runs on a branch.
 //	has-workflows       Report whether GitHub Actions workflows are configured.
 //	wait                Wait for workflow runs to finish on a branch.
 //	open                Open the workflow run in your browser.
+//	grep                Search the job logs of a commit's workflow runs.
+//	logs                Print or download the job logs of a commit's workflow runs.
+//	push                Run git push, then wait for the pushed branch.
+//	stats               Report historical workflow durations and reliability.
 package main
 
 import (
 	"bytes"
 	"context"
-	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/kevinburke/bigtext"
@@ -35,13 +45,28 @@ Usage:
 
 The commands are:
 
+	approve       Approve or reject deployments waiting on a branch
 	cancel        Cancel older workflow runs on a branch
+	grep          Search the job logs of a commit's workflow runs
 	has-workflows Report whether GitHub Actions workflows are configured
+	logs          Print or download the job logs of a commit's workflow runs
 	open          Open the workflow run in your browser
+	push          Run git push, then wait for the pushed branch's workflow runs
+	stats         Report historical workflow durations and reliability
 	version       Print the current version
 	wait          Wait for workflow runs to finish on a branch.
 
 Use "github-actions [command] --help" for more information about a command.
+
+Commands other than has-workflows exit 1 if the build failed (or, for grep,
+nothing matched), 3 on --timeout, 4 if there were no workflow runs, 5 if
+GitHub couldn't be reached, 6 if the runs need approval, 7 for a missing or
+rejected token, 8 if you stopped wait --interactive with q (130 for Ctrl-C),
+and 2 for other errors.
+
+Flag defaults can be set in a .github-actions.toml file at the repository
+root, in the user config file, or with GH_ACTIONS_<COMMAND>_<FLAG>
+environment variables.
 `
 
 const hasWorkflowsHelp = `usage: has-workflows
@@ -72,51 +97,174 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	approveflags := flag.NewFlagSet("approve", flag.ExitOnError)
 	cancelflags := flag.NewFlagSet("cancel", flag.ExitOnError)
 	configuredflags := flag.NewFlagSet("has-workflows", flag.ExitOnError)
 	waitflags := flag.NewFlagSet("wait", flag.ExitOnError)
+	grepflags := flag.NewFlagSet("grep", flag.ExitOnError)
+	logsflags := flag.NewFlagSet("logs", flag.ExitOnError)
 	openflags := flag.NewFlagSet("open", flag.ExitOnError)
+	pushflags := flag.NewFlagSet("push", flag.ExitOnError)
+	statsflags := flag.NewFlagSet("stats", flag.ExitOnError)
+
+	approveRemote := approveflags.String("remote", "origin", "Git remote to use")
+	approveSHA := approveflags.String("sha", "", "Review deployments for this commit SHA instead of a branch")
+	approveRef := approveflags.String("ref", "", "Review deployments for this branch, tag or commit")
+	approveList := approveflags.Bool("list", false, "List pending deployments without approving them")
+	approveReject := approveflags.Bool("reject", false, "Reject the deployments instead of approving them")
+	approveComment := approveflags.String("comment", "", "Comment to attach to the review")
+	approveEnvironment := approveflags.String("environment", "", "Comma separated environments to review (default all)")
+	approveflags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `usage: approve [ref]
+
+Approve deployments that workflow runs for the branch tip are waiting on, for
+environments protected by required reviewers or a wait timer. Use --list to
+see the pending deployments, their reviewers and wait timers, and --reject to
+reject them. By default, uses the current branch.
+
+`)
+		approveflags.PrintDefaults()
+	}
 
 	cancelRemote := cancelflags.String("remote", "origin", "Git remote to use")
+	cancelDryRun := cancelflags.Bool("dry-run", false, "Show which runs would be cancelled without cancelling them")
+	cancelAllBranches := cancelflags.Bool("all-branches", false, "Cancel runs on any branch whose remote head has moved past the run's commit")
+	cancelOlderThan := cancelflags.Duration("older-than", 0, "Only cancel runs created at least this long ago")
+	cancelForce := cancelflags.Bool("force", false, "Confirm each run finishes, and force-cancel runs that are stuck")
+	cancelForceAfter := cancelflags.Duration("force-after", 30*time.Second, "With --force, how long to wait after a normal cancel before force-cancelling")
+	var cancelWorkflows, cancelExcludeWorkflows stringsFlag
+	cancelflags.Var(&cancelWorkflows, "workflow", "Only cancel runs of workflows matching this glob (name or file name; repeatable)")
+	cancelflags.Var(&cancelExcludeWorkflows, "exclude-workflow", "Don't cancel runs of workflows matching this glob (repeatable)")
 	cancelflags.Usage = func() {
 		fmt.Fprintf(os.Stderr, `usage: cancel [branch]
 
 Cancel in-progress and queued workflow runs on a branch that were triggered by
 older commits. Runs for the current branch tip are left alone. By default, uses
-the current branch.
+the current branch. With --all-branches, cancels runs on every branch whose
+head on the remote has moved on from the commit the run is testing.
 
 `)
 		cancelflags.PrintDefaults()
 	}
 
 	waitRemote := waitflags.String("remote", "origin", "Git remote to use")
-	waitOutputLines := waitflags.Int("failed-output-lines", 100, "Number of lines of failed output to display")
-	waitTimeout := waitflags.Duration("timeout", time.Hour, "Maximum time to wait")
-	waitNoRunsTimeout := waitflags.Duration("no-runs-timeout", 2*time.Minute, "How long to wait for runs to appear before giving up (0 to disable)")
-	waitQuiet := waitflags.Bool("quiet", false, "Only print final output, not periodic status updates")
-	waitCancelPreviousRuns := waitflags.Bool("cancel-previous-runs", false, "Cancel older queued or in-progress workflow runs before waiting")
+	waitSHA := waitflags.String("sha", "", "Wait for runs on this commit SHA, which need not exist locally")
+	waitRef := waitflags.String("ref", "", "Wait for runs on this branch, tag or commit")
+	waitPush := waitflags.Bool("push", false, "Push the branch or tag to the remote before waiting")
+	waitCommon := addWaitFlags(waitflags)
 
 	waitflags.Usage = func() {
-		fmt.Fprintf(os.Stderr, `usage: wait [refspec]
+		fmt.Fprintf(os.Stderr, `usage: wait [ref]
 
 Wait for GitHub Actions workflow runs to complete, then print a descriptive
-output on success or failure. By default, waits on the current branch,
-otherwise you can pass a branch to wait for.
+output on success or failure. By default, waits on the current branch, or the
+current commit if HEAD is detached; otherwise you can pass a branch, tag or
+commit SHA to wait for.
 
 `)
 		waitflags.PrintDefaults()
 	}
 
+	pushCommon := addWaitFlags(pushflags)
+	pushflags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `usage: push [flags] [--] [git push arguments]
+
+Run "git push" with the given arguments, then wait for the workflow runs on
+the branch or tag that was pushed, using the remote it was pushed to. Put git
+push options like --force-with-lease after "--". Flags default to the values
+in the [wait] config table, and can be overridden in a [push] table.
+
+`)
+		pushflags.PrintDefaults()
+	}
+
+	grepRemote := grepflags.String("remote", "origin", "Git remote to use")
+	grepSHA := grepflags.String("sha", "", "Search the runs for this commit SHA instead of a branch")
+	grepRef := grepflags.String("ref", "", "Search the runs for this branch, tag or commit")
+	grepRunCount := grepflags.Int("runs", 0, "Also search the last N completed runs of each workflow on the branch")
+	var grepContext int
+	grepflags.IntVar(&grepContext, "context", 0, "Print this many lines of context around each match")
+	grepflags.IntVar(&grepContext, "C", 0, "Shorthand for --context")
+	var grepIgnoreCase bool
+	grepflags.BoolVar(&grepIgnoreCase, "ignore-case", false, "Match the pattern case-insensitively")
+	grepflags.BoolVar(&grepIgnoreCase, "i", false, "Shorthand for --ignore-case")
+	var grepWorkflows, grepExcludeWorkflows stringsFlag
+	grepflags.Var(&grepWorkflows, "workflow", "Only search runs of workflows matching this glob (name or file name; repeatable)")
+	grepflags.Var(&grepExcludeWorkflows, "exclude-workflow", "Don't search runs of workflows matching this glob (repeatable)")
+	grepflags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `usage: grep [flags] pattern [ref]
+
+Search the logs of every finished job in the workflow runs for a commit for a
+regular expression (Go RE2 syntax), and print each match as job:line: text.
+With --runs, also search the last N runs of each workflow on the branch, e.g.
+to see when a flaky test last failed. Logs are cached, so searching the same
+runs again is instant. Exits 0 if anything matched, 1 if nothing did, and 2 or
+more on errors.
+
+`)
+		grepflags.PrintDefaults()
+	}
+
+	logsRemote := logsflags.String("remote", "origin", "Git remote to use")
+	logsSHA := logsflags.String("sha", "", "Show logs for this commit SHA instead of a branch")
+	logsRef := logsflags.String("ref", "", "Show logs for this branch, tag or commit")
+	logsArchive := logsflags.String("archive", "", "Download each run's full log archive and unpack it into this directory")
+	logsFailed := logsflags.Bool("failed", false, "Only print the logs of failed jobs")
+	logsRaw := logsflags.Bool("raw-logs", false, "Print logs exactly as GitHub returns them, with timestamps and ##[group] markers")
+	var logsWorkflows, logsExcludeWorkflows stringsFlag
+	logsflags.Var(&logsWorkflows, "workflow", "Only include runs of workflows matching this glob (name or file name; repeatable)")
+	logsflags.Var(&logsExcludeWorkflows, "exclude-workflow", "Ignore runs of workflows matching this glob (repeatable)")
+	logsflags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `usage: logs [flags] [ref]
+
+Print the log of every finished job in the workflow runs for a commit. By
+default, uses the current branch. With --archive, download each finished
+run's log archive instead and unpack it into a directory per job, with a log
+file per step, numbered like the steps on GitHub. With more than one run, each
+run gets its own directory.
+
+`)
+		logsflags.PrintDefaults()
+	}
+
 	openRemote := openflags.String("remote", "origin", "Git remote to use")
+	openSHA := openflags.String("sha", "", "Open runs for this commit SHA instead of a branch")
+	openRef := openflags.String("ref", "", "Open runs for this branch, tag or commit")
+	openFailed := openflags.Bool("failed", false, "Open the failing step of a failed run, or of a running one with a failed job")
+	openPR := openflags.Bool("pr", false, "Only consider runs triggered by a pull request")
+	openPrint := openflags.Bool("print", false, "Print the URL instead of opening a browser")
+	var openWorkflows, openExcludeWorkflows stringsFlag
+	openflags.Var(&openWorkflows, "workflow", "Only consider runs of workflows matching this glob (name or file name; repeatable)")
+	openflags.Var(&openExcludeWorkflows, "exclude-workflow", "Ignore runs of workflows matching this glob (repeatable)")
 	openflags.Usage = func() {
-		fmt.Fprintf(os.Stderr, `usage: open [refspec]
+		fmt.Fprintf(os.Stderr, `usage: open [ref]
 
 Open the GitHub Actions workflow run for the current branch in your browser.
+If the commit has several matching runs and you're at a terminal, you can
+pick one; otherwise the most recent is opened.
 
 `)
 		openflags.PrintDefaults()
 	}
 
+	statsRemote := statsflags.String("remote", "origin", "Git remote to use")
+	statsBranch := statsflags.String("branch", "", "Only include runs on this branch (default all branches)")
+	statsDays := statsflags.Int("days", 30, "Number of days in each reporting period")
+	statsJobs := statsflags.Bool("jobs", false, "Include per-job rows (one extra API call per run)")
+	statsFormat := statsflags.String("format", "table", "Output format: table, json or csv")
+	statsflags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `usage: stats [--branch main] [--days 30] [--jobs]
+
+Report duration percentiles (p50/p90/max), queue time, and success, failure
+and cancellation rates for each workflow, and with --jobs each job, over the
+last --days days.
+The trend column compares the median duration and success rate against the
+period before that.
+
+`)
+		statsflags.PrintDefaults()
+	}
+
 	configuredRemote := configuredflags.String("remote", "origin", "Git remote to use")
 	configuredflags.Usage = func() {
 		fmt.Fprint(os.Stderr, hasWorkflowsHelp)
@@ -124,46 +272,114 @@ Open the GitHub Actions workflow run for the current branch in your browser.
 	}
 
 	debug := flag.Bool("debug", false, "Enable the debug log level")
+	flag.StringVar(&recordDir, "record", "", "Save every GitHub request and response to this directory, with tokens redacted")
+	flag.StringVar(&replayDir, "replay", "", "Answer GitHub requests from a directory saved with --record, instead of the network")
 	flag.Parse()
 
 	if *debug {
 		slog.SetLogLoggerLevel(slog.LevelDebug)
 	}
+	if recordDir != "" && replayDir != "" {
+		fmt.Fprintln(os.Stderr, "github-actions: --record and --replay can't be used together")
+		os.Exit(2)
+	}
+	if recordDir != "" {
+		checkError(writeRecordedCommand(recordDir, os.Args[1:]), "starting the recording")
+		var err error
+		recorder, err = ghactions.NewRecorder(recordDir)
+		checkError(err, "starting the recording")
+	}
+	if replayDir != "" {
+		var err error
+		replayer, err = ghactions.NewReplayer(replayDir)
+		checkError(err, "loading the recording")
+	}
 
 	mainArgs := flag.Args()
 	if len(mainArgs) < 1 {
 		usage()
-		os.Exit(2)
+		exit(2)
 	}
 
 	subargs := mainArgs[1:]
 
 	if flag.Arg(0) == "version" {
 		fmt.Fprintf(os.Stdout, "github-actions version %s\n", ghactions.Version)
-		os.Exit(0)
+		exit(0)
 	}
 
+	settings, err := loadSettings(ctx)
+	checkError(err, "loading config")
+	err = checkCommandTables(settings, approveflags, cancelflags, configuredflags, waitflags, pushflags, grepflags, logsflags, openflags, statsflags)
+	checkError(err, "loading config")
+
 	switch flag.Arg(0) {
+	case "approve":
+		approveflags.Parse(subargs)
+		checkError(applyDefaults(approveflags, settings, os.Getenv), "loading config")
+		args := approveflags.Args()
+		t, err := resolveTarget(ctx, args, *approveSHA, *approveRef)
+		checkError(err, "getting git ref")
+
+		remote, err := getRemoteURL(ctx, *approveRemote)
+		checkError(err, "loading git info")
+
+		host := remote.Host
+		token, err := getToken(ctx, host)
+		checkError(err, "getting GitHub token")
+
+		client, err := newClient(token, remote)
+		checkError(err, "configuring HTTP client")
+
+		opts := approveOptions{
+			List:    *approveList,
+			Reject:  *approveReject,
+			Comment: *approveComment,
+		}
+		for _, env := range strings.Split(*approveEnvironment, ",") {
+			if env = strings.TrimSpace(env); env != "" {
+				opts.Environments = append(opts.Environments, env)
+			}
+		}
+		err = doApprove(ctx, client, remote, os.Stdout, t, opts)
+		checkError(err, "reviewing pending deployments")
+
 	case "cancel":
 		cancelflags.Parse(subargs)
+		checkError(applyDefaults(cancelflags, settings, os.Getenv), "loading config")
 		args := cancelflags.Args()
-		branch, err := getBranchFromArgs(ctx, args)
+		t, err := resolveTarget(ctx, args, "", "")
 		checkError(err, "getting git branch")
 
 		remote, err := getRemoteURL(ctx, *cancelRemote)
 		checkError(err, "loading git info")
 
 		host := remote.Host
-		token, err := ghactions.GetToken(ctx, host)
+		token, err := getToken(ctx, host)
 		checkError(err, "getting GitHub token")
 
-		client := ghactions.NewClient(token, host)
-
-		err = doCancel(ctx, client, remote, *cancelRemote, branch)
+		client, err := newClient(token, remote)
+		checkError(err, "configuring HTTP client")
+
+		opts := cancelOptions{
+			DryRun:      *cancelDryRun,
+			AllBranches: *cancelAllBranches,
+			Force:       *cancelForce,
+			ForceAfter:  *cancelForceAfter,
+			Filter: cancelFilter{
+				Workflows:        cancelWorkflows,
+				ExcludeWorkflows: cancelExcludeWorkflows,
+				OlderThan:        *cancelOlderThan,
+			},
+		}
+		err = doCancel(ctx, client, remote, *cancelRemote, t, opts)
 		checkError(err, "cancelling workflow runs")
 
 	case "has-workflows":
 		configuredflags.Parse(subargs)
+		if err := applyDefaults(configuredflags, settings, os.Getenv); err != nil {
+			failErrorWithExitCode(err, "loading config", 2)
+		}
 
 		remote, err := getRemoteURL(ctx, *configuredRemote)
 		if err != nil {
@@ -171,65 +387,264 @@ Open the GitHub Actions workflow run for the current branch in your browser.
 		}
 
 		host := remote.Host
-		token, err := ghactions.GetToken(ctx, host)
+		token, err := getToken(ctx, host)
 		if err != nil {
 			failErrorWithExitCode(err, "getting GitHub token", 2)
 		}
 
-		client := ghactions.NewClient(token, host)
+		client, err := newClient(token, remote)
+		if err != nil {
+			failErrorWithExitCode(err, "configuring HTTP client", 2)
+		}
 
 		status, err := doConfigured(ctx, client, remote)
 		if err != nil {
 			failErrorWithExitCode(err, "checking configured workflows", 2)
 		}
 		if status == workflowConfigurationStatusNotConfigured {
-			os.Exit(1)
+			exit(1)
 		}
 
 	case "wait":
 		waitflags.Parse(subargs)
+		checkError(applyDefaults(waitflags, settings, os.Getenv), "loading config")
 		args := waitflags.Args()
-		branch, err := getBranchFromArgs(ctx, args)
-		checkError(err, "getting git branch")
+		t, err := resolveTarget(ctx, args, *waitSHA, *waitRef)
+		checkError(err, "getting git ref")
 
 		remote, err := getRemoteURL(ctx, *waitRemote)
 		checkError(err, "loading git info")
 
 		host := remote.Host
-		token, err := ghactions.GetToken(ctx, host)
+		token, err := getToken(ctx, host)
 		checkError(err, "getting GitHub token")
 
-		client := ghactions.NewClient(token, host)
+		client, err := newClient(token, remote)
+		checkError(err, "configuring HTTP client")
+		client.RawLogs = *waitCommon.rawLogs
+		client.AllFailedJobs = !*waitCommon.failFast
 
-		ctx, cancel := context.WithTimeout(ctx, *waitTimeout)
+		ctx, cancel := withTimeout(ctx, *waitCommon.timeout)
 		defer cancel()
 
-		err = doWait(ctx, client, remote, *waitRemote, branch, *waitOutputLines, *waitQuiet, *waitCancelPreviousRuns, *waitNoRunsTimeout)
+		opts := waitCommon.options(settings.Notify)
+		configureForActions(&opts, os.Getenv)
+		opts.Push = *waitPush
+		err = doWait(ctx, client, remote, *waitRemote, t, opts)
 		checkError(err, "waiting for workflow runs")
 
+	case "push":
+		pushflags.Parse(subargs)
+		inheritDefaults(settings, "wait", pushflags)
+		checkError(applyDefaults(pushflags, settings, os.Getenv), "loading config")
+
+		remoteName, t, err := pushAndResolve(ctx, os.Stderr, pushflags.Args())
+		checkError(err, "pushing")
+
+		remote, err := remoteURLFor(ctx, remoteName)
+		checkError(err, "loading git info")
+
+		host := remote.Host
+		token, err := getToken(ctx, host)
+		checkError(err, "getting GitHub token")
+
+		client, err := newClient(token, remote)
+		checkError(err, "configuring HTTP client")
+		client.RawLogs = *pushCommon.rawLogs
+		client.AllFailedJobs = !*pushCommon.failFast
+
+		ctx, cancel := withTimeout(ctx, *pushCommon.timeout)
+		defer cancel()
+
+		opts := pushCommon.options(settings.Notify)
+		configureForActions(&opts, os.Getenv)
+		opts.SkipPushCheck = true
+		err = doWait(ctx, client, remote, remoteName, t, opts)
+		checkError(err, "waiting for workflow runs")
+
+	case "grep":
+		grepflags.Parse(subargs)
+		checkError(applyDefaults(grepflags, settings, os.Getenv), "loading config")
+		args := grepflags.Args()
+		if len(args) == 0 {
+			grepflags.Usage()
+			exit(2)
+		}
+		pattern := args[0]
+		if grepIgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		checkError(err, "parsing pattern")
+		t, err := resolveTarget(ctx, args[1:], *grepSHA, *grepRef)
+		checkError(err, "getting git ref")
+
+		remote, err := getRemoteURL(ctx, *grepRemote)
+		checkError(err, "loading git info")
+
+		host := remote.Host
+		token, err := getToken(ctx, host)
+		checkError(err, "getting GitHub token")
+
+		client, err := newClient(token, remote)
+		checkError(err, "configuring HTTP client")
+
+		opts := grepOptions{
+			Pattern:   re,
+			Context:   grepContext,
+			Runs:      *grepRunCount,
+			Workflows: workflowFilter{Include: grepWorkflows, Exclude: grepExcludeWorkflows},
+		}
+		found, err := doGrep(ctx, client, remote, os.Stdout, os.Stderr, t, opts)
+		checkError(err, "searching job logs")
+		if !found {
+			exit(1)
+		}
+
+	case "logs":
+		logsflags.Parse(subargs)
+		checkError(applyDefaults(logsflags, settings, os.Getenv), "loading config")
+		args := logsflags.Args()
+		t, err := resolveTarget(ctx, args, *logsSHA, *logsRef)
+		checkError(err, "getting git ref")
+
+		remote, err := getRemoteURL(ctx, *logsRemote)
+		checkError(err, "loading git info")
+
+		host := remote.Host
+		token, err := getToken(ctx, host)
+		checkError(err, "getting GitHub token")
+
+		client, err := newClient(token, remote)
+		checkError(err, "configuring HTTP client")
+
+		opts := logsOptions{
+			Archive:   *logsArchive,
+			Failed:    *logsFailed,
+			Raw:       *logsRaw,
+			Color:     ghactions.IsATTY() && os.Getenv("NO_COLOR") == "",
+			Workflows: workflowFilter{Include: logsWorkflows, Exclude: logsExcludeWorkflows},
+		}
+		err = doLogs(ctx, client, remote, os.Stdout, t, opts)
+		checkError(err, "fetching logs")
+
 	case "open":
 		openflags.Parse(subargs)
+		checkError(applyDefaults(openflags, settings, os.Getenv), "loading config")
 		args := openflags.Args()
-		branch, err := getBranchFromArgs(ctx, args)
-		checkError(err, "getting git branch")
+		t, err := resolveTarget(ctx, args, *openSHA, *openRef)
+		checkError(err, "getting git ref")
 
 		remote, err := getRemoteURL(ctx, *openRemote)
 		checkError(err, "loading git info")
 
 		host := remote.Host
-		token, err := ghactions.GetToken(ctx, host)
+		token, err := getToken(ctx, host)
 		checkError(err, "getting GitHub token")
 
-		client := ghactions.NewClient(token, host)
+		client, err := newClient(token, remote)
+		checkError(err, "configuring HTTP client")
 
-		err = doOpen(ctx, client, remote, *openRemote, branch)
+		opts := openOptions{
+			Failed:    *openFailed,
+			PR:        *openPR,
+			Workflows: workflowFilter{Include: openWorkflows, Exclude: openExcludeWorkflows},
+			Print:     *openPrint,
+		}
+		err = doOpen(ctx, client, remote, *openRemote, t, opts)
 		checkError(err, "opening workflow run")
 
+	case "stats":
+		statsflags.Parse(subargs)
+		checkError(applyDefaults(statsflags, settings, os.Getenv), "loading config")
+
+		remote, err := getRemoteURL(ctx, *statsRemote)
+		checkError(err, "loading git info")
+
+		host := remote.Host
+		token, err := getToken(ctx, host)
+		checkError(err, "getting GitHub token")
+
+		client, err := newClient(token, remote)
+		checkError(err, "configuring HTTP client")
+
+		err = doStats(ctx, client, remote, os.Stdout, os.Stderr, *statsBranch, *statsDays, *statsJobs, *statsFormat)
+		checkError(err, "computing workflow stats")
+
 	default:
 		fmt.Fprintf(os.Stderr, "github-actions: unknown command %q\n\n", flag.Arg(0))
 		usage()
-		os.Exit(2)
+		exit(2)
 	}
+	closeRecording()
+}
+
+// recordDir and replayDir are set by the global --record and --replay flags.
+var recordDir, replayDir string
+
+// recorder and replayer are shared by every client newClient returns, so a
+// command that talks to several remotes still makes one recording.
+var (
+	recorder *ghactions.Recorder
+	replayer *ghactions.Replayer
+)
+
+// closeRecording closes the recording, if there is one, so every exchange is
+// saved.
+func closeRecording() {
+	if recorder == nil {
+		return
+	}
+	if err := recorder.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "github-actions: saving the recording: %v\n", err)
+	}
+	recorder = nil
+}
+
+// exit closes the recording and exits with code. Use it instead of os.Exit
+// once the recording has started.
+func exit(code int) {
+	closeRecording()
+	os.Exit(code)
+}
+
+// recordedCommandFile holds the command line a recording was made with, so
+// whoever replays it knows which arguments to pass.
+const recordedCommandFile = "command.txt"
+
+func writeRecordedCommand(dir string, args []string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	line := "github-actions " + strings.Join(args, " ") + "\n"
+	return os.WriteFile(filepath.Join(dir, recordedCommandFile), []byte(line), 0o644)
+}
+
+// getToken returns the GitHub token for host. A replay doesn't talk to
+// GitHub, so it doesn't need one.
+func getToken(ctx context.Context, host string) (string, error) {
+	token, err := ghactions.GetToken(ctx, host)
+	if err != nil && replayer != nil {
+		return "", nil
+	}
+	return token, err
+}
+
+// newClient returns a GitHub API client for remote's host, using the api_url,
+// proxy and TLS settings configured for it, if any. With --record or
+// --replay, the client records its requests or replays them.
+func newClient(token string, remote *RemoteURL) (*ghactions.Client, error) {
+	client := ghactions.NewClient(token, remote.Host)
+	if err := client.ConfigureHost(remote.HostConfig); err != nil {
+		return nil, err
+	}
+	switch {
+	case replayer != nil:
+		client.ReplayFrom(replayer)
+	case recorder != nil:
+		client.RecordTo(recorder)
+	}
+	return client, nil
 }
 
 func checkError(err error, msg string) {
@@ -238,8 +653,9 @@ func checkError(err error, msg string) {
 	}
 }
 
+// failError prints err and exits with the code exitCode picks for it.
 func failError(err error, msg string) {
-	failErrorWithExitCode(err, msg, 1)
+	failErrorWithExitCode(err, msg, exitCode(err))
 }
 
 func failErrorWithExitCode(err error, msg string, code int) {
@@ -248,14 +664,22 @@ func failErrorWithExitCode(err error, msg string, code int) {
 	} else {
 		fmt.Fprintf(os.Stderr, "Error %s: %v\n", msg, err)
 	}
-	os.Exit(code)
+	exit(code)
 }
 
-func getBranchFromArgs(ctx context.Context, args []string) (string, error) {
-	if len(args) >= 1 {
-		return args[0], nil
+// stringsFlag is a flag.Value that can be repeated, or given a comma
+// separated list, to build up a list of strings.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f = append(*f, v)
+		}
 	}
-	return currentBranch(ctx)
+	return nil
 }
 
 // isHttpError checks if the given error is a request timeout or a network
@@ -264,14 +688,14 @@ func isHttpError(err error) bool {
 	return ghactions.IsRetryableError(err)
 }
 
-// waitForRateLimitReset sleeps until the GitHub primary rate limit resets,
-// honoring ctx. It returns ctx.Err() if the context is cancelled before the
-// reset time.
-func waitForRateLimitReset(ctx context.Context, rle *ghactions.RateLimitError, quiet bool) error {
+// waitForRateLimitReset sleeps on clk until the GitHub primary rate limit
+// resets, honoring ctx. It returns ctx.Err() if the context is cancelled
+// before the reset time.
+func waitForRateLimitReset(ctx context.Context, clk clock, rle *ghactions.RateLimitError, quiet bool) error {
 	// Add a small buffer past the reset time to avoid racing the server
 	// clock and immediately hitting the limit again.
 	const buffer = 5 * time.Second
-	wait := max(time.Until(rle.Reset)+buffer, buffer)
+	wait := max(rle.Reset.Sub(clk.Now())+buffer, buffer)
 	if !quiet {
 		fmt.Printf("GitHub API rate limit exhausted (limit=%d, resource=%s). Sleeping %s until reset at %s.\n",
 			rle.Limit, rle.Resource, formatWaitDuration(wait), rle.Reset.Format(time.RFC3339))
@@ -279,22 +703,22 @@ func waitForRateLimitReset(ctx context.Context, rle *ghactions.RateLimitError, q
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
-	case <-time.After(wait):
+	case <-clk.After(wait):
 		return nil
 	}
 }
 
 // pollIntervalForRateLimit returns a polling interval appropriate for the
-// current rate limit budget. As the remaining budget shrinks relative to the
+// current rate limit budget at now. As the remaining budget shrinks relative to the
 // time until reset, the interval grows so we don't burn through the limit.
 // The returned interval is always at least defaultInterval and at most
 // maxInterval.
-func pollIntervalForRateLimit(rl *ghactions.RateLimit, defaultInterval time.Duration) time.Duration {
+func pollIntervalForRateLimit(now time.Time, rl *ghactions.RateLimit, defaultInterval time.Duration) time.Duration {
 	const maxInterval = 2 * time.Minute
 	if rl == nil || rl.Remaining <= 0 || rl.Reset.IsZero() {
 		return defaultInterval
 	}
-	resetIn := time.Until(rl.Reset)
+	resetIn := rl.Reset.Sub(now)
 	if resetIn <= 0 {
 		return defaultInterval
 	}
@@ -318,7 +742,7 @@ func pollIntervalForRateLimit(rl *ghactions.RateLimit, defaultInterval time.Dura
 	return safe
 }
 
-var errNoWorkflowRuns = errors.New("github-actions: no workflow runs found")
+var errNoWorkflowRuns error = &noRunsError{msg: "github-actions: no workflow runs found"}
 
 // otherRemoteResult holds information about workflow runs found on a
 // non-primary remote.
@@ -337,38 +761,53 @@ func checkOtherRemotes(ctx context.Context, currentRemoteName, tip string) []oth
 		slog.Debug("could not list git remotes", "error", err)
 		return nil
 	}
+	names := slices.DeleteFunc(remoteNames, func(name string) bool {
+		return name == currentRemoteName
+	})
+	// Each remote may be on a different host, with its own client and rate
+	// limit, so there's no single budget to watch.
+	found := make([]*otherRemoteResult, len(names))
+	fanOut(len(names), nil, func(i int) {
+		found[i] = queryOtherRemote(ctx, names[i], tip)
+	})
 	var results []otherRemoteResult
-	for _, name := range remoteNames {
-		if name == currentRemoteName {
-			continue
-		}
-		remote, err := getRemoteURL(ctx, name)
-		if err != nil {
-			slog.Debug("could not get remote URL", "remote", name, "error", err)
-			continue
-		}
-		token, err := ghactions.GetToken(ctx, remote.Host)
-		if err != nil {
-			slog.Debug("could not get token for remote", "remote", name, "host", remote.Host, "error", err)
-			continue
-		}
-		client := ghactions.NewClient(token, remote.Host)
-		runs, err := client.Repo(remote.Path, remote.RepoName).FindWorkflowRunsForCommit(ctx, tip)
-		if err != nil {
-			slog.Debug("could not query workflow runs on remote", "remote", name, "error", err)
-			continue
-		}
-		if len(runs) > 0 {
-			results = append(results, otherRemoteResult{
-				RemoteName: name,
-				Remote:     remote,
-				Runs:       runs,
-			})
+	for _, r := range found {
+		if r != nil {
+			results = append(results, *r)
 		}
 	}
 	return results
 }
 
+// queryOtherRemote looks for workflow runs for tip on the named remote. It
+// returns nil if there are none, or they can't be fetched.
+func queryOtherRemote(ctx context.Context, name, tip string) *otherRemoteResult {
+	remote, err := getRemoteURL(ctx, name)
+	if err != nil {
+		slog.Debug("could not get remote URL", "remote", name, "error", err)
+		return nil
+	}
+	token, err := getToken(ctx, remote.Host)
+	if err != nil {
+		slog.Debug("could not get token for remote", "remote", name, "host", remote.Host, "error", err)
+		return nil
+	}
+	client, err := newClient(token, remote)
+	if err != nil {
+		slog.Debug("could not configure client for remote", "remote", name, "host", remote.Host, "error", err)
+		return nil
+	}
+	runs, err := client.Repo(remote.Path, remote.RepoName).FindWorkflowRunsForCommit(ctx, tip)
+	if err != nil {
+		slog.Debug("could not query workflow runs on remote", "remote", name, "error", err)
+		return nil
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+	return &otherRemoteResult{RemoteName: name, Remote: remote, Runs: runs}
+}
+
 // printOtherRemoteHints prints suggestions for any workflow runs found on other
 // remotes. Returns true if any results were printed.
 func printOtherRemoteHints(results []otherRemoteResult) bool {
@@ -378,11 +817,7 @@ func printOtherRemoteHints(results []otherRemoteResult) bool {
 	fmt.Println()
 	for _, r := range results {
 		run := r.Runs[0]
-		status := run.Status
-		if run.IsCompleted() && run.Conclusion != nil {
-			status = *run.Conclusion
-		}
-		fmt.Printf("Found workflow runs on remote %q (%s/%s): %s\n", r.RemoteName, r.Remote.Path, r.Remote.RepoName, status)
+		fmt.Printf("Found workflow runs on remote %q (%s/%s): %s\n", r.RemoteName, r.Remote.Path, r.Remote.RepoName, run.StatusText())
 		fmt.Printf("  Try: github-actions wait --remote %s\n", r.RemoteName)
 		fmt.Printf("  URL: %s\n", run.HTMLURL)
 	}
@@ -483,24 +918,27 @@ func networkStallBudget(runs []ghactions.WorkflowRun) time.Duration {
 	return clampDuration(2*time.Minute+remaining/2, minBudget, maxBudget)
 }
 
-func waitTimeoutError(startTime, lastSuccessfulPollAt time.Time, tip string, runs []ghactions.WorkflowRun, lastRetryableErr error) error {
-	totalWait := formatWaitDuration(time.Since(startTime))
+func waitTimeoutError(now, startTime, lastSuccessfulPollAt time.Time, tip string, runs []ghactions.WorkflowRun, lastRetryableErr error) error {
+	totalWait := formatWaitDuration(now.Sub(startTime))
 	if lastRetryableErr != nil {
-		stalledFor := formatWaitDuration(time.Since(lastSuccessfulPollAt))
-		return fmt.Errorf("could not reach GitHub for %s after retrying (waited %s total; last error: %s)", stalledFor, totalWait, ghactions.ShortRetryableError(lastRetryableErr))
+		stalledFor := formatWaitDuration(now.Sub(lastSuccessfulPollAt))
+		return &unreachableError{
+			msg: fmt.Sprintf("could not reach GitHub for %s after retrying (waited %s total; last error: %s)", stalledFor, totalWait, ghactions.ShortRetryableError(lastRetryableErr)),
+			err: lastRetryableErr,
+		}
 	}
 	if len(runs) == 0 {
-		return fmt.Errorf("timed out after waiting %s for workflow runs to appear for %s (hit --timeout, not a network error; increase it if they usually start later)", totalWait, shortRef(tip))
+		return &timeoutError{msg: fmt.Sprintf("timed out after waiting %s for workflow runs to appear for %s (hit --timeout, not a network error; increase it if they usually start later)", totalWait, shortRef(tip))}
 	}
-	return fmt.Errorf("timed out after waiting %s for workflow runs to complete (hit --timeout, not a network error; increase it if this branch usually runs longer)", totalWait)
+	return &timeoutError{msg: fmt.Sprintf("timed out after waiting %s for workflow runs to complete (hit --timeout, not a network error; increase it if this branch usually runs longer)", totalWait)}
 }
 
-func waitErrorForRetryablePollFailure(ctx context.Context, startTime, lastSuccessfulPollAt time.Time, tip string, runs []ghactions.WorkflowRun, lastRetryableErr error) error {
+func waitErrorForRetryablePollFailure(ctx context.Context, now, startTime, lastSuccessfulPollAt time.Time, tip string, runs []ghactions.WorkflowRun, lastRetryableErr error) error {
 	if ctx.Err() != nil {
-		return waitTimeoutError(startTime, lastSuccessfulPollAt, tip, runs, nil)
+		return waitTimeoutError(now, startTime, lastSuccessfulPollAt, tip, runs, nil)
 	}
-	if time.Since(lastSuccessfulPollAt) >= networkStallBudget(runs) {
-		return waitTimeoutError(startTime, lastSuccessfulPollAt, tip, runs, lastRetryableErr)
+	if now.Sub(lastSuccessfulPollAt) >= networkStallBudget(runs) {
+		return waitTimeoutError(now, startTime, lastSuccessfulPollAt, tip, runs, lastRetryableErr)
 	}
 	return nil
 }
@@ -514,6 +952,8 @@ func pluralize(count int, singular string) string {
 
 func workflowRunIdentifier(run ghactions.WorkflowRun) string {
 	switch {
+	case run.RunNumber > 0 && run.RunAttempt > 1:
+		return fmt.Sprintf("run %d, attempt %d", run.RunNumber, run.RunAttempt)
 	case run.RunNumber > 0:
 		return fmt.Sprintf("run %d", run.RunNumber)
 	default:
@@ -529,6 +969,90 @@ func workflowRunDisplayName(run ghactions.WorkflowRun) string {
 	return fmt.Sprintf("%s [%s]", run.Name, id)
 }
 
+// firstFailedJob returns the first job that failed, or nil if none have.
+func firstFailedJob(jobs []ghactions.Job) *ghactions.Job {
+	for i := range jobs {
+		if jobs[i].Failed() {
+			return &jobs[i]
+		}
+	}
+	return nil
+}
+
+// groupByWorkflow returns runs with the runs of each workflow next to each
+// other, keeping the order in which workflows first appear.
+func groupByWorkflow(runs []ghactions.WorkflowRun) []ghactions.WorkflowRun {
+	order := make(map[int64]int, len(runs))
+	for _, run := range runs {
+		if _, ok := order[run.WorkflowID]; !ok {
+			order[run.WorkflowID] = len(order)
+		}
+	}
+	grouped := slices.Clone(runs)
+	slices.SortStableFunc(grouped, func(a, b ghactions.WorkflowRun) int {
+		return order[a.WorkflowID] - order[b.WorkflowID]
+	})
+	return grouped
+}
+
+// runNames returns the names of runs as a comma separated list.
+func runNames(runs []ghactions.WorkflowRun) string {
+	names := make([]string, 0, len(runs))
+	for _, run := range runs {
+		names = append(names, run.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// commitAnnotations fetches the annotations of every job for the commit sha
+// in one GraphQL query, so failure reports don't need a REST call per failed
+// job. It returns an empty map if useGraphQL is false or the query fails, and
+// the reports fall back to the REST API.
+func commitAnnotations(ctx context.Context, repoSvc *ghactions.RepoService, sha string, useGraphQL bool) map[int64][]ghactions.Annotation {
+	if !useGraphQL {
+		return map[int64][]ghactions.Annotation{}
+	}
+	annotations, err := repoSvc.AnnotationsForCommit(ctx, sha)
+	if err != nil {
+		slog.Debug("could not get annotations with GraphQL, using the REST API", "error", err)
+		return map[int64][]ghactions.Annotation{}
+	}
+	return annotations
+}
+
+// writeFailedRun writes the summary of a failed run: its jobs, and the
+// annotations and log excerpt of its failed jobs. Unless opts.FailFast is
+// set, it starts with a line naming the workflow, to tell several failed runs
+// apart. With opts.WorkflowCommands, the summary is in a collapsible group.
+// It returns the run's report, for writeErrorCommands once the failure is
+// final. annotations are the check run annotations already fetched, from
+// commitAnnotations.
+func writeFailedRun(ctx context.Context, w io.Writer, client *ghactions.Client, remote *RemoteURL, run ghactions.WorkflowRun, opts waitOptions, annotations map[int64][]ghactions.Annotation, summary *stepSummary) *ghactions.RunReport {
+	rep := client.NewRunReport(ctx, remote.Path, remote.RepoName, run, ghactions.RunReportOptions{
+		Failures:    true,
+		OutputLines: opts.NumOutputLines,
+		Annotations: annotations,
+	})
+	summary.addReport(rep)
+
+	title := fmt.Sprintf("Workflow %q failed", run.Name)
+	if identifier := workflowRunIdentifier(run); identifier != "" {
+		title = fmt.Sprintf("Workflow %q (%s) failed", run.Name, identifier)
+	}
+	switch {
+	case opts.WorkflowCommands:
+		fmt.Fprintf(w, "::group::%s\n", escapeCommandData(title))
+	case !opts.FailFast:
+		fmt.Fprintf(w, "\n%s\n", title)
+	}
+	w.Write(client.FormatRunReport(rep))
+	fmt.Fprintf(w, "\nURL:\n%s\n", run.HTMLURL)
+	if opts.WorkflowCommands {
+		fmt.Fprintln(w, "::endgroup::")
+	}
+	return rep
+}
+
 func hasWorkflowRunsForCommit(tip string, runs []ghactions.WorkflowRun) bool {
 	for _, run := range runs {
 		if run.HeadSha == tip {
@@ -552,6 +1076,17 @@ func cancelableWorkflowRuns(tip string, runs []ghactions.WorkflowRun) []ghaction
 	return cancelable
 }
 
+// headBranchForCommit returns the branch (or, for a tag push, the tag) that a
+// run for tip was triggered on, or an empty string if none of runs say.
+func headBranchForCommit(tip string, runs []ghactions.WorkflowRun) string {
+	for _, run := range runs {
+		if run.HeadSha == tip && run.HeadBranch != "" {
+			return run.HeadBranch
+		}
+	}
+	return ""
+}
+
 func activeWorkflows(workflows []ghactions.Workflow) []ghactions.Workflow {
 	active := make([]ghactions.Workflow, 0, len(workflows))
 	for _, workflow := range workflows {
@@ -568,9 +1103,9 @@ func workflowConfigurationError(owner, repo string, workflows *ghactions.Workflo
 		return nil
 	}
 	if workflows.TotalCount == 0 {
-		return fmt.Errorf("no workflow files found in %s/%s; add a .github/workflows/*.yml file to enable GitHub Actions", owner, repo)
+		return &noRunsError{msg: fmt.Sprintf("no workflow files found in %s/%s; add a .github/workflows/*.yml file to enable GitHub Actions", owner, repo)}
 	}
-	return fmt.Errorf("all %d workflows in %s/%s are disabled; enable at least one to run GitHub Actions", workflows.TotalCount, owner, repo)
+	return &noRunsError{msg: fmt.Sprintf("all %d workflows in %s/%s are disabled; enable at least one to run GitHub Actions", workflows.TotalCount, owner, repo)}
 }
 
 func workflowURL(remote *RemoteURL, workflow ghactions.Workflow) string {
@@ -613,9 +1148,10 @@ func doConfigured(ctx context.Context, client *ghactions.Client, remote *RemoteU
 	return workflowConfigurationStatusConfigured, nil
 }
 
-func cancelPreviousRunsForTip(ctx context.Context, client *ghactions.Client, remote *RemoteURL, remoteName, branch, tip string, quietWhenNoRuns bool) error {
+func cancelPreviousRunsForTip(ctx context.Context, client *ghactions.Client, remote *RemoteURL, remoteName, branch, tip string, quietWhenNoRuns bool, opts cancelOptions) error {
 	owner, repo := remote.Path, remote.RepoName
-	runs, err := client.Repo(owner, repo).FindWorkflowRunsForBranch(ctx, branch)
+	repoSvc := client.Repo(owner, repo)
+	runs, err := repoSvc.FindWorkflowRunsForBranch(ctx, branch)
 	if err != nil {
 		return fmt.Errorf("listing workflow runs: %w", err)
 	}
@@ -629,97 +1165,308 @@ func cancelPreviousRunsForTip(ctx context.Context, client *ghactions.Client, rem
 		return errNoWorkflowRuns
 	}
 
-	cancelable := cancelableWorkflowRuns(tip, runs)
-	var cancelled int
-	for _, run := range cancelable {
-		slog.Debug("cancelling run", "id", run.ID, "name", run.Name, "sha", shortRef(run.HeadSha))
-		if err := client.Repo(owner, repo).CancelWorkflowRun(ctx, run.ID); err != nil {
-			return fmt.Errorf("cancelling run %d (%s): %w", run.ID, run.Name, err)
-		}
-		identifier := workflowRunIdentifier(run)
-		if identifier == "" {
-			fmt.Printf("Cancelled %q (commit %s)\n", run.Name, shortRef(run.HeadSha))
-		} else {
-			fmt.Printf("Cancelled %q (%s, commit %s)\n", run.Name, identifier, shortRef(run.HeadSha))
-		}
-		cancelled++
-	}
-
-	if cancelled == 0 {
+	cancelable := opts.Filter.apply(time.Now(), cancelableWorkflowRuns(tip, runs))
+	if len(cancelable) == 0 {
 		fmt.Printf("No older workflow runs to cancel on %s (tip: %s)\n", branch, shortRef(tip))
-	} else {
-		fmt.Printf("Cancelled %d older %s on %s\n", cancelled, pluralize(cancelled, "workflow run"), branch)
+		return nil
 	}
-	return nil
+	return cancelAndSummarize(ctx, os.Stdout, repoSvc, cancelable, opts, "older than the tip of "+branch)
 }
 
-func cancelPreviousRunsOnBranch(ctx context.Context, client *ghactions.Client, remote *RemoteURL, remoteName, branch string, quietWhenNoRuns bool) (string, error) {
-	tip, err := gitTip(ctx, branch)
-	if err != nil {
-		return "", err
+// pendingDeployments holds the deployments each waiting run is held on, as
+// listed by ListPendingDeployments. A run missing from the map hasn't been
+// looked up, or the lookup failed.
+type pendingDeployments map[int64][]ghactions.PendingDeployment
+
+// blocked reports whether run won't make progress until someone acts on it.
+// A run held only by environment wait timers, with no required reviewers,
+// carries on by itself once the timers expire, so it isn't blocked. A
+// waiting run whose deployments are unknown counts as blocked.
+func (p pendingDeployments) blocked(run ghactions.WorkflowRun) bool {
+	if !run.NeedsAttention() {
+		return false
+	}
+	if run.Status != ghactions.StatusWaiting {
+		return true
 	}
-	return tip, cancelPreviousRunsForTip(ctx, client, remote, remoteName, branch, tip, quietWhenNoRuns)
+	deployments := p[run.ID]
+	return len(deployments) == 0 || needsReview(deployments)
 }
 
-func doCancel(ctx context.Context, client *ghactions.Client, remote *RemoteURL, remoteName, branch string) error {
-	_, err := cancelPreviousRunsOnBranch(ctx, client, remote, remoteName, branch, false)
-	return err
+// needsReview reports whether any of deployments has required reviewers.
+func needsReview(deployments []ghactions.PendingDeployment) bool {
+	for _, d := range deployments {
+		if len(d.Reviewers) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
-func doOpen(ctx context.Context, client *ghactions.Client, remote *RemoteURL, remoteName, branch string) error {
-	tip, err := gitTip(ctx, branch)
-	if err != nil {
-		return err
+// needsRefresh reports whether a waiting run's pending deployments should be
+// listed again: they haven't been listed yet, or the run was only held by
+// wait timers that have since expired, so it may be held on another
+// environment now.
+func (p pendingDeployments) needsRefresh(runID int64, now time.Time) bool {
+	deployments, ok := p[runID]
+	if !ok || len(deployments) == 0 {
+		return true
 	}
+	if needsReview(deployments) {
+		return false
+	}
+	for _, d := range deployments {
+		if end, ok := d.WaitTimerEndsAt(); ok && now.Before(end) {
+			return false
+		}
+	}
+	return true
+}
 
-	owner, repo := remote.Path, remote.RepoName
-	checkedOtherRemotes := false
-
-	for {
-		runs, err := client.Repo(owner, repo).FindWorkflowRunsForCommit(ctx, tip)
+// refresh lists the pending deployments of the waiting runs that need it,
+// and forgets runs that are no longer waiting. It returns the IDs of the runs
+// it listed deployments for.
+func (p pendingDeployments) refresh(ctx context.Context, repoSvc *ghactions.RepoService, runs []ghactions.WorkflowRun, now time.Time) []int64 {
+	var listed []int64
+	for _, run := range runs {
+		if run.Status != ghactions.StatusWaiting {
+			delete(p, run.ID)
+			continue
+		}
+		if !p.needsRefresh(run.ID, now) {
+			continue
+		}
+		deployments, err := repoSvc.ListPendingDeployments(ctx, run.ID)
 		if err != nil {
-			if isHttpError(err) {
-				fmt.Printf("Caught network error: %s. Continuing\n", err.Error())
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case <-time.After(2 * time.Second):
-				}
-				continue
-			}
-			return err
+			slog.Debug("could not list pending deployments", "run_id", run.ID, "error", err)
+			continue
 		}
+		p[run.ID] = deployments
+		listed = append(listed, run.ID)
+	}
+	return listed
+}
 
-		if len(runs) == 0 {
-			if !checkedOtherRemotes {
-				checkedOtherRemotes = true
-				results := checkOtherRemotes(ctx, remoteName, tip)
-				if printOtherRemoteHints(results) {
-					return errNoWorkflowRuns
+// attentionReason describes why a run is waiting. deployments are the
+// deployments a waiting run is held on, if known.
+func attentionReason(run ghactions.WorkflowRun, deployments []ghactions.PendingDeployment) string {
+	if run.Status == ghactions.StatusWaiting {
+		environments := environmentNames(deployments)
+		switch {
+		case len(deployments) > 0 && !needsReview(deployments):
+			reason := "waiting for the wait timer on " + strings.Join(environments, ", ")
+			var end time.Time
+			for _, d := range deployments {
+				if e, ok := d.WaitTimerEndsAt(); ok && e.After(end) {
+					end = e
 				}
 			}
-			fmt.Printf("No workflow runs found for %s yet, waiting...\n", tip[:8])
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(5 * time.Second):
+			if !end.IsZero() {
+				reason += " (until " + end.Local().Format("15:04") + ")"
 			}
-			continue
+			return reason
+		case len(environments) > 0:
+			return "waiting for approval to deploy to " + strings.Join(environments, ", ")
 		}
+		return "waiting for a deployment to be approved"
+	}
+	return "waiting for a maintainer to approve the run"
+}
 
-		// Open the first (most recent) run
-		run := runs[0]
-		if err := openURL(run.HTMLURL); err != nil {
-			return err
+// needsAttentionError returns an error listing the runs that need someone to
+// act on them, once nothing else is left running. It returns nil if no run
+// needs attention, or if other runs are still in progress, including runs
+// held only by a deployment wait timer.
+func needsAttentionError(t target, runs []ghactions.WorkflowRun, pending pendingDeployments) error {
+	var blocked []ghactions.WorkflowRun
+	deploying := false
+	for _, run := range runs {
+		switch {
+		case pending.blocked(run):
+			blocked = append(blocked, run)
+			deploying = deploying || run.Status == ghactions.StatusWaiting
+		case !run.IsCompleted():
+			return nil
 		}
+	}
+	if len(blocked) == 0 {
 		return nil
 	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "build on %s is blocked until someone acts on it:", t)
+	for _, run := range blocked {
+		fmt.Fprintf(&sb, "\n  %s: %s\n    %s", run.Name, attentionReason(run, pending[run.ID]), run.HTMLURL)
+	}
+	if deploying {
+		fmt.Fprintf(&sb, "\nRun \"github-actions approve %s\" to approve the deployments.", t.arg())
+	}
+	return &needsAttentionErr{msg: sb.String()}
 }
 
-func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, remoteName, branch string, numOutputLines int, quiet, cancelPreviousRuns bool, noRunsTimeout time.Duration) error {
-	tip, err := gitTip(ctx, branch)
-	if err != nil {
-		return err
+// waitOptions configures the wait subcommand.
+type waitOptions struct {
+	// NumOutputLines is the number of lines of failed job output to print.
+	NumOutputLines     int
+	Quiet              bool
+	CancelPreviousRuns bool
+	// Push pushes the target to the remote before waiting.
+	Push bool
+	// SkipPushCheck skips checking whether the target is on the remote,
+	// e.g. because it was just pushed.
+	SkipPushCheck bool
+	// NoRunsTimeout is how long to wait for runs to appear; zero waits
+	// forever.
+	NoRunsTimeout time.Duration
+	// RerunGrace, if positive, gives a failed run that long after it
+	// completes to be re-run before the build counts as failed.
+	RerunGrace time.Duration
+	// GraphQL fetches the jobs of every run in one GraphQL query, instead of
+	// one REST request per run.
+	GraphQL bool
+	// WorkflowCommands wraps failure output in ::group:: and reports
+	// failed jobs with ::error, for a GitHub Actions job's log.
+	WorkflowCommands bool
+	// StepSummary is the file to append a Markdown report to, from
+	// $GITHUB_STEP_SUMMARY.
+	StepSummary string
+	// FailFast stops waiting at the first failed run or job, instead of
+	// waiting for every run to finish and reporting all the failures.
+	FailFast bool
+	// Interactive lets the user select runs and jobs in the status table
+	// and act on them with the keyboard.
+	Interactive bool
+	// Workflows limits which runs are waited on.
+	Workflows workflowFilter
+	Notify    ghactions.NotifySettings
+	// Clock is what wait polls and times out by; nil is the wall clock.
+	Clock clock
+}
+
+// clock is a source of time. Under --replay it is the Replayer, so wait's
+// sleeps between polls are sped up like the responses, and its timeouts run
+// on the recording's time.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// waitClock returns the clock for wait to poll by: the replay's, with
+// --replay, or else the wall clock.
+func waitClock() clock {
+	if replayer != nil {
+		return replayer
+	}
+	return realClock{}
+}
+
+// withTimeout is context.WithTimeout on waitClock's time.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if replayer != nil {
+		return replayer.WithTimeout(ctx, d)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// waitFlags holds the flags that control waiting, shared by the wait and push
+// subcommands.
+type waitFlags struct {
+	outputLines        *int
+	timeout            *time.Duration
+	noRunsTimeout      *time.Duration
+	quiet              *bool
+	cancelPreviousRuns *bool
+	followReruns       *bool
+	rerunGrace         *time.Duration
+	rawLogs            *bool
+	graphql            *bool
+	failFast           *bool
+	interactive        *bool
+	workflows          stringsFlag
+	excludeWorkflows   stringsFlag
+}
+
+func addWaitFlags(fs *flag.FlagSet) *waitFlags {
+	f := &waitFlags{
+		outputLines:        fs.Int("failed-output-lines", 100, "Number of lines of failed output to display"),
+		timeout:            fs.Duration("timeout", time.Hour, "Maximum time to wait"),
+		noRunsTimeout:      fs.Duration("no-runs-timeout", 2*time.Minute, "How long to wait for runs to appear before giving up (0 to disable)"),
+		quiet:              fs.Bool("quiet", false, "Only print final output, not periodic status updates"),
+		cancelPreviousRuns: fs.Bool("cancel-previous-runs", false, "Cancel older queued or in-progress workflow runs before waiting"),
+		followReruns:       fs.Bool("follow-reruns", false, "If a run fails, keep waiting in case it is re-run"),
+		rerunGrace:         fs.Duration("rerun-grace", 5*time.Minute, "With --follow-reruns, how long after a failed run finishes to wait for a re-run"),
+		rawLogs:            fs.Bool("raw-logs", false, "Print failed job output exactly as GitHub returns it, with timestamps and ##[group] markers"),
+		graphql:            fs.Bool("graphql", true, "Check the jobs of all runs with one GraphQL query, falling back to the REST API if it fails"),
+		failFast:           fs.Bool("fail-fast", false, "Stop at the first failed run or job, instead of waiting for every run and reporting all the failures"),
+		interactive:        fs.Bool("interactive", false, "On a terminal, select runs and jobs with the arrow keys to open, cancel or re-run them, or see their logs"),
+	}
+	fs.Var(&f.workflows, "workflow", "Only wait for runs of workflows matching this glob (name or file name; repeatable)")
+	fs.Var(&f.excludeWorkflows, "exclude-workflow", "Don't wait for runs of workflows matching this glob (repeatable)")
+	return f
+}
+
+// options returns the waitOptions set by the flags.
+func (f *waitFlags) options(notify ghactions.NotifySettings) waitOptions {
+	opts := waitOptions{
+		NumOutputLines:     *f.outputLines,
+		Quiet:              *f.quiet,
+		CancelPreviousRuns: *f.cancelPreviousRuns,
+		NoRunsTimeout:      *f.noRunsTimeout,
+		GraphQL:            *f.graphql,
+		FailFast:           *f.failFast,
+		Interactive:        *f.interactive,
+		Workflows:          workflowFilter{Include: f.workflows, Exclude: f.excludeWorkflows},
+		Notify:             notify,
+		Clock:              waitClock(),
+	}
+	if *f.followReruns {
+		opts.RerunGrace = *f.rerunGrace
+	}
+	return opts
+}
+
+// notify announces that wait has finished with msg, unless notifications are
+// turned off.
+func notify(settings ghactions.NotifySettings, repo, msg string) {
+	if settings.RingBell() {
+		fmt.Print("\a")
+	}
+	if !settings.IsEnabled() {
+		return
+	}
+	c := bigtext.Client{
+		Name: "github-actions (" + repo + ")",
+	}
+	c.Display(msg)
+}
+
+// doWait waits for the runs on t to finish.
+func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, remoteName string, t target, opts waitOptions) (err error) {
+	tip := t.SHA
+
+	var summary *stepSummary
+	if opts.StepSummary != "" {
+		summary = newStepSummary(opts.StepSummary, t, remote, client.RawLogs)
+		defer func() { summary.write(err) }()
+	}
+
+	// GitHub can't run workflows for a commit it hasn't seen. Push it, or
+	// warn right away instead of waiting out --no-runs-timeout.
+	unpushed := false
+	if opts.Push {
+		if err := pushTarget(ctx, os.Stderr, remoteName, t); err != nil {
+			return err
+		}
+	} else if !opts.SkipPushCheck {
+		if check := checkPushed(ctx, remoteName, t); check.unpushed() {
+			unpushed = true
+			fmt.Fprintf(os.Stderr, "Warning: %s. No workflows will run for %s until it is pushed; run \"git push\" or pass --push.\n", check, shortRef(tip))
+		}
 	}
 
 	owner, repo := remote.Path, remote.RepoName
@@ -737,68 +1484,104 @@ func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, re
 		}
 	}
 
-	renderer := newStatusRenderer(quiet)
+	clk := opts.Clock
+	if clk == nil {
+		clk = realClock{}
+	}
+	renderer := newStatusRenderer(opts.Quiet, clk)
 	cancelledPreviousRuns := false
 
-	if !quiet {
-		fmt.Println("Waiting for GitHub Actions on", branch, "to complete")
+	if !opts.Quiet {
+		fmt.Println("Waiting for GitHub Actions on", t, "to complete")
+	}
+	if opts.Interactive {
+		if err := renderer.startInteractive(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			defer renderer.stopInteractive()
+		}
 	}
+	actions := apiWaitActions{repoSvc: repoSvc, rawLogs: client.RawLogs}
 
 	var lastJobCheckAt time.Time
-	startTime := time.Now()
+	startTime := clk.Now()
 	checkedOtherRemotes := false
 	lastSuccessfulPollAt := startTime
 	var lastObservedRuns []ghactions.WorkflowRun
 	var lastRetryableErr error
+	// Why we last told the user each run is waiting, so the message isn't
+	// repeated on every poll, and the deployments waiting runs are held on.
+	reportedAttention := make(map[int64]string)
+	pending := make(pendingDeployments)
+	rerunWatcher := newRerunWatcher(opts.RerunGrace)
+	useGraphQL := opts.GraphQL
+	// Failed jobs in runs that are still going, already reported.
+	reportedJobs := make(map[int64]bool)
 
 	for {
-		runs, err := repoSvc.FindWorkflowRunsForCommit(ctx, tip)
+		allRuns, err := repoSvc.FindWorkflowRunsForCommit(ctx, tip)
 		if err != nil {
 			if rle, ok := ghactions.IsRateLimitError(err); ok {
-				if werr := waitForRateLimitReset(ctx, rle, quiet); werr != nil {
-					return waitTimeoutError(startTime, lastSuccessfulPollAt, tip, lastObservedRuns, nil)
+				if werr := waitForRateLimitReset(ctx, clk, rle, opts.Quiet); werr != nil {
+					return waitTimeoutError(clk.Now(), startTime, lastSuccessfulPollAt, tip, lastObservedRuns, nil)
 				}
-				lastSuccessfulPollAt = time.Now()
+				lastSuccessfulPollAt = clk.Now()
 				continue
 			}
 			if isHttpError(err) {
 				lastRetryableErr = err
-				if waitErr := waitErrorForRetryablePollFailure(ctx, startTime, lastSuccessfulPollAt, tip, lastObservedRuns, lastRetryableErr); waitErr != nil {
+				if waitErr := waitErrorForRetryablePollFailure(ctx, clk.Now(), startTime, lastSuccessfulPollAt, tip, lastObservedRuns, lastRetryableErr); waitErr != nil {
 					return waitErr
 				}
-				if !quiet {
+				if !opts.Quiet {
 					fmt.Printf("GitHub request failed: %s. Retrying\n", ghactions.ShortRetryableError(err))
 				}
 				select {
 				case <-ctx.Done():
-					return waitTimeoutError(startTime, lastSuccessfulPollAt, tip, lastObservedRuns, nil)
-				case <-time.After(2 * time.Second):
+					return waitTimeoutError(clk.Now(), startTime, lastSuccessfulPollAt, tip, lastObservedRuns, nil)
+				case <-clk.After(2 * time.Second):
 				}
 				continue
 			}
 			return err
 		}
-		lastSuccessfulPollAt = time.Now()
+		lastSuccessfulPollAt = clk.Now()
 		lastRetryableErr = nil
+		runs := opts.Workflows.apply(allRuns)
 		lastObservedRuns = append(lastObservedRuns[:0], runs...)
+		summary.setRuns(runs)
 
 		if len(runs) == 0 {
-			if !checkedOtherRemotes {
+			// If the commit has runs, but none we're waiting for, it is on
+			// the right remote; the rest may not have been triggered yet.
+			if !checkedOtherRemotes && len(allRuns) == 0 {
 				checkedOtherRemotes = true
 				results := checkOtherRemotes(ctx, remoteName, tip)
 				if printOtherRemoteHints(results) {
 					return errNoWorkflowRuns
 				}
 			}
-			if noRunsTimeout > 0 && time.Since(startTime) >= noRunsTimeout {
-				return fmt.Errorf("no workflow runs appeared for %s after %s (workflows exist but none triggered for this commit; check workflow trigger conditions, or increase --no-runs-timeout)", shortRef(tip), formatWaitDuration(time.Since(startTime)))
+			if opts.NoRunsTimeout > 0 && clk.Now().Sub(startTime) >= opts.NoRunsTimeout {
+				if unpushed {
+					if check := checkPushed(ctx, remoteName, t); check.unpushed() {
+						return &noRunsError{msg: fmt.Sprintf("no workflow runs appeared for %s after %s: %s (run \"git push\" or pass --push)", shortRef(tip), formatWaitDuration(clk.Now().Sub(startTime)), check)}
+					}
+				}
+				if len(allRuns) > 0 {
+					return &noRunsError{msg: fmt.Sprintf("none of the %d workflow runs for %s are %s after %s (check --workflow and --exclude-workflow, and the [workflows] config)", len(allRuns), shortRef(tip), opts.Workflows, formatWaitDuration(clk.Now().Sub(startTime)))}
+				}
+				return &noRunsError{msg: fmt.Sprintf("no workflow runs appeared for %s after %s (workflows exist but none triggered for this commit; check workflow trigger conditions, or increase --no-runs-timeout)", shortRef(tip), formatWaitDuration(clk.Now().Sub(startTime)))}
+			}
+			if len(allRuns) > 0 {
+				renderer.renderWaiting(fmt.Sprintf("No workflow runs for %s %s yet, waiting...", shortRef(tip), opts.Workflows))
+			} else {
+				renderer.renderWaiting(fmt.Sprintf("No workflow runs found for %s yet, waiting...", shortRef(tip)))
 			}
-			renderer.renderWaiting(fmt.Sprintf("No workflow runs found for %s yet, waiting...", shortRef(tip)))
-			noRunsInterval := pollIntervalForRateLimit(client.RateLimit(), 5*time.Second)
+			noRunsInterval := pollIntervalForRateLimit(clk.Now(), client.RateLimit(), 5*time.Second)
 			select {
 			case <-ctx.Done():
-				return waitTimeoutError(startTime, lastSuccessfulPollAt, tip, lastObservedRuns, lastRetryableErr)
-			case <-time.After(noRunsInterval):
+				return waitTimeoutError(clk.Now(), startTime, lastSuccessfulPollAt, tip, lastObservedRuns, lastRetryableErr)
+			case <-clk.After(noRunsInterval):
 			}
 			continue
 		}
@@ -807,8 +1590,26 @@ func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, re
 		// so cursor-based overwriting from render() stays in sync.
 		renderer.clearStatus()
 
-		if cancelPreviousRuns && !cancelledPreviousRuns && hasWorkflowRunsForCommit(tip, runs) {
-			if err := cancelPreviousRunsForTip(ctx, client, remote, remoteName, branch, tip, true); err != nil {
+		for _, run := range rerunWatcher.reruns(runs) {
+			// The cached jobs belong to the previous attempt.
+			renderer.setJobs(run.ID, nil)
+			if !opts.Quiet {
+				fmt.Printf("Workflow %q was re-run (attempt %d), waiting for it to finish\n", run.Name, run.RunAttempt)
+			}
+		}
+
+		if opts.CancelPreviousRuns && !cancelledPreviousRuns && hasWorkflowRunsForCommit(tip, runs) {
+			// Without a branch name, e.g. on a detached HEAD, cancel runs on
+			// the branch GitHub says the commit was pushed to.
+			branch := t.Branch
+			if branch == "" {
+				branch = headBranchForCommit(tip, runs)
+			}
+			if branch == "" {
+				if !opts.Quiet {
+					fmt.Printf("Not cancelling previous runs: no branch found for %s\n", t)
+				}
+			} else if err := cancelPreviousRunsForTip(ctx, client, remote, remoteName, branch, tip, true, cancelOptions{}); err != nil {
 				return err
 			}
 			cancelledPreviousRuns = true
@@ -816,52 +1617,110 @@ func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, re
 
 		// Fetch duration estimates once
 		if !renderer.estimatesDone {
-			renderer.fetchEstimates(ctx, repoSvc, runs)
+			renderer.fetchEstimates(ctx, repoSvc, runs, client.RateLimit)
 		}
 
-		// Check if all runs are complete
+		// A run held only by a deployment wait timer will go ahead by
+		// itself, so look up what waiting runs are held on.
+		for _, id := range pending.refresh(ctx, repoSvc, runs, clk.Now()) {
+			renderer.setEnvironments(id, environmentNames(pending[id]))
+		}
+
+		// Check if all runs are complete. settled is true once nothing is
+		// running: every run has completed, or is blocked until someone
+		// acts on it.
 		allComplete := true
+		settled := true
 		anyFailed := false
 		var failedRun *ghactions.WorkflowRun
+		var failedRuns []ghactions.WorkflowRun
 
 		for i := range runs {
 			run := &runs[i]
 			if !run.IsCompleted() {
 				allComplete = false
+				settled = settled && pending.blocked(*run)
 			}
 			if run.IsFailed() {
 				anyFailed = true
+				failedRuns = append(failedRuns, *run)
 				if failedRun == nil {
 					failedRun = run
 				}
 			}
 		}
 
-		elapsed := time.Since(startTime).Round(time.Second)
+		elapsed := clk.Now().Sub(startTime).Round(time.Second)
 
 		// Check for early job failures in in-progress runs. We throttle
 		// these checks to avoid excessive API calls - check every 15
 		// seconds, and only after the runs have been going for at least
 		// 30 seconds (to let jobs start up).
-		if !allComplete && !anyFailed && elapsed > 30*time.Second && time.Since(lastJobCheckAt) > 15*time.Second {
-			lastJobCheckAt = time.Now()
+		if !allComplete && !(anyFailed && opts.FailFast) && elapsed > 30*time.Second && clk.Now().Sub(lastJobCheckAt) > 15*time.Second {
+			lastJobCheckAt = clk.Now()
+			var jobsByRun map[int64][]ghactions.Job
+			if useGraphQL {
+				jobsByRun, err = repoSvc.JobsForCommit(ctx, tip)
+				if err != nil {
+					// The token may not be allowed to use GraphQL, or an
+					// older GitHub Enterprise Server may not support the
+					// query. Don't try again.
+					slog.Debug("could not get jobs with GraphQL, using the REST API", "error", err)
+					useGraphQL = false
+				}
+			}
+			// Fetch the jobs GraphQL didn't return concurrently, then look
+			// at them in run order.
+			jobs := make([][]ghactions.Job, len(runs))
+			jobErrs := make([]error, len(runs))
+			var missing []int
+			for i := range runs {
+				if runs[i].IsCompleted() {
+					continue
+				}
+				if runJobs, ok := jobsByRun[runs[i].ID]; ok {
+					jobs[i] = runJobs
+				} else {
+					missing = append(missing, i)
+				}
+			}
+			fanOut(len(missing), client.RateLimit, func(j int) {
+				i := missing[j]
+				jobs[i], jobErrs[i] = repoSvc.ListAllJobs(ctx, runs[i].ID)
+			})
 			for i := range runs {
 				run := &runs[i]
 				if run.IsCompleted() {
 					continue
 				}
-				failedJob, err := repoSvc.FindFailedJob(ctx, run.ID)
-				if err != nil {
+				if err := jobErrs[i]; err != nil {
 					// Non-fatal: log and continue polling normally.
-					if !quiet {
+					if !opts.Quiet {
 						fmt.Printf("Error checking jobs for %q: %v\n", run.Name, err)
 					}
 					continue
 				}
-				if failedJob != nil {
+				// The job list doubles as input for the per-job ETA.
+				renderer.setJobs(run.ID, jobs[i])
+				if !opts.FailFast {
+					// Keep waiting for the rest of the build, but say
+					// which jobs have failed so far.
+					for _, job := range jobs[i] {
+						if !job.Failed() || reportedJobs[job.ID] {
+							continue
+						}
+						reportedJobs[job.ID] = true
+						if !opts.Quiet {
+							renderer.clearStatus()
+							fmt.Printf("Job %q failed in workflow %q (run still in progress)\n", job.Name, run.Name)
+						}
+					}
+					continue
+				}
+				if failedJob := firstFailedJob(jobs[i]); failedJob != nil {
 					anyFailed = true
 					failedRun = run
-					if !quiet {
+					if !opts.Quiet {
 						fmt.Printf("Job %q failed in workflow %q (run still in progress)\n", failedJob.Name, run.Name)
 					}
 					break
@@ -869,18 +1728,82 @@ func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, re
 			}
 		}
 
-		if allComplete || anyFailed {
-			renderer.clearStatus()
-			c := bigtext.Client{
-				Name: "github-actions (" + repo + ")",
+		// With --fail-fast, the first failure ends the wait. Otherwise wait
+		// until nothing is running, so every failure can be reported.
+		failed := anyFailed && (opts.FailFast || settled)
+		// The failed runs to report, grouped by workflow: only the first
+		// with --fail-fast.
+		reportRuns := groupByWorkflow(failedRuns)
+		if opts.FailFast && failedRun != nil {
+			reportRuns = []ghactions.WorkflowRun{*failedRun}
+		}
+
+		if !failed {
+			for _, run := range runs {
+				if !run.NeedsAttention() {
+					continue
+				}
+				reason := attentionReason(run, pending[run.ID])
+				if reportedAttention[run.ID] == reason {
+					continue
+				}
+				reportedAttention[run.ID] = reason
+				if !opts.Quiet {
+					renderer.clearStatus()
+					fmt.Printf("Workflow %q is %s: %s\n", run.Name, reason, run.HTMLURL)
+				}
+			}
+			if err := needsAttentionError(t, runs, pending); err != nil {
+				renderer.clearStatus()
+				renderer.stopInteractive()
+				notify(opts.Notify, repo, "build needs approval")
+				return err
+			}
+		}
+
+		// With --follow-reruns, print the failure as soon as we see it, but
+		// keep polling in case someone re-runs the failed jobs. The ::error
+		// commands wait until the failure is final.
+		waitingForRerun := false
+		if opts.RerunGrace > 0 {
+			for _, run := range reportRuns {
+				isNew, keepWaiting := rerunWatcher.observeFailure(clk.Now(), run)
+				if isNew {
+					renderer.clearStatus()
+					annotations := commitAnnotations(ctx, repoSvc, tip, useGraphQL)
+					rerunWatcher.hold(run, writeFailedRun(ctx, os.Stdout, client, remote, run, opts, annotations, summary))
+					if !opts.Quiet {
+						fmt.Printf("\nWaiting up to %s after %q finishes for it to be re-run\n", formatWaitDuration(opts.RerunGrace), run.Name)
+					}
+				}
+				waitingForRerun = waitingForRerun || keepWaiting
 			}
+		}
 
-			if anyFailed && failedRun != nil {
-				data := client.BuildSummary(ctx, owner, repo, *failedRun, numOutputLines)
-				os.Stdout.Write(data)
-				fmt.Printf("\nURL:\n%s\n", failedRun.HTMLURL)
-				c.Display("build failed")
-				return fmt.Errorf("build on %s failed", branch)
+		if (allComplete || failed) && !waitingForRerun {
+			renderer.clearStatus()
+			renderer.stopInteractive()
+
+			if failed {
+				var annotations map[int64][]ghactions.Annotation
+				for _, run := range reportRuns {
+					rep := rerunWatcher.held(run)
+					if rep != nil {
+						// The summary was printed when the failure was first seen.
+						fmt.Printf("\n%q was not re-run within %s\n", run.Name, formatWaitDuration(opts.RerunGrace))
+					} else {
+						if annotations == nil {
+							annotations = commitAnnotations(ctx, repoSvc, tip, useGraphQL)
+						}
+						rep = writeFailedRun(ctx, os.Stdout, client, remote, run, opts, annotations, summary)
+					}
+					if opts.WorkflowCommands {
+						writeErrorCommands(os.Stdout, rep)
+					}
+					writeAttemptHistory(ctx, os.Stdout, repoSvc, run)
+				}
+				notify(opts.Notify, repo, "build failed")
+				return &buildFailedError{target: t, runs: reportRuns}
 			}
 
 			// All succeeded
@@ -892,6 +1815,9 @@ func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, re
 				}
 			}
 
+			if opts.WorkflowCommands {
+				fmt.Println("::group::Jobs")
+			}
 			for _, run := range runs {
 				identifier := workflowRunIdentifier(run)
 				if identifier == "" {
@@ -899,17 +1825,23 @@ func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, re
 				} else {
 					fmt.Printf("\nWorkflow %q (%s)\n", run.Name, identifier)
 				}
-				summary := client.BuildJobsSummary(ctx, owner, repo, run)
-				if len(summary) > 0 && summary[0] == '\n' {
-					summary = summary[1:]
+				rep := client.NewRunReport(ctx, owner, repo, run, ghactions.RunReportOptions{})
+				summary.addReport(rep)
+				table := rep.JobsTable()
+				if len(table) > 0 && table[0] == '\n' {
+					table = table[1:]
 				}
-				os.Stdout.Write(summary)
+				os.Stdout.Write(table)
+				writeAttemptHistory(ctx, os.Stdout, repoSvc, run)
+			}
+			if opts.WorkflowCommands {
+				fmt.Println("::endgroup::")
 			}
 
 			// Print summary
 			fmt.Printf("\n")
 			fmt.Println(string(bytes.Repeat([]byte{'='}, 40)))
-			fmt.Printf("Tests on %s took %s. Quitting.\n", branch, totalDuration.String())
+			fmt.Printf("Tests on %s took %s. Quitting.\n", t, totalDuration.String())
 
 			if len(runs) > 0 {
 				fmt.Printf("%s\n", runs[0].HTMLURL)
@@ -917,11 +1849,11 @@ func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, re
 					pr := runs[0].PullRequests[0]
 					fmt.Printf("https://%s/%s/%s/pull/%d\n", remote.Host, owner, repo, pr.Number)
 				} else {
-					fmt.Printf("https://%s/%s/%s/tree/%s\n", remote.Host, owner, repo, branch)
+					fmt.Printf("https://%s/%s/%s/%s\n", remote.Host, owner, repo, t.webPath())
 				}
 			}
 
-			c.Display(branch + " build complete!")
+			notify(opts.Notify, repo, t.String()+" build complete!")
 			return nil
 		}
 
@@ -934,10 +1866,12 @@ func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, re
 		// Sleep for the next poll interval, ticking the renderer once
 		// per second so elapsed durations keep advancing. The interval
 		// scales up automatically as the GitHub rate limit budget
-		// shrinks.
-		pollInterval := pollIntervalForRateLimit(client.RateLimit(), 4*time.Second)
-		nextPoll := time.After(pollInterval)
+		// shrinks. With --interactive, keys are handled as they are
+		// typed.
+		pollInterval := pollIntervalForRateLimit(clk.Now(), client.RateLimit(), 4*time.Second)
+		nextPoll := clk.After(pollInterval)
 		tick := time.NewTicker(1 * time.Second)
+		renderer.rawInput(true)
 	pollWait:
 		for {
 			select {
@@ -946,10 +1880,19 @@ func doWait(ctx context.Context, client *ghactions.Client, remote *RemoteURL, re
 				break pollWait
 			case <-tick.C:
 				renderer.render(runs)
+			case b, ok := <-renderer.keys():
+				if stop := renderer.handleKeys(ctx, b, ok, runs, actions); stop != 0 {
+					tick.Stop()
+					renderer.clearStatus()
+					renderer.stopInteractive()
+					return &stoppedError{target: t, interrupted: stop == keyInterrupt}
+				}
+				renderer.render(runs)
 			case <-ctx.Done():
 				tick.Stop()
-				return waitTimeoutError(startTime, lastSuccessfulPollAt, tip, lastObservedRuns, lastRetryableErr)
+				return waitTimeoutError(clk.Now(), startTime, lastSuccessfulPollAt, tip, lastObservedRuns, lastRetryableErr)
 			}
 		}
+		renderer.rawInput(false)
 	}
 }
@@ -4,6 +4,9 @@ import (
 	"context"
 	"net"
 	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -11,7 +14,7 @@ import (
 	ghactions "github.com/kevinburke/github-actions/lib"
 )
 
-func stringPtr(s string) *string { return &s }
+func stringPtr(c ghactions.Conclusion) *ghactions.Conclusion { return &c }
 
 func timeRef(t time.Time) *time.Time { return &t }
 
@@ -111,7 +114,7 @@ func TestNetworkStallBudget(t *testing.T) {
 
 func TestWaitTimeoutError(t *testing.T) {
 	now := time.Now()
-	err := waitTimeoutError(now.Add(-7*time.Minute), now.Add(-5*time.Minute), "0123456789abcdef", nil, &url.Error{
+	err := waitTimeoutError(now, now.Add(-7*time.Minute), now.Add(-5*time.Minute), "0123456789abcdef", nil, &url.Error{
 		Op:  "Get",
 		URL: "https://api.github.com/repos/kevinburke/github-actions/actions/runs",
 		Err: context.DeadlineExceeded,
@@ -130,7 +133,7 @@ func TestWaitTimeoutError(t *testing.T) {
 
 func TestWaitTimeoutErrorTopLevelTimeout(t *testing.T) {
 	now := time.Now()
-	err := waitTimeoutError(now.Add(-65*time.Minute), now, "0123456789abcdef", []ghactions.WorkflowRun{{Status: "in_progress"}}, nil)
+	err := waitTimeoutError(now, now.Add(-65*time.Minute), now, "0123456789abcdef", []ghactions.WorkflowRun{{Status: "in_progress"}}, nil)
 	msg := err.Error()
 	for _, want := range []string{
 		"timed out after waiting 1h5m",
@@ -145,7 +148,7 @@ func TestWaitTimeoutErrorTopLevelTimeout(t *testing.T) {
 
 func TestWaitTimeoutErrorNoRuns(t *testing.T) {
 	now := time.Now()
-	err := waitTimeoutError(now.Add(-3*time.Minute), now, "0123456789abcdef", nil, nil)
+	err := waitTimeoutError(now, now.Add(-3*time.Minute), now, "0123456789abcdef", nil, nil)
 	msg := err.Error()
 	for _, want := range []string{
 		"timed out after waiting 3m",
@@ -163,7 +166,7 @@ func TestWaitErrorForRetryablePollFailurePrefersTopLevelTimeout(t *testing.T) {
 	ctx, cancel := context.WithDeadline(context.Background(), now.Add(-time.Second))
 	defer cancel()
 
-	err := waitErrorForRetryablePollFailure(ctx, now.Add(-10*time.Second), now.Add(-3*time.Second), "0123456789abcdef", []ghactions.WorkflowRun{{Status: "in_progress"}}, &url.Error{
+	err := waitErrorForRetryablePollFailure(ctx, now, now.Add(-10*time.Second), now.Add(-3*time.Second), "0123456789abcdef", []ghactions.WorkflowRun{{Status: "in_progress"}}, &url.Error{
 		Op:  "Get",
 		URL: "https://api.github.com/repos/kevinburke/github-actions/actions/runs",
 		Err: context.DeadlineExceeded,
@@ -217,6 +220,22 @@ func TestWorkflowRunIdentifier(t *testing.T) {
 			},
 			want: "run 49",
 		},
+		{
+			name: "first_attempt",
+			run: ghactions.WorkflowRun{
+				RunNumber:  49,
+				RunAttempt: 1,
+			},
+			want: "run 49",
+		},
+		{
+			name: "rerun",
+			run: ghactions.WorkflowRun{
+				RunNumber:  49,
+				RunAttempt: 2,
+			},
+			want: "run 49, attempt 2",
+		},
 		{
 			name: "empty",
 			run:  ghactions.WorkflowRun{},
@@ -280,6 +299,113 @@ func TestCancelableWorkflowRuns(t *testing.T) {
 	}
 }
 
+func TestNeedsAttentionError(t *testing.T) {
+	approval := ghactions.WorkflowRun{
+		ID:         1,
+		Name:       "CI",
+		Status:     "completed",
+		Conclusion: stringPtr("action_required"),
+		HTMLURL:    "https://github.com/o/r/actions/runs/1",
+	}
+	deploy := ghactions.WorkflowRun{
+		ID:      2,
+		Name:    "Deploy",
+		Status:  "waiting",
+		HTMLURL: "https://github.com/o/r/actions/runs/2",
+	}
+	running := ghactions.WorkflowRun{ID: 3, Name: "Lint", Status: "in_progress"}
+	done := ghactions.WorkflowRun{ID: 4, Name: "Docs", Status: "completed", Conclusion: stringPtr("success")}
+
+	if err := needsAttentionError(target{Ref: "main", Branch: "main"}, []ghactions.WorkflowRun{done}, nil); err != nil {
+		t.Errorf("needsAttentionError(no blocked runs) = %v, want nil", err)
+	}
+	if err := needsAttentionError(target{Ref: "main", Branch: "main"}, []ghactions.WorkflowRun{approval, running}, nil); err != nil {
+		t.Errorf("needsAttentionError() = %v, want nil while another run is in progress", err)
+	}
+	err := needsAttentionError(target{Ref: "main", Branch: "main"}, []ghactions.WorkflowRun{approval, deploy, done}, pendingDeployments{2: {reviewedDeployment("production")}})
+	if err == nil {
+		t.Fatal("needsAttentionError() = nil, want error")
+	}
+	for _, want := range []string{
+		"build on main is blocked",
+		"CI: waiting for a maintainer to approve the run",
+		"Deploy: waiting for approval to deploy to production",
+		"https://github.com/o/r/actions/runs/2",
+		`github-actions approve main`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("needsAttentionError() = %q, missing %q", err, want)
+		}
+	}
+}
+
+func reviewedDeployment(env string) ghactions.PendingDeployment {
+	d := ghactions.PendingDeployment{Environment: ghactions.Environment{Name: env}}
+	r := ghactions.DeploymentReviewer{Type: "User"}
+	r.Reviewer.Login = "octocat"
+	d.Reviewers = []ghactions.DeploymentReviewer{r}
+	return d
+}
+
+func TestNeedsAttentionWaitTimer(t *testing.T) {
+	started := time.Now().Add(-time.Minute)
+	timer := ghactions.PendingDeployment{
+		Environment:        ghactions.Environment{Name: "staging"},
+		WaitTimer:          10,
+		WaitTimerStartedAt: &started,
+	}
+	deploy := ghactions.WorkflowRun{ID: 2, Name: "Deploy", Status: "waiting"}
+	tgt := target{Ref: "main", Branch: "main"}
+
+	// A deployment held only by a wait timer goes ahead by itself.
+	pending := pendingDeployments{2: {timer}}
+	if pending.blocked(deploy) {
+		t.Error("blocked() = true for a wait-timer-only deployment")
+	}
+	if err := needsAttentionError(tgt, []ghactions.WorkflowRun{deploy}, pending); err != nil {
+		t.Errorf("needsAttentionError(wait timer) = %v, want nil", err)
+	}
+	if got := attentionReason(deploy, pending[2]); !strings.Contains(got, "wait timer on staging (until ") {
+		t.Errorf("attentionReason() = %q", got)
+	}
+	if pending.needsRefresh(2, time.Now()) {
+		t.Error("needsRefresh() = true while the timer is running")
+	}
+	if !pending.needsRefresh(2, started.Add(11*time.Minute)) {
+		t.Error("needsRefresh() = false after the timer expired")
+	}
+
+	// With a required reviewer too, someone has to act.
+	pending = pendingDeployments{2: {timer, reviewedDeployment("production")}}
+	if err := needsAttentionError(tgt, []ghactions.WorkflowRun{deploy}, pending); err == nil {
+		t.Error("needsAttentionError() = nil, want an error when a reviewer is required")
+	}
+	// If the deployments couldn't be listed, assume the worst.
+	if !(pendingDeployments{}).blocked(deploy) {
+		t.Error("blocked() = false for a run whose deployments are unknown")
+	}
+}
+
+func TestGroupByWorkflow(t *testing.T) {
+	runs := []ghactions.WorkflowRun{
+		{ID: 1, Name: "CI", WorkflowID: 10},
+		{ID: 2, Name: "Lint", WorkflowID: 20},
+		{ID: 3, Name: "CI", WorkflowID: 10},
+		{ID: 4, Name: "Docs", WorkflowID: 30},
+		{ID: 5, Name: "Lint", WorkflowID: 20},
+	}
+	var got []int64
+	for _, run := range groupByWorkflow(runs) {
+		got = append(got, run.ID)
+	}
+	if want := []int64{1, 3, 2, 5, 4}; !slices.Equal(got, want) {
+		t.Errorf("groupByWorkflow() = %v, want %v", got, want)
+	}
+	if got := runNames(groupByWorkflow(runs)[:3]); got != "CI, CI, Lint" {
+		t.Errorf("runNames() = %q", got)
+	}
+}
+
 func TestActiveWorkflows(t *testing.T) {
 	workflows := []ghactions.Workflow{
 		{Name: "CI", State: "active"},
@@ -463,7 +589,7 @@ func TestPollIntervalForRateLimit(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := pollIntervalForRateLimit(tt.rl, def)
+			got := pollIntervalForRateLimit(now, tt.rl, def)
 			if got < tt.wantAtLeast || got > tt.wantAtMost {
 				t.Errorf("pollIntervalForRateLimit = %s, want in [%s, %s]", got, tt.wantAtLeast, tt.wantAtMost)
 			}
@@ -482,3 +608,61 @@ func TestHasWorkflowsHelpDocumentsExitCodes(t *testing.T) {
 		}
 	}
 }
+
+func TestHeadBranchForCommit(t *testing.T) {
+	runs := []ghactions.WorkflowRun{
+		{HeadSha: "old", HeadBranch: "main"},
+		{HeadSha: "tip", HeadBranch: ""},
+		{HeadSha: "tip", HeadBranch: "feature"},
+	}
+	if got := headBranchForCommit("tip", runs); got != "feature" {
+		t.Errorf("headBranchForCommit() = %q, want feature", got)
+	}
+	if got := headBranchForCommit("missing", runs); got != "" {
+		t.Errorf("headBranchForCommit(missing) = %q, want empty", got)
+	}
+}
+
+func TestStringsFlag(t *testing.T) {
+	var f stringsFlag
+	f.Set("CI")
+	f.Set("deploy-*, lint ,")
+	if got := f.String(); got != "CI,deploy-*,lint" {
+		t.Errorf("stringsFlag = %q, want CI,deploy-*,lint", got)
+	}
+}
+
+func TestNewClientReplay(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeRecordedCommand(dir, []string{"wait", "--sha", "abc123"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, recordedCommandFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "github-actions wait --sha abc123\n"; got != want {
+		t.Errorf("%s = %q, want %q", recordedCommandFile, got, want)
+	}
+	exchange := `{"seq":1,"method":"GET","url":"https://api.github.com/repos/o/r/actions/runs/42","status_code":200,"body":"{\"id\":42,\"status\":\"completed\"}"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, ghactions.RecordingFile), []byte(exchange), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	replayer, err = ghactions.NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { replayer = nil }()
+	client, err := newClient("", &RemoteURL{Host: "github.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := client.Repo("o", "r").GetWorkflowRun(context.Background(), 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != ghactions.StatusCompleted {
+		t.Errorf("replayed status = %q, want completed", run.Status)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+	"golang.org/x/term"
+)
+
+// openOptions selects what the open subcommand opens.
+type openOptions struct {
+	// Failed opens the first failed step of a failed run, or of a run
+	// that is still going but already has a failed job.
+	Failed bool
+	// PR only considers runs triggered by a pull request.
+	PR bool
+	// Workflows only considers runs of workflows matching the filter.
+	Workflows workflowFilter
+	// Print writes the URL to stdout instead of launching a browser.
+	Print bool
+}
+
+// isPullRequestEvent reports whether a run was triggered by a pull request.
+func isPullRequestEvent(run ghactions.WorkflowRun) bool {
+	return run.Event == "pull_request" || run.Event == "pull_request_target"
+}
+
+// openFilterMatches reports whether run passes the --pr and --workflow
+// filters in opts.
+func openFilterMatches(run ghactions.WorkflowRun, opts openOptions) bool {
+	if opts.PR && !isPullRequestEvent(run) {
+		return false
+	}
+	return opts.Workflows.matches(run)
+}
+
+// failingRuns returns the IDs of the runs matching opts that are still going
+// but already have a failed job, so --failed doesn't have to wait for the
+// rest of the run to finish.
+func failingRuns(ctx context.Context, client *ghactions.Client, repoSvc *ghactions.RepoService, runs []ghactions.WorkflowRun, opts openOptions) map[int64]bool {
+	var going []ghactions.WorkflowRun
+	for _, run := range runs {
+		if !run.IsCompleted() && openFilterMatches(run, opts) {
+			going = append(going, run)
+		}
+	}
+	failed := make([]bool, len(going))
+	fanOut(len(going), client.RateLimit, func(i int) {
+		jobs, err := repoSvc.ListAllJobs(ctx, going[i].ID)
+		if err != nil {
+			// Non-fatal: the run just isn't offered.
+			slog.Debug("could not fetch jobs", "run_id", going[i].ID, "error", err)
+			return
+		}
+		failed[i] = firstFailedJob(jobs) != nil
+	})
+	failing := make(map[int64]bool)
+	for i, run := range going {
+		if failed[i] {
+			failing[run.ID] = true
+		}
+	}
+	return failing
+}
+
+// selectOpenRuns returns the runs matching opts, most recent first, or an
+// error describing why none match. With opts.Failed, a run counts as failed
+// if it failed or if failing, from failingRuns, has its ID.
+func selectOpenRuns(tip string, runs []ghactions.WorkflowRun, failing map[int64]bool, opts openOptions) ([]ghactions.WorkflowRun, error) {
+	selected := make([]ghactions.WorkflowRun, 0, len(runs))
+	for _, run := range runs {
+		if !openFilterMatches(run, opts) {
+			continue
+		}
+		if opts.Failed && !run.IsFailed() && !failing[run.ID] {
+			continue
+		}
+		selected = append(selected, run)
+	}
+	if len(selected) > 0 {
+		return selected, nil
+	}
+	var what []string
+	if opts.Failed {
+		what = append(what, "failed")
+	}
+	if opts.PR {
+		what = append(what, "pull request")
+	}
+	desc := strings.Join(append(what, "workflow runs"), " ")
+	if filter := opts.Workflows.String(); filter != "" {
+		desc += " " + filter
+	}
+	return nil, &noRunsError{msg: fmt.Sprintf("no %s for %s (%d %s in total)", desc, shortRef(tip), len(runs), pluralize(len(runs), "run"))}
+}
+
+// pickRun asks the user to choose one of runs, reading the answer from in.
+// An empty answer picks the first run.
+func pickRun(in io.Reader, out io.Writer, tip string, runs []ghactions.WorkflowRun) (ghactions.WorkflowRun, error) {
+	fmt.Fprintf(out, "Workflow runs for %s:\n", shortRef(tip))
+	for i, run := range runs {
+		fmt.Fprintf(out, "  %d) %s  %s\n", i+1, workflowRunDisplayName(run), run.StatusText())
+	}
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "Open which run? [1]: ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return ghactions.WorkflowRun{}, err
+			}
+			return ghactions.WorkflowRun{}, errors.New("no run selected")
+		}
+		answer := strings.TrimSpace(scanner.Text())
+		if answer == "" {
+			return runs[0], nil
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= 1 && n <= len(runs) {
+			return runs[n-1], nil
+		}
+		fmt.Fprintf(out, "Enter a number from 1 to %d\n", len(runs))
+	}
+}
+
+// openTargetURL returns the URL to open for run: the failing step with
+// --failed, otherwise the run page.
+func openTargetURL(ctx context.Context, repoSvc *ghactions.RepoService, run ghactions.WorkflowRun, opts openOptions) (string, error) {
+	if !opts.Failed {
+		return run.HTMLURL, nil
+	}
+	job, err := repoSvc.FindFailedJob(ctx, run.ID)
+	if err != nil {
+		return "", fmt.Errorf("finding the failed job in %q: %w", run.Name, err)
+	}
+	if job == nil || job.FailedStepURL() == "" {
+		// e.g. a startup failure, where no job ran.
+		return run.HTMLURL, nil
+	}
+	return job.FailedStepURL(), nil
+}
+
+func doOpen(ctx context.Context, client *ghactions.Client, remote *RemoteURL, remoteName string, t target, opts openOptions) error {
+	tip := t.SHA
+
+	owner, repo := remote.Path, remote.RepoName
+	repoSvc := client.Repo(owner, repo)
+	checkedOtherRemotes := false
+
+	for {
+		runs, err := repoSvc.FindWorkflowRunsForCommit(ctx, tip)
+		if err != nil {
+			if isHttpError(err) {
+				fmt.Fprintf(os.Stderr, "Caught network error: %s. Continuing\n", err.Error())
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(2 * time.Second):
+				}
+				continue
+			}
+			return err
+		}
+
+		if len(runs) == 0 {
+			if !checkedOtherRemotes {
+				checkedOtherRemotes = true
+				results := checkOtherRemotes(ctx, remoteName, tip)
+				if printOtherRemoteHints(results) {
+					return errNoWorkflowRuns
+				}
+			}
+			fmt.Fprintf(os.Stderr, "No workflow runs found for %s yet, waiting...\n", shortRef(tip))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		var failing map[int64]bool
+		if opts.Failed {
+			failing = failingRuns(ctx, client, repoSvc, runs, opts)
+		}
+		selected, err := selectOpenRuns(tip, runs, failing, opts)
+		if err != nil {
+			return err
+		}
+		// Default to the most recent run; offer a choice when there is
+		// someone to ask.
+		run := selected[0]
+		if len(selected) > 1 && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd())) {
+			run, err = pickRun(os.Stdin, os.Stderr, tip, selected)
+			if err != nil {
+				return err
+			}
+		}
+
+		target, err := openTargetURL(ctx, repoSvc, run, opts)
+		if err != nil {
+			return err
+		}
+		if opts.Print {
+			fmt.Println(target)
+			return nil
+		}
+		return openURL(target)
+	}
+}
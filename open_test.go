@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestSelectOpenRuns(t *testing.T) {
+	runs := []ghactions.WorkflowRun{
+		{ID: 1, Name: "CI", Path: ".github/workflows/ci.yml", Event: "push", Status: "completed", Conclusion: stringPtr("failure")},
+		{ID: 2, Name: "CI", Path: ".github/workflows/ci.yml", Event: "pull_request", Status: "completed", Conclusion: stringPtr("success")},
+		{ID: 3, Name: "Deploy", Path: ".github/workflows/deploy.yml", Event: "push", Status: "in_progress"},
+	}
+	tests := []struct {
+		name string
+		opts openOptions
+		want []int64
+	}{
+		{"all", openOptions{}, []int64{1, 2, 3}},
+		{"failed", openOptions{Failed: true}, []int64{1, 3}},
+		{"pr", openOptions{PR: true}, []int64{2}},
+		{"workflow", openOptions{Workflows: workflowFilter{Include: []string{"deploy.yml"}}}, []int64{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectOpenRuns("abcdef0123", runs, map[int64]bool{3: true}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int64
+			for _, run := range got {
+				ids = append(ids, run.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("selectOpenRuns() = %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("selectOpenRuns() = %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+
+	_, err := selectOpenRuns("abcdef0123", runs, nil, openOptions{Failed: true, PR: true})
+	if err == nil || !strings.Contains(err.Error(), "no failed pull request workflow runs for abcdef01") {
+		t.Errorf("selectOpenRuns(no match) error = %v", err)
+	}
+}
+
+func TestFailingRuns(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/actions/runs/3/jobs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_count": 2, "jobs": [
+			{"id": 31, "name": "build", "status": "in_progress"},
+			{"id": 32, "name": "test", "status": "completed", "conclusion": "failure"}
+		]}`))
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs/4/jobs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_count": 1, "jobs": [{"id": 41, "name": "test", "status": "in_progress"}]}`))
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request for %s", r.URL.Path)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	client := ghactions.NewClient("token", "github.com")
+	client.Client.Base = srv.URL
+
+	runs := []ghactions.WorkflowRun{
+		{ID: 1, Name: "CI", Status: "completed", Conclusion: stringPtr("failure")},
+		{ID: 3, Name: "CI", Status: "in_progress"},
+		{ID: 4, Name: "CI", Status: "in_progress"},
+	}
+	failing := failingRuns(context.Background(), client, client.Repo("o", "r"), runs, openOptions{Failed: true})
+	if len(failing) != 1 || !failing[3] {
+		t.Errorf("failingRuns() = %v, want run 3", failing)
+	}
+}
+
+func TestPickRun(t *testing.T) {
+	runs := []ghactions.WorkflowRun{
+		{ID: 1, Name: "CI", RunNumber: 4, Status: "in_progress"},
+		{ID: 2, Name: "Deploy", RunNumber: 7, Status: "queued"},
+	}
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"\n", 1},
+		{"2\n", 2},
+		{"9\nfoo\n2\n", 2},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		got, err := pickRun(strings.NewReader(tt.input), &out, "abcdef0123", runs)
+		if err != nil {
+			t.Fatalf("pickRun(%q): %v", tt.input, err)
+		}
+		if got.ID != tt.want {
+			t.Errorf("pickRun(%q) = run %d, want %d", tt.input, got.ID, tt.want)
+		}
+		if !strings.Contains(out.String(), "2) Deploy [run 7]  queued") {
+			t.Errorf("pickRun() menu = %q", out.String())
+		}
+	}
+	if _, err := pickRun(strings.NewReader(""), &bytes.Buffer{}, "abcdef0123", runs); err == nil {
+		t.Error("pickRun() with no input should return an error")
+	}
+}
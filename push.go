@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pushCheckTimeout bounds how long wait spends asking the remote whether a
+// commit was pushed, so an unreachable remote doesn't hold it up for long.
+const pushCheckTimeout = 10 * time.Second
+
+// pushStatus is how a local commit relates to the same branch or tag on a
+// remote.
+type pushStatus int
+
+const (
+	// pushStatusUnknown means we couldn't tell, e.g. for a bare SHA, or a
+	// remote head that hasn't been fetched.
+	pushStatusUnknown pushStatus = iota
+	// pushStatusPushed means the remote has the commit.
+	pushStatusPushed
+	// pushStatusMissing means the branch or tag doesn't exist on the remote.
+	pushStatusMissing
+	// pushStatusAhead means the remote is behind the local commit.
+	pushStatusAhead
+	// pushStatusDiverged means the remote doesn't contain the local commit
+	// and isn't behind it either, e.g. after an amend or rebase.
+	pushStatusDiverged
+)
+
+// pushCheck is the result of checkPushed.
+type pushCheck struct {
+	Status pushStatus
+	// Target is the branch or tag that was checked.
+	Target target
+	// Remote is the name of the remote, e.g. "origin".
+	Remote string
+	// Ahead is the number of local commits the remote doesn't have, for
+	// pushStatusAhead.
+	Ahead int
+	// Stale is true if the remote couldn't be reached, and the result is
+	// based on the remote-tracking branch as of the last fetch.
+	Stale bool
+}
+
+// unpushed reports whether the commit is known not to be on the remote.
+func (c pushCheck) unpushed() bool {
+	return c.Status == pushStatusMissing || c.Status == pushStatusAhead || c.Status == pushStatusDiverged
+}
+
+// String describes why the commit isn't on the remote, e.g. "main is 2
+// commits ahead of origin/main".
+func (c pushCheck) String() string {
+	name := c.Target.Branch
+	if name == "" {
+		name = c.Target.Tag
+	}
+	var s string
+	switch c.Status {
+	case pushStatusPushed:
+		s = fmt.Sprintf("%s is up to date with %s/%s", c.Target, c.Remote, name)
+	case pushStatusMissing:
+		s = fmt.Sprintf("%s doesn't exist on %s", c.Target, c.Remote)
+	case pushStatusAhead:
+		if c.Ahead > 0 {
+			s = fmt.Sprintf("%s is %d %s ahead of %s/%s", c.Target, c.Ahead, pluralize(c.Ahead, "commit"), c.Remote, name)
+		} else {
+			s = fmt.Sprintf("%s is ahead of %s/%s", c.Target, c.Remote, name)
+		}
+	case pushStatusDiverged:
+		s = fmt.Sprintf("%s has diverged from %s/%s (amended or rebased, and not pushed?)", c.Target, c.Remote, name)
+	default:
+		s = fmt.Sprintf("can't tell whether %s is on %s", c.Target, c.Remote)
+	}
+	if c.Stale {
+		s += fmt.Sprintf(" as of the last fetch (%s was unreachable)", c.Remote)
+	}
+	return s
+}
+
+// checkPushed works out whether the commit t points to is on remoteName.
+// It asks the remote with "git ls-remote", falling back to the
+// remote-tracking branch if the remote can't be reached. Targets that are
+// neither a branch nor a tag are reported as pushStatusUnknown.
+func checkPushed(ctx context.Context, remoteName string, t target) pushCheck {
+	check := pushCheck{Target: t, Remote: remoteName}
+	var ref, trackingRef string
+	switch {
+	case t.Branch != "":
+		ref = "refs/heads/" + t.Branch
+		trackingRef = "refs/remotes/" + remoteName + "/" + t.Branch
+	case t.Tag != "":
+		ref = "refs/tags/" + t.Tag
+	default:
+		return check
+	}
+
+	lsCtx, cancel := context.WithTimeout(ctx, pushCheckTimeout)
+	remoteSHA, ok, err := remoteRefCommit(lsCtx, remoteName, ref)
+	cancel()
+	if err != nil {
+		slog.Debug("could not reach remote, using the remote-tracking ref", "remote", remoteName, "error", err)
+		if trackingRef == "" {
+			return check
+		}
+		remoteSHA, err = gitTip(ctx, trackingRef)
+		ok = err == nil
+		check.Stale = true
+	}
+	if !ok {
+		check.Status = pushStatusMissing
+		return check
+	}
+	if remoteSHA == t.SHA {
+		check.Status = pushStatusPushed
+		return check
+	}
+
+	// The remote has moved on from our commit, or we have moved on from it.
+	if contained, err := isAncestor(ctx, t.SHA, remoteSHA); err != nil {
+		// Most likely the remote head hasn't been fetched.
+		slog.Debug("could not compare with the remote head", "error", err)
+		return check
+	} else if contained {
+		check.Status = pushStatusPushed
+		return check
+	}
+	if behind, err := isAncestor(ctx, remoteSHA, t.SHA); err == nil && behind {
+		check.Status = pushStatusAhead
+		if check.Ahead, err = countCommits(ctx, remoteSHA, t.SHA); err != nil {
+			slog.Debug("could not count unpushed commits", "error", err)
+		}
+		return check
+	}
+	check.Status = pushStatusDiverged
+	return check
+}
+
+// pushTarget pushes the commit t points to, to the same branch or tag on
+// remoteName, writing git's output to w.
+func pushTarget(ctx context.Context, w io.Writer, remoteName string, t target) error {
+	var refspec string
+	switch {
+	case t.Branch != "":
+		refspec = t.SHA + ":refs/heads/" + t.Branch
+	case t.Tag != "":
+		refspec = "refs/tags/" + t.Tag
+	default:
+		return fmt.Errorf("can't push %s: pass a branch or tag to push", t)
+	}
+	fmt.Fprintf(w, "Pushing %s to %s\n", t, remoteName)
+	return gitPush(ctx, w, w, remoteName, refspec)
+}
+
+// pushOptionsWithValue are the git push options that take their value as
+// the next argument.
+var pushOptionsWithValue = map[string]bool{
+	"--repo":         true,
+	"-o":             true,
+	"--push-option":  true,
+	"--receive-pack": true,
+	"--exec":         true,
+}
+
+// parsePushArgs finds the repository and refspecs in "git push" arguments.
+// repository is empty if the arguments don't name one.
+func parsePushArgs(args []string) (repository string, refspecs []string) {
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		switch {
+		case strings.HasPrefix(arg, "--repo="):
+			repository = strings.TrimPrefix(arg, "--repo=")
+		case pushOptionsWithValue[arg]:
+			if arg == "--repo" && i+1 < len(args) {
+				repository = args[i+1]
+			}
+			i++
+		case strings.HasPrefix(arg, "-"):
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) > 0 {
+		return positional[0], positional[1:]
+	}
+	return repository, nil
+}
+
+// defaultPushRemote returns the remote "git push" uses for branch when it
+// isn't given one.
+func defaultPushRemote(ctx context.Context, branch string) string {
+	if branch != "" {
+		if remote := gitConfig(ctx, "branch."+branch+".pushRemote"); remote != "" {
+			return remote
+		}
+	}
+	if remote := gitConfig(ctx, "remote.pushDefault"); remote != "" {
+		return remote
+	}
+	if branch != "" {
+		if remote := gitConfig(ctx, "branch."+branch+".remote"); remote != "" {
+			return remote
+		}
+	}
+	return "origin"
+}
+
+// pushedRef is one ref from "git push --porcelain" output.
+type pushedRef struct {
+	// Flag is ' ' for a fast-forward, '+' for a forced update, '-' for a
+	// deleted ref, '*' for a new ref, '!' for a rejected ref and '=' for a
+	// ref that was already up to date.
+	Flag    byte
+	Src     string
+	Dst     string
+	Summary string
+}
+
+// parsePushPorcelain parses the ref lines of "git push --porcelain" output.
+func parsePushPorcelain(out string) []pushedRef {
+	var refs []pushedRef
+	for _, line := range strings.Split(out, "\n") {
+		// <flag> TAB <from>:<to> TAB <summary>
+		parts := strings.Split(line, "\t")
+		if len(parts) < 3 || len(parts[0]) != 1 {
+			continue
+		}
+		src, dst, ok := strings.Cut(parts[1], ":")
+		if !ok {
+			continue
+		}
+		refs = append(refs, pushedRef{Flag: parts[0][0], Src: src, Dst: dst, Summary: parts[2]})
+	}
+	return refs
+}
+
+// choosePushedRef picks the ref to wait for: the current branch if it was
+// pushed, otherwise the first branch, otherwise the first tag. Deleted and
+// rejected refs are skipped.
+func choosePushedRef(refs []pushedRef, currentBranch string) (pushedRef, bool) {
+	var branch, tag *pushedRef
+	for i := range refs {
+		ref := &refs[i]
+		if ref.Flag == '-' || ref.Flag == '!' {
+			continue
+		}
+		switch {
+		case currentBranch != "" && ref.Src == "refs/heads/"+currentBranch:
+			return *ref, true
+		case strings.HasPrefix(ref.Dst, "refs/heads/") && branch == nil:
+			branch = ref
+		case strings.HasPrefix(ref.Dst, "refs/tags/") && tag == nil:
+			tag = ref
+		}
+	}
+	if branch != nil {
+		return *branch, true
+	}
+	if tag != nil {
+		return *tag, true
+	}
+	return pushedRef{}, false
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// pushAndResolve runs "git push" with args, writing git's messages to w, and
+// returns the remote that was pushed to and the branch or tag to wait for.
+func pushAndResolve(ctx context.Context, w io.Writer, args []string) (remoteName string, t target, err error) {
+	current, err := currentBranch(ctx)
+	if err != nil && !errors.Is(err, errDetachedHead) {
+		return "", target{}, err
+	}
+	remoteName, _ = parsePushArgs(args)
+	if remoteName == "" {
+		remoteName = defaultPushRemote(ctx, current)
+	}
+
+	// Show git's output as usual, including why a ref was rejected, while
+	// keeping a copy to parse. git writes to both at once, so they share a
+	// lock.
+	lw := &lockedWriter{w: w}
+	var out bytes.Buffer
+	if err := gitPush(ctx, io.MultiWriter(lw, &out), lw, append([]string{"--porcelain"}, args...)...); err != nil {
+		return "", target{}, err
+	}
+	ref, ok := choosePushedRef(parsePushPorcelain(out.String()), current)
+	if !ok {
+		return "", target{}, fmt.Errorf("git push didn't push a branch or tag to wait for")
+	}
+	sha, err := gitTip(ctx, ref.Src)
+	if err != nil {
+		return "", target{}, err
+	}
+	t = target{Ref: ref.Src, SHA: sha}
+	t.Branch, t.Tag = classifyRef(ref.Dst)
+	fmt.Fprintf(w, "Pushed %s to %s (%s)\n", t, remoteName, ref.Summary)
+	return remoteName, t, nil
+}
+
+// remoteURLFor returns the parsed URL for a remote name or URL, as passed to
+// git push.
+func remoteURLFor(ctx context.Context, repository string) (*RemoteURL, error) {
+	names, err := listRemoteNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(names, repository) {
+		return getRemoteURL(ctx, repository)
+	}
+	return resolveRemoteURL(ctx, repository)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPushCheckString(t *testing.T) {
+	main := target{Ref: "main", Branch: "main", SHA: "1a2b3c4d5e6f"}
+	tag := target{Ref: "v1.0", Tag: "v1.0", SHA: "1a2b3c4d5e6f"}
+	tests := []struct {
+		check    pushCheck
+		want     string
+		unpushed bool
+	}{
+		{pushCheck{Status: pushStatusPushed, Target: main, Remote: "origin"}, "main is up to date with origin/main", false},
+		{pushCheck{Status: pushStatusUnknown, Target: main, Remote: "origin"}, "can't tell whether main is on origin", false},
+		{pushCheck{Status: pushStatusMissing, Target: tag, Remote: "upstream"}, "tag v1.0 doesn't exist on upstream", true},
+		{pushCheck{Status: pushStatusAhead, Target: main, Remote: "origin", Ahead: 1}, "main is 1 commit ahead of origin/main", true},
+		{pushCheck{Status: pushStatusAhead, Target: main, Remote: "origin", Ahead: 3, Stale: true}, "main is 3 commits ahead of origin/main as of the last fetch (origin was unreachable)", true},
+		{pushCheck{Status: pushStatusDiverged, Target: main, Remote: "origin"}, "main has diverged from origin/main (amended or rebased, and not pushed?)", true},
+	}
+	for _, tt := range tests {
+		if got := tt.check.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+		if got := tt.check.unpushed(); got != tt.unpushed {
+			t.Errorf("%q: unpushed() = %v, want %v", tt.want, got, tt.unpushed)
+		}
+	}
+}
+
+func TestPushTargetNeedsBranchOrTag(t *testing.T) {
+	err := pushTarget(t.Context(), nil, "origin", target{Ref: "HEAD", SHA: "1a2b3c4d5e6f"})
+	if err == nil {
+		t.Fatal("pushTarget(detached HEAD) = nil, want error")
+	}
+}
+
+func TestParsePushArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		repository string
+		refspecs   []string
+	}{
+		{nil, "", nil},
+		{[]string{"origin"}, "origin", nil},
+		{[]string{"-u", "upstream", "feature"}, "upstream", []string{"feature"}},
+		{[]string{"--force-with-lease", "-o", "ci.skip", "origin", "HEAD:main"}, "origin", []string{"HEAD:main"}},
+		{[]string{"--repo", "fork"}, "fork", nil},
+		{[]string{"--repo=fork", "--tags"}, "fork", nil},
+		{[]string{"--", "origin", "-weird-branch"}, "origin", []string{"-weird-branch"}},
+	}
+	for _, tt := range tests {
+		repository, refspecs := parsePushArgs(tt.args)
+		if repository != tt.repository || strings.Join(refspecs, " ") != strings.Join(tt.refspecs, " ") {
+			t.Errorf("parsePushArgs(%q) = (%q, %q), want (%q, %q)", tt.args, repository, refspecs, tt.repository, tt.refspecs)
+		}
+	}
+}
+
+const testPushPorcelain = "To github.com:kevinburke/github-actions.git\n" +
+	"=\trefs/heads/main:refs/heads/main\t[up to date]\n" +
+	"*\trefs/heads/feature:refs/heads/feature\t[new branch]\n" +
+	"-\t:refs/heads/old\t[deleted]\n" +
+	"*\trefs/tags/v1.0:refs/tags/v1.0\t[new tag]\n" +
+	"Done\n"
+
+func TestParsePushPorcelain(t *testing.T) {
+	refs := parsePushPorcelain(testPushPorcelain)
+	if len(refs) != 4 {
+		t.Fatalf("parsePushPorcelain() = %d refs, want 4: %+v", len(refs), refs)
+	}
+	want := pushedRef{Flag: '*', Src: "refs/heads/feature", Dst: "refs/heads/feature", Summary: "[new branch]"}
+	if refs[1] != want {
+		t.Errorf("refs[1] = %+v, want %+v", refs[1], want)
+	}
+	if refs[2].Flag != '-' || refs[2].Src != "" {
+		t.Errorf("refs[2] = %+v, want a deletion", refs[2])
+	}
+}
+
+func TestChoosePushedRef(t *testing.T) {
+	refs := parsePushPorcelain(testPushPorcelain)
+	tests := []struct {
+		current string
+		want    string
+	}{
+		{"feature", "refs/heads/feature"},
+		{"main", "refs/heads/main"},
+		{"", "refs/heads/main"},
+		{"old", "refs/heads/main"},
+	}
+	for _, tt := range tests {
+		got, ok := choosePushedRef(refs, tt.current)
+		if !ok || got.Dst != tt.want {
+			t.Errorf("choosePushedRef(current %q) = %q, %v, want %q", tt.current, got.Dst, ok, tt.want)
+		}
+	}
+	tagOnly := []pushedRef{{Flag: '!', Src: "refs/heads/main", Dst: "refs/heads/main"}, {Flag: '*', Src: "refs/tags/v2", Dst: "refs/tags/v2"}}
+	if got, ok := choosePushedRef(tagOnly, "main"); !ok || got.Dst != "refs/tags/v2" {
+		t.Errorf("choosePushedRef(rejected branch) = %q, %v, want the tag", got.Dst, ok)
+	}
+	if _, ok := choosePushedRef(nil, "main"); ok {
+		t.Error("choosePushedRef(nil) = ok, want false")
+	}
+}
+
+// git runs a git command in dir, failing the test if it fails.
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestPushAndResolveRejected(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, v := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(v, "Test")
+	}
+	for _, v := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(v, "test@example.com")
+	}
+	dir := t.TempDir()
+	remote, work, other := filepath.Join(dir, "remote.git"), filepath.Join(dir, "work"), filepath.Join(dir, "other")
+	git(t, dir, "init", "--bare", "-b", "main", remote)
+	git(t, dir, "clone", remote, work)
+	git(t, work, "commit", "--allow-empty", "-m", "first")
+	git(t, work, "push", "origin", "main")
+	// Someone else pushes first, so our next push isn't a fast-forward.
+	git(t, dir, "clone", remote, other)
+	git(t, other, "commit", "--allow-empty", "-m", "theirs")
+	git(t, other, "push", "origin", "main")
+	git(t, work, "commit", "--allow-empty", "-m", "ours")
+
+	t.Chdir(work)
+	var out bytes.Buffer
+	_, _, err := pushAndResolve(context.Background(), &out, []string{"origin", "main"})
+	if err == nil {
+		t.Fatal("pushAndResolve() succeeded, want the push to be rejected")
+	}
+	if !strings.Contains(out.String(), "[rejected]") {
+		t.Errorf("output doesn't say why the push failed:\n%s", out.String())
+	}
+}
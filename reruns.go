@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// rerunWatcher tracks the failed runs that "wait --follow-reruns" is giving a
+// chance to be re-run before it reports the build as failed.
+type rerunWatcher struct {
+	grace   time.Duration
+	watches map[int64]*rerunWatch // run ID -> watch
+}
+
+type rerunWatch struct {
+	attempt int // the attempt that failed
+	// deadline is when we stop waiting for a new attempt. It is zero until
+	// the failed attempt completes, since a run can't be re-run before then.
+	deadline time.Time
+	// report is the failed attempt's report. Its ::error commands are held
+	// back until the failure is final, so a re-run that passes doesn't leave
+	// error annotations behind.
+	report *ghactions.RunReport
+}
+
+func newRerunWatcher(grace time.Duration) *rerunWatcher {
+	return &rerunWatcher{grace: grace, watches: make(map[int64]*rerunWatch)}
+}
+
+// observeFailure records that run has failed. isNew is true the first time a
+// given attempt is seen failing, so the caller can print its summary once.
+// keepWaiting is false once the grace window after the attempt completed has
+// passed without a re-run.
+func (rw *rerunWatcher) observeFailure(now time.Time, run ghactions.WorkflowRun) (isNew, keepWaiting bool) {
+	w := rw.watches[run.ID]
+	if w == nil || w.attempt != run.RunAttempt {
+		w = &rerunWatch{attempt: run.RunAttempt}
+		rw.watches[run.ID] = w
+		isNew = true
+	}
+	if run.IsCompleted() && w.deadline.IsZero() {
+		w.deadline = now.Add(rw.grace)
+	}
+	return isNew, w.deadline.IsZero() || now.Before(w.deadline)
+}
+
+// hold keeps rep, the report of run's failed attempt, until the failure is
+// final.
+func (rw *rerunWatcher) hold(run ghactions.WorkflowRun, rep *ghactions.RunReport) {
+	if w := rw.watches[run.ID]; w != nil && w.attempt == run.RunAttempt {
+		w.report = rep
+	}
+}
+
+// held returns the report kept by hold for run's attempt, or nil.
+func (rw *rerunWatcher) held(run ghactions.WorkflowRun) *ghactions.RunReport {
+	w := rw.watches[run.ID]
+	if w == nil || w.attempt != run.RunAttempt {
+		return nil
+	}
+	return w.report
+}
+
+// reruns returns the watched runs that have a new attempt, and stops watching
+// them.
+func (rw *rerunWatcher) reruns(runs []ghactions.WorkflowRun) []ghactions.WorkflowRun {
+	var rerun []ghactions.WorkflowRun
+	for _, run := range runs {
+		w := rw.watches[run.ID]
+		if w == nil || run.RunAttempt <= w.attempt {
+			continue
+		}
+		delete(rw.watches, run.ID)
+		rerun = append(rerun, run)
+	}
+	return rerun
+}
+
+// writeAttemptHistory prints the outcome and duration of each attempt of a
+// run that was re-run. It prints nothing for a run with a single attempt.
+func writeAttemptHistory(ctx context.Context, w io.Writer, repoSvc *ghactions.RepoService, run ghactions.WorkflowRun) {
+	if run.RunAttempt <= 1 {
+		return
+	}
+	attempts, err := repoSvc.ListWorkflowRunAttempts(ctx, run)
+	if err != nil {
+		fmt.Fprintf(w, "Could not fetch earlier attempts: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "Attempts:\n")
+	for _, a := range attempts {
+		fmt.Fprintf(w, "  attempt %d: %s (%s)\n", a.RunAttempt, a.StatusText(), a.Duration())
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestRerunWatcher(t *testing.T) {
+	now := time.Now()
+	rw := newRerunWatcher(time.Minute)
+
+	// A job failed while the run is still going: report it, but there's no
+	// deadline until the run finishes.
+	running := ghactions.WorkflowRun{ID: 1, RunAttempt: 1, Status: "in_progress"}
+	if isNew, keepWaiting := rw.observeFailure(now, running); !isNew || !keepWaiting {
+		t.Fatalf("observeFailure(in progress) = %v, %v, want true, true", isNew, keepWaiting)
+	}
+	if _, keepWaiting := rw.observeFailure(now.Add(time.Hour), running); !keepWaiting {
+		t.Fatal("the grace window should not start before the run completes")
+	}
+
+	failed := ghactions.WorkflowRun{ID: 1, RunAttempt: 1, Status: "completed", Conclusion: stringPtr("failure")}
+	if isNew, keepWaiting := rw.observeFailure(now, failed); isNew || !keepWaiting {
+		t.Fatalf("observeFailure(completed) = %v, %v, want false, true", isNew, keepWaiting)
+	}
+	if _, keepWaiting := rw.observeFailure(now.Add(2*time.Minute), failed); keepWaiting {
+		t.Fatal("observeFailure() after the grace window should stop waiting")
+	}
+
+	if got := rw.reruns([]ghactions.WorkflowRun{failed}); len(got) != 0 {
+		t.Fatalf("reruns() = %v for the same attempt, want none", got)
+	}
+	rerun := ghactions.WorkflowRun{ID: 1, RunAttempt: 2, Status: "queued"}
+	if got := rw.reruns([]ghactions.WorkflowRun{rerun}); len(got) != 1 || got[0].RunAttempt != 2 {
+		t.Fatalf("reruns() = %v, want attempt 2", got)
+	}
+	if got := rw.reruns([]ghactions.WorkflowRun{rerun}); len(got) != 0 {
+		t.Fatal("reruns() should report each re-run once")
+	}
+
+	// The second attempt failing is a new failure with a fresh window.
+	failedAgain := ghactions.WorkflowRun{ID: 1, RunAttempt: 2, Status: "completed", Conclusion: stringPtr("failure")}
+	if isNew, keepWaiting := rw.observeFailure(now.Add(3*time.Minute), failedAgain); !isNew || !keepWaiting {
+		t.Fatalf("observeFailure(attempt 2) = %v, %v, want true, true", isNew, keepWaiting)
+	}
+}
+
+func TestRerunWatcherHold(t *testing.T) {
+	rw := newRerunWatcher(time.Minute)
+	failed := ghactions.WorkflowRun{ID: 1, RunAttempt: 1, Status: "completed", Conclusion: stringPtr("failure")}
+	rep := &ghactions.RunReport{Run: failed}
+	rw.hold(failed, rep)
+	if got := rw.held(failed); got != nil {
+		t.Fatalf("held() = %v before the failure was observed, want nil", got)
+	}
+
+	rw.observeFailure(time.Now(), failed)
+	rw.hold(failed, rep)
+	if got := rw.held(failed); got != rep {
+		t.Fatalf("held() = %v, want the held report", got)
+	}
+	// Once the run is re-run, the old attempt's errors are dropped.
+	rerun := ghactions.WorkflowRun{ID: 1, RunAttempt: 2, Status: "queued"}
+	rw.reruns([]ghactions.WorkflowRun{rerun})
+	if got := rw.held(failed); got != nil {
+		t.Errorf("held() = %v after a re-run, want nil", got)
+	}
+	if got := rw.held(rerun); got != nil {
+		t.Errorf("held(attempt 2) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+// maxStatsRuns caps how many runs stats fetches for each period, so a busy
+// repository with a long --days window doesn't burn the whole rate limit.
+// The cap applies to each period separately, so a busy current period can't
+// crowd the previous one out of the comparison.
+const maxStatsRuns = 1000
+
+// statsSample is one completed workflow run or job.
+type statsSample struct {
+	duration   time.Duration
+	queue      time.Duration
+	conclusion ghactions.Conclusion
+}
+
+// statsSummary aggregates a set of samples.
+type statsSummary struct {
+	Count       int
+	P50         time.Duration
+	P90         time.Duration
+	Max         time.Duration
+	QueueP50    time.Duration
+	SuccessRate float64
+	FailureRate float64
+	CancelRate  float64
+}
+
+// statsRow is one line of stats output: a workflow (Job is empty) or a job
+// within a workflow, for the current period and the one before it.
+type statsRow struct {
+	Workflow string
+	Job      string
+	Current  statsSummary
+	Previous statsSummary
+	// Partial is set when a period had more runs than maxStatsRuns, so the
+	// summaries, and the trend between them, only cover the newest runs.
+	Partial bool
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+func summarize(samples []statsSample) statsSummary {
+	sum := statsSummary{Count: len(samples)}
+	if len(samples) == 0 {
+		return sum
+	}
+	durations := make([]time.Duration, 0, len(samples))
+	queues := make([]time.Duration, 0, len(samples))
+	var success, failure, cancelled int
+	for _, s := range samples {
+		if s.duration > 0 {
+			durations = append(durations, s.duration)
+		}
+		if s.queue >= 0 {
+			queues = append(queues, s.queue)
+		}
+		switch s.conclusion {
+		case ghactions.ConclusionSuccess:
+			success++
+		case ghactions.ConclusionCancelled:
+			cancelled++
+		default:
+			if s.conclusion.IsFailed() {
+				failure++
+			}
+		}
+	}
+	slices.Sort(durations)
+	slices.Sort(queues)
+	sum.P50 = percentile(durations, 0.5)
+	sum.P90 = percentile(durations, 0.9)
+	if len(durations) > 0 {
+		sum.Max = durations[len(durations)-1]
+	}
+	sum.QueueP50 = percentile(queues, 0.5)
+	n := float64(len(samples))
+	sum.SuccessRate = float64(success) / n
+	sum.FailureRate = float64(failure) / n
+	sum.CancelRate = float64(cancelled) / n
+	return sum
+}
+
+func runSample(run ghactions.WorkflowRun) statsSample {
+	s := statsSample{duration: run.Duration(), queue: -1}
+	if run.Conclusion != nil {
+		s.conclusion = *run.Conclusion
+	}
+	if run.RunStartedAt != nil && !run.CreatedAt.IsZero() {
+		s.queue = run.RunStartedAt.Sub(run.CreatedAt)
+	}
+	return s
+}
+
+func jobSample(job ghactions.Job) statsSample {
+	s := statsSample{queue: -1}
+	if job.Conclusion != nil {
+		s.conclusion = *job.Conclusion
+	}
+	if job.StartedAt != nil && job.CompletedAt != nil {
+		s.duration = job.CompletedAt.Sub(*job.StartedAt)
+	}
+	if job.CreatedAt != nil && job.StartedAt != nil {
+		s.queue = job.StartedAt.Sub(*job.CreatedAt)
+	}
+	return s
+}
+
+// statsKey identifies a workflow or job row.
+type statsKey struct {
+	workflow string
+	job      string
+}
+
+// buildStatsRows splits runs into the current period (created at or after
+// periodStart) and the previous one, and summarizes each workflow and job.
+// jobs maps run ID to the jobs in that run; runs without an entry contribute
+// only to the workflow rows.
+func buildStatsRows(runs []ghactions.WorkflowRun, jobs map[int64][]ghactions.Job, periodStart time.Time) []statsRow {
+	current := make(map[statsKey][]statsSample)
+	previous := make(map[statsKey][]statsSample)
+	for _, run := range runs {
+		if !run.IsCompleted() {
+			continue
+		}
+		bucket := current
+		if run.CreatedAt.Before(periodStart) {
+			bucket = previous
+		}
+		key := statsKey{workflow: run.Name}
+		bucket[key] = append(bucket[key], runSample(run))
+		for _, job := range jobs[run.ID] {
+			if !job.Status.IsTerminal() {
+				continue
+			}
+			jk := statsKey{workflow: run.Name, job: job.Name}
+			bucket[jk] = append(bucket[jk], jobSample(job))
+		}
+	}
+
+	rows := make([]statsRow, 0, len(current))
+	for key, samples := range current {
+		rows = append(rows, statsRow{
+			Workflow: key.workflow,
+			Job:      key.job,
+			Current:  summarize(samples),
+			Previous: summarize(previous[key]),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Workflow != rows[j].Workflow {
+			return rows[i].Workflow < rows[j].Workflow
+		}
+		return rows[i].Job < rows[j].Job
+	})
+	return rows
+}
+
+// trend describes how the median duration and success rate moved relative to
+// the previous period, e.g. "+12% time, -5pp success".
+func (r statsRow) trend() string {
+	if r.Previous.Count == 0 || r.Previous.P50 == 0 {
+		return "-"
+	}
+	pct := (float64(r.Current.P50) - float64(r.Previous.P50)) / float64(r.Previous.P50) * 100
+	pp := (r.Current.SuccessRate - r.Previous.SuccessRate) * 100
+	trend := fmt.Sprintf("%+.0f%% time, %+.0fpp success", pct, pp)
+	if r.Partial {
+		trend += " (partial)"
+	}
+	return trend
+}
+
+func formatRate(f float64) string {
+	return strconv.FormatFloat(f*100, 'f', 0, 64) + "%"
+}
+
+func writeStatsTable(w io.Writer, rows []statsRow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKFLOW\tJOB\tRUNS\tP50\tP90\tMAX\tQUEUE\tSUCCESS\tFAIL\tCANCEL\tTREND")
+	for _, r := range rows {
+		job := r.Job
+		if job == "" {
+			job = "-"
+		}
+		c := r.Current
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Workflow, job, c.Count,
+			durationString(c.P50), durationString(c.P90), durationString(c.Max), durationString(c.QueueP50),
+			formatRate(c.SuccessRate), formatRate(c.FailureRate), formatRate(c.CancelRate),
+			r.trend())
+	}
+	return tw.Flush()
+}
+
+// jsonStatsSummary is the JSON form of statsSummary, with durations in
+// seconds.
+type jsonStatsSummary struct {
+	Runs            int     `json:"runs"`
+	P50Seconds      float64 `json:"p50_seconds"`
+	P90Seconds      float64 `json:"p90_seconds"`
+	MaxSeconds      float64 `json:"max_seconds"`
+	QueueP50Seconds float64 `json:"queue_p50_seconds"`
+	SuccessRate     float64 `json:"success_rate"`
+	FailureRate     float64 `json:"failure_rate"`
+	CancelRate      float64 `json:"cancel_rate"`
+}
+
+func (s statsSummary) toJSON() jsonStatsSummary {
+	return jsonStatsSummary{
+		Runs:            s.Count,
+		P50Seconds:      s.P50.Seconds(),
+		P90Seconds:      s.P90.Seconds(),
+		MaxSeconds:      s.Max.Seconds(),
+		QueueP50Seconds: s.QueueP50.Seconds(),
+		SuccessRate:     s.SuccessRate,
+		FailureRate:     s.FailureRate,
+		CancelRate:      s.CancelRate,
+	}
+}
+
+func writeStatsJSON(w io.Writer, rows []statsRow) error {
+	type jsonRow struct {
+		Workflow string           `json:"workflow"`
+		Job      string           `json:"job,omitempty"`
+		Current  jsonStatsSummary `json:"current"`
+		Previous jsonStatsSummary `json:"previous"`
+		Partial  bool             `json:"partial,omitempty"`
+	}
+	out := make([]jsonRow, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, jsonRow{
+			Workflow: r.Workflow,
+			Job:      r.Job,
+			Current:  r.Current.toJSON(),
+			Previous: r.Previous.toJSON(),
+			Partial:  r.Partial,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func writeStatsCSV(w io.Writer, rows []statsRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"workflow", "job", "runs", "p50_seconds", "p90_seconds", "max_seconds", "queue_p50_seconds",
+		"success_rate", "failure_rate", "cancel_rate", "previous_runs", "previous_p50_seconds", "previous_success_rate",
+	})
+	secs := func(d time.Duration) string { return strconv.FormatFloat(d.Seconds(), 'f', 0, 64) }
+	rate := func(f float64) string { return strconv.FormatFloat(f, 'f', 4, 64) }
+	for _, r := range rows {
+		c, p := r.Current, r.Previous
+		cw.Write([]string{
+			r.Workflow, r.Job, strconv.Itoa(c.Count),
+			secs(c.P50), secs(c.P90), secs(c.Max), secs(c.QueueP50),
+			rate(c.SuccessRate), rate(c.FailureRate), rate(c.CancelRate),
+			strconv.Itoa(p.Count), secs(p.P50), rate(p.SuccessRate),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeStats(w io.Writer, rows []statsRow, format string) error {
+	switch format {
+	case "table":
+		return writeStatsTable(w, rows)
+	case "json":
+		return writeStatsJSON(w, rows)
+	case "csv":
+		return writeStatsCSV(w, rows)
+	default:
+		return fmt.Errorf("unknown --format %q (want table, json or csv)", format)
+	}
+}
+
+// listStatsRuns lists up to maxStatsRuns completed runs created between from
+// and to, newest first, and reports whether it stopped at the cap.
+func listStatsRuns(ctx context.Context, repoSvc *ghactions.RepoService, branch string, from, to time.Time) ([]ghactions.WorkflowRun, bool, error) {
+	params := url.Values{
+		"status":  {"completed"},
+		"created": {from.UTC().Format(time.RFC3339) + ".." + to.UTC().Format(time.RFC3339)},
+	}
+	if branch != "" {
+		params.Set("branch", branch)
+	}
+	// Ask for one more than the cap, so a period with exactly maxStatsRuns
+	// runs isn't reported as partial.
+	runs, err := repoSvc.ListAllWorkflowRuns(ctx, params, maxStatsRuns+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(runs) > maxStatsRuns {
+		return runs[:maxStatsRuns], true, nil
+	}
+	return runs, false, nil
+}
+
+func doStats(ctx context.Context, client *ghactions.Client, remote *RemoteURL, w, errw io.Writer, branch string, days int, includeJobs bool, format string) error {
+	if days <= 0 {
+		return fmt.Errorf("--days must be positive, got %d", days)
+	}
+	repoSvc := client.Repo(remote.Path, remote.RepoName)
+	now := time.Now()
+	period := time.Duration(days) * 24 * time.Hour
+	periodStart := now.Add(-period)
+
+	runs, currentPartial, err := listStatsRuns(ctx, repoSvc, branch, periodStart, now)
+	if err != nil {
+		return fmt.Errorf("listing workflow runs: %w", err)
+	}
+	previous, previousPartial, err := listStatsRuns(ctx, repoSvc, branch, periodStart.Add(-period), periodStart)
+	if err != nil {
+		return fmt.Errorf("listing workflow runs: %w", err)
+	}
+	// Both ranges include periodStart itself.
+	seen := make(map[int64]bool, len(runs))
+	for _, run := range runs {
+		seen[run.ID] = true
+	}
+	for _, run := range previous {
+		if !seen[run.ID] {
+			runs = append(runs, run)
+		}
+	}
+	for _, p := range []struct {
+		name    string
+		partial bool
+	}{{"last", currentPartial}, {"previous", previousPartial}} {
+		if p.partial {
+			fmt.Fprintf(errw, "Warning: the %s %d days had more than %d runs; only the newest %d are included, so trends are partial.\n", p.name, days, maxStatsRuns, maxStatsRuns)
+		}
+	}
+
+	var jobs map[int64][]ghactions.Job
+	if includeJobs {
+		runJobs := make([][]ghactions.Job, len(runs))
+		jobErrs := make([]error, len(runs))
+		fanOut(len(runs), client.RateLimit, func(i int) {
+			runJobs[i], jobErrs[i] = repoSvc.ListAllJobs(ctx, runs[i].ID)
+		})
+		jobs = make(map[int64][]ghactions.Job, len(runs))
+		for i, run := range runs {
+			if jobErrs[i] != nil {
+				// Non-fatal: the workflow row is still accurate.
+				slog.Debug("could not fetch jobs", "run_id", run.ID, "error", jobErrs[i])
+				continue
+			}
+			jobs[run.ID] = runJobs[i]
+		}
+	}
+
+	rows := buildStatsRows(runs, jobs, periodStart)
+	if len(rows) == 0 {
+		where := "any branch"
+		if branch != "" {
+			where = branch
+		}
+		return fmt.Errorf("no completed workflow runs on %s in the last %d days", where, days)
+	}
+	for i := range rows {
+		rows[i].Partial = currentPartial || previousPartial
+	}
+	return writeStats(w, rows, format)
+}
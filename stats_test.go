@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ghactions "github.com/kevinburke/github-actions/lib"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0.5, 5},
+		{0.9, 9},
+		{1, 10},
+		{0, 1},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("percentile(nil) = %v, want 0", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	samples := []statsSample{
+		{duration: time.Minute, queue: 10 * time.Second, conclusion: "success"},
+		{duration: 2 * time.Minute, queue: 20 * time.Second, conclusion: "success"},
+		{duration: 3 * time.Minute, queue: 30 * time.Second, conclusion: "failure"},
+		{duration: 10 * time.Minute, queue: -1, conclusion: "cancelled"},
+	}
+	got := summarize(samples)
+	if got.Count != 4 {
+		t.Errorf("Count = %d, want 4", got.Count)
+	}
+	if got.P50 != 2*time.Minute {
+		t.Errorf("P50 = %s, want 2m", got.P50)
+	}
+	if got.Max != 10*time.Minute {
+		t.Errorf("Max = %s, want 10m", got.Max)
+	}
+	if got.QueueP50 != 20*time.Second {
+		t.Errorf("QueueP50 = %s, want 20s (negative queue samples ignored)", got.QueueP50)
+	}
+	if got.SuccessRate != 0.5 || got.FailureRate != 0.25 || got.CancelRate != 0.25 {
+		t.Errorf("rates = %v/%v/%v, want 0.5/0.25/0.25", got.SuccessRate, got.FailureRate, got.CancelRate)
+	}
+}
+
+func TestBuildStatsRows(t *testing.T) {
+	now := time.Now()
+	periodStart := now.Add(-24 * time.Hour)
+	run := func(id int64, name string, created time.Time, dur time.Duration, conclusion ghactions.Conclusion) ghactions.WorkflowRun {
+		started := created.Add(30 * time.Second)
+		return ghactions.WorkflowRun{
+			ID:           id,
+			Name:         name,
+			Status:       "completed",
+			Conclusion:   stringPtr(conclusion),
+			CreatedAt:    created,
+			RunStartedAt: timeRef(started),
+			UpdatedAt:    started.Add(dur),
+		}
+	}
+	runs := []ghactions.WorkflowRun{
+		run(1, "CI", now.Add(-time.Hour), 4*time.Minute, "success"),
+		run(2, "CI", now.Add(-2*time.Hour), 6*time.Minute, "failure"),
+		run(3, "CI", now.Add(-30*time.Hour), 2*time.Minute, "success"),
+		run(4, "Lint", now.Add(-40*time.Hour), time.Minute, "success"),
+		{ID: 5, Name: "CI", Status: "in_progress", CreatedAt: now},
+	}
+	jobStart := now.Add(-time.Hour)
+	jobs := map[int64][]ghactions.Job{
+		1: {{
+			Name:        "test",
+			Status:      "completed",
+			Conclusion:  stringPtr("success"),
+			CreatedAt:   timeRef(jobStart.Add(-5 * time.Second)),
+			StartedAt:   timeRef(jobStart),
+			CompletedAt: timeRef(jobStart.Add(3 * time.Minute)),
+		}},
+	}
+
+	rows := buildStatsRows(runs, jobs, periodStart)
+	if len(rows) != 2 {
+		t.Fatalf("len(rows) = %d, want 2 (CI and CI/test; Lint has no current runs): %+v", len(rows), rows)
+	}
+	ci := rows[0]
+	if ci.Workflow != "CI" || ci.Job != "" {
+		t.Fatalf("rows[0] = %s/%s, want CI workflow row", ci.Workflow, ci.Job)
+	}
+	if ci.Current.Count != 2 || ci.Previous.Count != 1 {
+		t.Errorf("CI counts = %d current / %d previous, want 2/1", ci.Current.Count, ci.Previous.Count)
+	}
+	if ci.Current.QueueP50 != 30*time.Second {
+		t.Errorf("CI queue p50 = %s, want 30s", ci.Current.QueueP50)
+	}
+	if got := ci.trend(); got != "+100% time, -50pp success" {
+		t.Errorf("CI trend = %q", got)
+	}
+	job := rows[1]
+	if job.Job != "test" || job.Current.P50 != 3*time.Minute || job.Current.QueueP50 != 5*time.Second {
+		t.Errorf("job row = %+v", job)
+	}
+	if got := job.trend(); got != "-" {
+		t.Errorf("job trend with no previous samples = %q, want -", got)
+	}
+}
+
+func TestWriteStats(t *testing.T) {
+	rows := []statsRow{{
+		Workflow: "CI",
+		Current:  statsSummary{Count: 3, P50: 90 * time.Second, SuccessRate: 1},
+	}}
+
+	var buf bytes.Buffer
+	if err := writeStats(&buf, rows, "table"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "WORKFLOW") || !strings.Contains(buf.String(), "1m30s") {
+		t.Errorf("table output = %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeStats(&buf, rows, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("json output did not parse: %v\n%s", err, buf.String())
+	}
+	if decoded[0]["workflow"] != "CI" {
+		t.Errorf("json output = %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeStats(&buf, rows, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "CI,,3,90,") {
+		t.Errorf("csv output = %q", buf.String())
+	}
+
+	if err := writeStats(&buf, rows, "xml"); err == nil {
+		t.Error("writeStats with unknown format should fail")
+	}
+}
+
+// TestDoStatsCapsEachPeriod checks that a busy current period doesn't use up
+// the run limit for the previous one, and that a period exactly at the limit
+// isn't reported as partial.
+func TestDoStatsCapsEachPeriod(t *testing.T) {
+	tests := []struct {
+		name         string
+		currentTotal int
+		wantRuns     int
+		wantPartial  bool
+	}{
+		{"over the cap", maxStatsRuns + 500, maxStatsRuns, true},
+		{"at the cap", maxStatsRuns, maxStatsRuns, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var jobLists atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/o/r/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+				from, to, ok := strings.Cut(r.URL.Query().Get("created"), "..")
+				if !ok {
+					t.Errorf("created = %q, want a range", r.URL.Query().Get("created"))
+				}
+				start, _ := time.Parse(time.RFC3339, from)
+				end, _ := time.Parse(time.RFC3339, to)
+				total := 2
+				if end.After(time.Now().Add(-time.Hour)) {
+					total = tt.currentTotal // the current period
+				}
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				var runs []string
+				for i := (page - 1) * 100; i < min(page*100, total); i++ {
+					created := start.Add(time.Duration(i+1) * time.Minute).Format(time.RFC3339)
+					runs = append(runs, fmt.Sprintf(`{"id": %d, "name": "CI", "status": "completed", "conclusion": "success", "created_at": %q, "run_started_at": %q, "updated_at": %q}`,
+						start.Unix()+int64(i), created, created, created))
+				}
+				fmt.Fprintf(w, `{"total_count": %d, "workflow_runs": [%s]}`, total, strings.Join(runs, ","))
+			})
+			mux.HandleFunc("/repos/o/r/actions/runs/", func(w http.ResponseWriter, r *http.Request) {
+				jobLists.Add(1)
+				w.Write([]byte(`{"total_count": 0, "jobs": []}`))
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+			client := ghactions.NewClient("token", "github.com")
+			client.Client.Base = srv.URL
+			remote := &RemoteURL{Host: "github.com", Path: "o", RepoName: "r"}
+
+			var out, errOut bytes.Buffer
+			if err := doStats(context.Background(), client, remote, &out, &errOut, "", 7, false, "json"); err != nil {
+				t.Fatal(err)
+			}
+			var rows []struct {
+				Current  struct{ Runs int }
+				Previous struct{ Runs int }
+				Partial  bool
+			}
+			if err := json.Unmarshal(out.Bytes(), &rows); err != nil {
+				t.Fatalf("%v\n%s", err, out.String())
+			}
+			if len(rows) != 1 || rows[0].Current.Runs != tt.wantRuns || rows[0].Previous.Runs != 2 || rows[0].Partial != tt.wantPartial {
+				t.Errorf("rows = %+v, want %d current runs, 2 previous, partial %t", rows, tt.wantRuns, tt.wantPartial)
+			}
+			warned := strings.Contains(errOut.String(), "the last 7 days had more than 1000 runs")
+			if warned != tt.wantPartial {
+				t.Errorf("stderr = %q, want a warning about the cap: %t", errOut.String(), tt.wantPartial)
+			}
+			if n := jobLists.Load(); n != 0 {
+				t.Errorf("listed jobs %d times without --jobs", n)
+			}
+		})
+	}
+}
@@ -3,17 +3,21 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
-	"net/url"
 	"os"
-	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	ghactions "github.com/kevinburke/github-actions/lib"
 )
 
+// progressBarWidth is the number of cells in each run's progress bar.
+const progressBarWidth = 10
+
 var spinnerFrames = [...]rune{'⠋', '⠙', '⠹', '⠸', '⠼', '⠴', '⠦', '⠧', '⠇', '⠏'}
 
 // ANSI escape code reference (all are CSI sequences: \033[ + parameters).
@@ -21,49 +25,128 @@ var spinnerFrames = [...]rune{'⠋', '⠙', '⠹', '⠸', '⠼', '⠴', '⠦', '
 //
 //   \033[<N>A    Move cursor up N lines.
 //   \033[2K      Erase the entire current line (cursor position unchanged).
+//   \033[J       Erase from the cursor to the end of the screen.
 //   \033[0m      Reset all text attributes (color, bold, etc.) to default.
 //   \033[31m     Set text color to red.
 //   \033[32m     Set text color to green.
 //   \033[33m     Set text color to yellow.
 //   \033[90m     Set text color to bright black (dim/gray).
 
+// screen is the block of status lines at the bottom of the terminal, which
+// each render redraws in place.
+type screen struct {
+	out   io.Writer // os.Stdout if nil
+	lines int       // number of lines drawn last time (for cursor-up)
+}
+
+func (sc *screen) writer() io.Writer {
+	if sc.out == nil {
+		return os.Stdout
+	}
+	return sc.out
+}
+
+// draw replaces the block with lines. Each line ends in "\r\n", so the block
+// looks the same whether or not the terminal is in raw mode.
+func (sc *screen) draw(lines []string) {
+	var buf strings.Builder
+	buf.WriteByte('\r')
+	if sc.lines > 0 {
+		fmt.Fprintf(&buf, "\033[%dA", sc.lines) // cursor up
+	}
+	for _, line := range lines {
+		fmt.Fprintf(&buf, "\033[2K%s\r\n", line)
+	}
+	// Erase anything left below the block, e.g. keys echoed while the
+	// terminal wasn't in raw mode.
+	buf.WriteString("\033[J")
+	sc.lines = len(lines)
+	io.WriteString(sc.writer(), buf.String())
+}
+
+// clear erases the block and leaves the cursor where it started, so the
+// next output prints where the block was.
+func (sc *screen) clear() {
+	if sc.lines == 0 {
+		return
+	}
+	fmt.Fprintf(sc.writer(), "\r\033[%dA\033[J", sc.lines)
+	sc.lines = 0
+}
+
 // statusRenderer handles TTY-aware status display for workflow runs.
 type statusRenderer struct {
 	isTTY   bool
 	noColor bool
 	quiet   bool
 
-	lastLines  int // number of lines rendered last time (for cursor-up)
+	screen     screen
 	spinnerIdx int
+	// ui is set while wait --interactive is taking keyboard input.
+	ui *waitUI
+
+	// clock is what elapsed times and ETAs are measured on; nil is the
+	// wall clock.
+	clock clock
 
 	// non-TTY throttling
 	lastPrintedAt time.Time
 	startTime     time.Time
 
-	// duration estimates: workflowID -> median duration
+	// duration estimates: workflowID -> median duration. Guarded by mu,
+	// since the background history refresh updates them while rendering.
+	mu            sync.Mutex
 	estimates     map[int64]time.Duration
+	profiles      map[int64]map[string]ghactions.JobProfile // workflowID -> job name -> profile
 	estimatesDone bool
+	refreshDone   chan struct{} // closed when the background refresh finishes
+
+	// jobs holds the most recently fetched jobs for each run ID, used to
+	// refine the ETA as jobs finish.
+	jobs map[int64][]ghactions.Job
+	// environments holds the deployment environments each waiting run is
+	// blocked on.
+	environments map[int64][]string
 }
 
-func newStatusRenderer(quiet bool) *statusRenderer {
+func newStatusRenderer(quiet bool, clk clock) *statusRenderer {
 	isTTY := ghactions.IsATTY()
 	return &statusRenderer{
 		isTTY:     isTTY,
 		noColor:   os.Getenv("NO_COLOR") != "",
 		quiet:     quiet,
-		startTime: time.Now(),
+		clock:     clk,
+		startTime: clk.Now(),
 	}
 }
 
-// fetchEstimates fetches historical run durations for each distinct workflow
-// and computes a median. Called once on the first poll that returns runs.
-func (s *statusRenderer) fetchEstimates(ctx context.Context, repo *ghactions.RepoService, runs []ghactions.WorkflowRun) {
+func (s *statusRenderer) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+// fetchEstimates computes a median duration for each distinct workflow.
+// Called once on the first poll that returns runs. Estimates come from the
+// on-disk duration history, so they are available immediately; the history is
+// then refreshed from newly completed runs in the background, a few workflows
+// at a time, and saved back to the cache. rateLimit reports the client's rate
+// limit, to slow the refresh down when the budget runs low; it may be nil.
+func (s *statusRenderer) fetchEstimates(ctx context.Context, repo *ghactions.RepoService, runs []ghactions.WorkflowRun, rateLimit func() *ghactions.RateLimit) {
 	if s.estimatesDone {
 		return
 	}
 	s.estimatesDone = true
+	s.mu.Lock()
 	s.estimates = make(map[int64]time.Duration)
+	s.mu.Unlock()
 
+	type workflowHistory struct {
+		name    string
+		history *ghactions.DurationHistory
+	}
+	var histories []workflowHistory
 	seen := make(map[int64]bool)
 	for _, run := range runs {
 		if seen[run.WorkflowID] {
@@ -71,49 +154,127 @@ func (s *statusRenderer) fetchEstimates(ctx context.Context, repo *ghactions.Rep
 		}
 		seen[run.WorkflowID] = true
 
-		params := url.Values{
-			"status":     {"completed"},
-			"conclusion": {"success"},
-			"per_page":   {"10"},
-		}
-		resp, err := repo.ListWorkflowRunsByWorkflow(ctx, run.WorkflowID, params)
+		h, err := repo.LoadDurationHistory(run.WorkflowID)
 		if err != nil {
-			slog.Debug("could not fetch historical runs", "workflow_id", run.WorkflowID, "error", err)
+			slog.Debug("could not load duration history", "workflow_id", run.WorkflowID, "error", err)
 			continue
 		}
-		durations := make([]time.Duration, 0, len(resp.WorkflowRuns))
-		for _, r := range resp.WorkflowRuns {
-			d := r.Duration()
-			conclusion := "<nil>"
-			if r.Conclusion != nil {
-				conclusion = *r.Conclusion
+		s.setEstimate(run.Name, h)
+		histories = append(histories, workflowHistory{name: run.Name, history: h})
+	}
+
+	s.refreshDone = make(chan struct{})
+	go func() {
+		defer close(s.refreshDone)
+		fanOut(len(histories), rateLimit, func(i int) {
+			wh := histories[i]
+			added, err := repo.RefreshDurationHistory(ctx, wh.history)
+			if err != nil {
+				slog.Debug("could not refresh duration history", "workflow", wh.name, "workflow_id", wh.history.WorkflowID, "error", err)
+				return
+			}
+			if added == 0 {
+				return
 			}
-			slog.Debug("historical run",
-				"workflow", run.Name,
-				"workflow_id", run.WorkflowID,
-				"run_id", r.ID,
-				"conclusion", conclusion,
-				"duration", d,
-				"run_started_at", r.RunStartedAt,
-				"updated_at", r.UpdatedAt,
-			)
-			if d > 0 {
-				durations = append(durations, d)
+			if err := wh.history.Save(); err != nil {
+				slog.Debug("could not save duration history", "workflow_id", wh.history.WorkflowID, "error", err)
 			}
+			s.setEstimate(wh.name, wh.history)
+		})
+	}()
+}
+
+// setEstimate records the median duration from h, if it has any samples.
+func (s *statusRenderer) setEstimate(name string, h *ghactions.DurationHistory) {
+	median, ok := h.Median()
+	if !ok {
+		return
+	}
+	slog.Debug("estimated duration",
+		"workflow", name,
+		"workflow_id", h.WorkflowID,
+		"median", median,
+		"sample_size", len(h.Samples),
+	)
+	profiles := h.JobProfiles()
+	s.mu.Lock()
+	s.estimates[h.WorkflowID] = median
+	if len(profiles) > 0 {
+		if s.profiles == nil {
+			s.profiles = make(map[int64]map[string]ghactions.JobProfile)
+		}
+		s.profiles[h.WorkflowID] = profiles
+	}
+	s.mu.Unlock()
+}
+
+// estimate returns the estimated total duration for a workflow.
+func (s *statusRenderer) estimate(workflowID int64) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	est, ok := s.estimates[workflowID]
+	return est, ok
+}
+
+// setJobs records the latest job list for a run.
+func (s *statusRenderer) setJobs(runID int64, jobs []ghactions.Job) {
+	if s.jobs == nil {
+		s.jobs = make(map[int64][]ghactions.Job)
+	}
+	s.jobs[runID] = jobs
+}
+
+// setEnvironments records the environments a waiting run is blocked on.
+func (s *statusRenderer) setEnvironments(runID int64, environments []string) {
+	if s.environments == nil {
+		s.environments = make(map[int64][]string)
+	}
+	s.environments[runID] = environments
+}
+
+// maxStatusWidth is the widest the status column gets; longer status text,
+// like a list of environments, is truncated.
+const maxStatusWidth = 32
+
+// statusText returns the run's status, naming the environments a waiting
+// run is blocked on, truncated to maxStatusWidth.
+func (s *statusRenderer) statusText(run ghactions.WorkflowRun) string {
+	if envs := s.environments[run.ID]; run.Status == ghactions.StatusWaiting && len(envs) > 0 {
+		text := "waiting on " + strings.Join(envs, ", ")
+		if r := []rune(text); len(r) > maxStatusWidth {
+			text = string(r[:maxStatusWidth-1]) + "…"
+		}
+		return text
+	}
+	return run.StatusText()
+}
+
+// runETA estimates when run will finish, from its jobs so far and the
+// workflow's duration history.
+func (s *statusRenderer) runETA(now time.Time, run ghactions.WorkflowRun) (runETA, bool) {
+	s.mu.Lock()
+	median := s.estimates[run.WorkflowID]
+	profiles := s.profiles[run.WorkflowID]
+	s.mu.Unlock()
+	return estimateRunETA(now, run, s.jobs[run.ID], profiles, median)
+}
+
+// overallETA returns the latest finish time across all incomplete runs.
+func (s *statusRenderer) overallETA(now time.Time, runs []ghactions.WorkflowRun) (time.Time, bool) {
+	var finish time.Time
+	found := false
+	for _, run := range runs {
+		if run.IsCompleted() {
+			continue
 		}
-		if len(durations) > 0 {
-			slices.Sort(durations)
-			median := durations[len(durations)/2]
-			slog.Debug("estimated duration",
-				"workflow", run.Name,
-				"workflow_id", run.WorkflowID,
-				"median", median,
-				"sample_size", len(durations),
-				"all_durations", durations,
-			)
-			s.estimates[run.WorkflowID] = median
+		eta, ok := s.runETA(now, run)
+		if !ok {
+			continue
 		}
+		found = true
+		finish = maxTime(finish, eta.Finish)
 	}
+	return finish, found
 }
 
 // render prints the current status of all workflow runs.
@@ -133,13 +294,18 @@ func (s *statusRenderer) render(runs []ghactions.WorkflowRun) {
 }
 
 func (s *statusRenderer) renderTTY(runs []ghactions.WorkflowRun) {
-	var buf strings.Builder
-
-	// Move cursor up N lines to overwrite the previous status block.
-	if s.lastLines > 0 {
-		fmt.Fprintf(&buf, "\033[%dA", s.lastLines) // cursor up
+	header, rows := s.statusLines(s.now(), runs)
+	lines := append(header, rows...)
+	if s.ui != nil {
+		lines = s.interactiveLines(header, runs, rows)
 	}
+	s.screen.draw(lines)
+	s.spinnerIdx++
+}
 
+// statusLines formats the status table: header lines, then a row for each
+// run. Rows start with two spaces of margin.
+func (s *statusRenderer) statusLines(now time.Time, runs []ghactions.WorkflowRun) (header, rows []string) {
 	// First pass: compute column widths for alignment.
 	// Name and identifier are separate columns so that identifiers like
 	// "[run 67]" right-align even when workflow names differ in length.
@@ -150,7 +316,13 @@ func (s *statusRenderer) renderTTY(runs []ghactions.WorkflowRun) {
 	maxDurMajor := 0
 	maxDurMinor := 0
 	maxEst := 0
-	for _, run := range runs {
+	maxStatus := 12
+	etas := make([]runETA, len(runs))
+	hasETA := make([]bool, len(runs))
+	for i, run := range runs {
+		if !run.IsCompleted() {
+			etas[i], hasETA[i] = s.runETA(now, run)
+		}
 		if len(run.Name) > maxName {
 			maxName = len(run.Name)
 		}
@@ -160,6 +332,7 @@ func (s *statusRenderer) renderTTY(runs []ghactions.WorkflowRun) {
 				maxId = len(idStr)
 			}
 		}
+		maxStatus = max(maxStatus, utf8.RuneCountInString(s.statusText(run)))
 		major, minor := durationParts(run.Duration())
 		if len(major) > maxDurMajor {
 			maxDurMajor = len(major)
@@ -167,8 +340,8 @@ func (s *statusRenderer) renderTTY(runs []ghactions.WorkflowRun) {
 		if len(minor) > maxDurMinor {
 			maxDurMinor = len(minor)
 		}
-		if run.Status == "in_progress" || run.Status == "queued" {
-			if est, ok := s.estimates[run.WorkflowID]; ok {
+		if !run.IsCompleted() {
+			if est, ok := s.estimate(run.WorkflowID); ok {
 				estStr := fmt.Sprintf("(~%s est)", formatEstimate(est))
 				if len(estStr) > maxEst {
 					maxEst = len(estStr)
@@ -177,8 +350,10 @@ func (s *statusRenderer) renderTTY(runs []ghactions.WorkflowRun) {
 		}
 	}
 
-	lines := 0
-	for _, run := range runs {
+	if finish, ok := s.overallETA(now, runs); ok {
+		header = append(header, fmt.Sprintf("  Estimated done at %s (~%s left)", finish.Format("15:04"), formatEstimate(finish.Sub(now))))
+	}
+	for i, run := range runs {
 		icon, color := s.statusIcon(run)
 
 		// Format duration with minute-boundary alignment: right-align the
@@ -198,109 +373,100 @@ func (s *statusRenderer) renderTTY(runs []ghactions.WorkflowRun) {
 		}
 
 		var estimate string
-		if run.Status == "in_progress" || run.Status == "queued" {
-			if est, ok := s.estimates[run.WorkflowID]; ok {
+		if !run.IsCompleted() {
+			if est, ok := s.estimate(run.WorkflowID); ok {
 				estimate = fmt.Sprintf("(~%s est)", formatEstimate(est))
 			}
 		}
 
-		statusText := run.Status
-		if run.IsCompleted() && run.Conclusion != nil {
-			statusText = *run.Conclusion
+		statusText := s.statusText(run)
+
+		// Progress bars only make sense for runs that are still going.
+		progress := strings.Repeat(" ", progressBarWidth+5)
+		if hasETA[i] {
+			progress = fmt.Sprintf("%s %3d%%", progressBar(etas[i].Progress, progressBarWidth), int(etas[i].Progress*100))
 		}
 
-		// Columns: icon | name (left) | id (right) | status (left) | dur (aligned) | est (right)
+		// Columns: icon | name (left) | id (right) | status (left) | dur (aligned) | progress | est (right)
 		if color != "" && !s.noColor {
 			// Apply color to the icon and status text, with \033[0m (reset)
 			// after each colored span to return to default terminal colors.
-			fmt.Fprintf(&buf, "\033[2K  %s%s\033[0m %-*s %*s  %s%-12s\033[0m %s  %*s\n",
-				color, icon, maxName, run.Name, maxId, idStr, color, statusText, durStr, maxEst, estimate)
+			rows = append(rows, fmt.Sprintf("  %s%s\033[0m %-*s %*s  %s%-*s\033[0m %s  %s  %*s",
+				color, icon, maxName, run.Name, maxId, idStr, color, maxStatus, statusText, durStr, progress, maxEst, estimate))
 		} else {
-			fmt.Fprintf(&buf, "\033[2K  %s %-*s %*s  %-12s %s  %*s\n",
-				icon, maxName, run.Name, maxId, idStr, statusText, durStr, maxEst, estimate)
+			rows = append(rows, fmt.Sprintf("  %s %-*s %*s  %-*s %s  %s  %*s",
+				icon, maxName, run.Name, maxId, idStr, maxStatus, statusText, durStr, progress, maxEst, estimate))
 		}
-		lines++
 	}
-
-	s.lastLines = lines
-	s.spinnerIdx++
-	os.Stdout.WriteString(buf.String())
+	return header, rows
 }
 
 // renderWaiting prints a "still waiting for runs" status line. On a TTY it
 // overwrites any previous status line so successive polls share one line; the
-// next render or clearStatus call wipes it via the normal lastLines mechanism.
+// next render or clearStatus call redraws or erases it like the status table.
 func (s *statusRenderer) renderWaiting(msg string) {
 	if s.quiet {
 		return
 	}
 	if !s.isTTY {
-		elapsed := time.Since(s.startTime).Round(time.Second)
+		elapsed := s.now().Sub(s.startTime).Round(time.Second)
 		if !shouldPrint(s.lastPrintedAt, elapsed) {
 			return
 		}
 		fmt.Println(msg)
-		s.lastPrintedAt = time.Now()
+		s.lastPrintedAt = s.now()
 		return
 	}
-	var buf strings.Builder
-	if s.lastLines > 0 {
-		fmt.Fprintf(&buf, "\033[%dA", s.lastLines)
-	}
-	fmt.Fprintf(&buf, "\033[2K%s\n", msg)
-	s.lastLines = 1
-	os.Stdout.WriteString(buf.String())
+	s.screen.draw([]string{msg})
 }
 
 func (s *statusRenderer) renderPlain(runs []ghactions.WorkflowRun) {
-	elapsed := time.Since(s.startTime).Round(time.Second)
+	elapsed := s.now().Sub(s.startTime).Round(time.Second)
 	if !shouldPrint(s.lastPrintedAt, elapsed) {
 		return
 	}
+	now := s.now()
 	for _, run := range runs {
-		status := run.Status
-		if run.IsCompleted() && run.Conclusion != nil {
-			status = *run.Conclusion
+		status := s.statusText(run)
+		if eta, ok := s.runETA(now, run); ok && !run.IsCompleted() {
+			fmt.Printf("Workflow %q %s (%s elapsed, ~%s left)\n", workflowRunDisplayName(run), status, run.Duration().String(), formatEstimate(eta.Finish.Sub(now)))
+			continue
 		}
 		fmt.Printf("Workflow %q %s (%s elapsed)\n", workflowRunDisplayName(run), status, run.Duration().String())
 	}
-	s.lastPrintedAt = time.Now()
+	s.lastPrintedAt = s.now()
 }
 
-// clearStatus erases the in-place status block before printing final output.
-// It moves the cursor up, clears each line, then moves back up so the final
-// output prints where the status block was.
+// clearStatus erases the in-place status block before printing final output,
+// so the output prints where the status block was.
 func (s *statusRenderer) clearStatus() {
-	if !s.isTTY || s.lastLines == 0 {
+	if !s.isTTY {
 		return
 	}
-	var buf strings.Builder
-	fmt.Fprintf(&buf, "\033[%dA", s.lastLines) // cursor up to top of status block
-	for range s.lastLines {
-		fmt.Fprintf(&buf, "\033[2K\n") // erase each line
-	}
-	fmt.Fprintf(&buf, "\033[%dA", s.lastLines) // cursor back up to start
-	os.Stdout.WriteString(buf.String())
-	s.lastLines = 0
+	s.screen.clear()
 }
 
 func (s *statusRenderer) statusIcon(run ghactions.WorkflowRun) (icon string, color string) {
+	if run.NeedsAttention() {
+		return "!", "\033[33m" // yellow
+	}
 	if run.IsCompleted() && run.Conclusion != nil {
-		switch *run.Conclusion {
-		case "success":
+		c := *run.Conclusion
+		switch {
+		case c == ghactions.ConclusionSuccess:
 			return "✓", "\033[32m" // green
-		case "failure", "cancelled", "timed_out":
+		case c.IsFailed():
 			return "✗", "\033[31m" // red
-		case "skipped":
+		case c == ghactions.ConclusionSkipped, c == ghactions.ConclusionNeutral:
 			return "-", "\033[90m" // dim
 		default:
 			return "?", "\033[90m" // dim
 		}
 	}
-	switch run.Status {
-	case "queued", "waiting", "pending":
+	switch {
+	case run.Status.IsPending():
 		return "□", "\033[33m" // yellow
-	case "in_progress":
+	case run.Status == ghactions.StatusInProgress:
 		frame := spinnerFrames[s.spinnerIdx%len(spinnerFrames)]
 		return string(frame), "\033[33m" // yellow
 	default:
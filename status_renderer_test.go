@@ -1,16 +1,52 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	ghactions "github.com/kevinburke/github-actions/lib"
 )
 
-func ptr(s string) *string { return &s }
+func ptr(c ghactions.Conclusion) *ghactions.Conclusion { return &c }
 
 func timePtr(t time.Time) *time.Time { return &t }
 
+func TestStatusTextNamesEnvironment(t *testing.T) {
+	s := &statusRenderer{}
+	run := ghactions.WorkflowRun{ID: 5, Status: "waiting"}
+	if got := s.statusText(run); got != "waiting" {
+		t.Errorf("statusText() = %q before environments are known, want waiting", got)
+	}
+	s.setEnvironments(5, []string{"production"})
+	if got := s.statusText(run); got != "waiting on production" {
+		t.Errorf("statusText() = %q, want %q", got, "waiting on production")
+	}
+}
+
+func TestStatusLinesAlignWaitingRuns(t *testing.T) {
+	s := &statusRenderer{noColor: true}
+	now := time.Now()
+	runs := []ghactions.WorkflowRun{
+		{ID: 1, Name: "CI", Status: "in_progress", RunStartedAt: timePtr(now.Add(-time.Minute)), UpdatedAt: now},
+		{ID: 2, Name: "Deploy", Status: "waiting", RunStartedAt: timePtr(now.Add(-time.Minute)), UpdatedAt: now},
+	}
+	s.setEnvironments(2, []string{"production-us-east-1", "production-eu-west-1"})
+	_, rows := s.statusLines(now, runs)
+	if !strings.Contains(rows[1], "…") {
+		t.Errorf("long status text wasn't truncated: %q", rows[1])
+	}
+	// The duration column starts at the same place on every row.
+	col := func(row string) int { return utf8.RuneCountInString(row[:strings.Index(row, "1m")]) }
+	if col(rows[0]) != col(rows[1]) {
+		t.Errorf("rows don't line up:\n%s\n%s", rows[0], rows[1])
+	}
+}
+
 func TestStatusIcon(t *testing.T) {
 	s := &statusRenderer{}
 
@@ -51,6 +87,45 @@ func TestStatusIcon(t *testing.T) {
 			},
 			wantIcon: "-",
 		},
+		{
+			name: "neutral",
+			run: ghactions.WorkflowRun{
+				Status:     "completed",
+				Conclusion: ptr("neutral"),
+			},
+			wantIcon: "-",
+		},
+		{
+			name: "startup_failure",
+			run: ghactions.WorkflowRun{
+				Status:     "completed",
+				Conclusion: ptr("startup_failure"),
+			},
+			wantIcon: "✗",
+		},
+		{
+			name: "stale",
+			run: ghactions.WorkflowRun{
+				Status:     "completed",
+				Conclusion: ptr("stale"),
+			},
+			wantIcon: "✗",
+		},
+		{
+			name: "action_required",
+			run: ghactions.WorkflowRun{
+				Status:     "completed",
+				Conclusion: ptr("action_required"),
+			},
+			wantIcon: "!",
+		},
+		{
+			name: "waiting",
+			run: ghactions.WorkflowRun{
+				Status: "waiting",
+			},
+			wantIcon: "!",
+		},
 		{
 			name: "queued",
 			run: ghactions.WorkflowRun{
@@ -58,6 +133,13 @@ func TestStatusIcon(t *testing.T) {
 			},
 			wantIcon: "□",
 		},
+		{
+			name: "requested",
+			run: ghactions.WorkflowRun{
+				Status: "requested",
+			},
+			wantIcon: "□",
+		},
 		{
 			name: "in_progress_spinner_frame_0",
 			run: ghactions.WorkflowRun{
@@ -255,8 +337,9 @@ func TestRenderTTYOutput(t *testing.T) {
 	if s.spinnerIdx != 1 {
 		t.Errorf("spinnerIdx = %d, want 1 after first render", s.spinnerIdx)
 	}
-	if s.lastLines != 3 {
-		t.Errorf("lastLines = %d, want 3", s.lastLines)
+	// Three runs plus the "Estimated done at" header.
+	if s.screen.lines != 4 {
+		t.Errorf("screen.lines = %d, want 4", s.screen.lines)
 	}
 }
 
@@ -311,27 +394,64 @@ func TestRenderTTYAlignment(t *testing.T) {
 	}
 
 	s.render(runs)
-	if s.lastLines != 4 {
-		t.Errorf("lastLines = %d, want 4", s.lastLines)
+	// Four runs plus the "Estimated done at" header.
+	if s.screen.lines != 5 {
+		t.Errorf("screen.lines = %d, want 5", s.screen.lines)
 	}
 }
 
 func TestClearStatusNoOp(t *testing.T) {
 	// clearStatus should be a no-op when not TTY
-	s := &statusRenderer{isTTY: false, lastLines: 5}
+	s := &statusRenderer{isTTY: false, screen: screen{lines: 5}}
 	s.clearStatus()
-	if s.lastLines != 5 {
-		t.Errorf("clearStatus modified lastLines for non-TTY")
+	if s.screen.lines != 5 {
+		t.Errorf("clearStatus modified screen.lines for non-TTY")
 	}
 
-	// clearStatus should be a no-op when lastLines is 0
-	s2 := &statusRenderer{isTTY: true, lastLines: 0}
+	// clearStatus should be a no-op when nothing has been drawn
+	s2 := &statusRenderer{isTTY: true}
 	s2.clearStatus()
 }
 
 func TestNewStatusRendererQuiet(t *testing.T) {
-	s := newStatusRenderer(true)
+	s := newStatusRenderer(true, realClock{})
 	if !s.quiet {
 		t.Error("expected quiet=true")
 	}
 }
+
+func TestFetchEstimatesUsesCachedHistory(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	// The server refuses every request, so any estimate must come from
+	// the on-disk cache.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message":"boom"}`))
+	}))
+	defer srv.Close()
+	client := ghactions.NewClient("token", "github.com")
+	client.Client.Base = srv.URL
+	repo := client.Repo("o", "r")
+
+	h, err := repo.LoadDurationHistory(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, d := range []time.Duration{3 * time.Minute, 5 * time.Minute, 4 * time.Minute} {
+		h.Samples = append(h.Samples, ghactions.RunSample{RunID: int64(i + 1), Duration: d})
+	}
+	if err := h.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &statusRenderer{}
+	s.fetchEstimates(context.Background(), repo, []ghactions.WorkflowRun{{Name: "CI", WorkflowID: 5}}, nil)
+	if got, ok := s.estimate(5); !ok || got != 4*time.Minute {
+		t.Errorf("estimate(5) = %s, %v, want 4m from cache", got, ok)
+	}
+	<-s.refreshDone
+	if got, _ := s.estimate(5); got != 4*time.Minute {
+		t.Errorf("failed refresh should keep the cached estimate, got %s", got)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// errDetachedHead is returned by currentBranch when HEAD doesn't point at a
+// branch, e.g. during a rebase or in a CI checkout.
+var errDetachedHead = errors.New("HEAD is detached")
+
+// target is the commit a command acts on, and how it was named.
+type target struct {
+	// Ref is the name the commit was resolved from: a branch, tag, SHA, or
+	// "HEAD" for a detached HEAD.
+	Ref string
+	// Branch is set if Ref names a local or remote-tracking branch; for a
+	// remote-tracking branch it doesn't include the remote name.
+	Branch string
+	// Tag is set if Ref names a tag.
+	Tag string
+	// SHA is the full commit SHA.
+	SHA string
+}
+
+// String describes the target for messages, e.g. "main", "tag v1.2.0" or
+// "commit 1a2b3c4d".
+func (t target) String() string {
+	switch {
+	case t.Branch != "":
+		return t.Branch
+	case t.Tag != "":
+		return "tag " + t.Tag
+	case t.Ref == "HEAD":
+		return "detached HEAD (" + shortRef(t.SHA) + ")"
+	default:
+		return "commit " + shortRef(t.SHA)
+	}
+}
+
+// arg returns the target as it would be passed to another subcommand.
+func (t target) arg() string {
+	switch {
+	case t.Branch != "":
+		return t.Branch
+	case t.Tag != "":
+		return t.Tag
+	default:
+		return shortRef(t.SHA)
+	}
+}
+
+// webPath returns the path of the target's page on GitHub, relative to the
+// repository: "tree/<branch>", "tree/<tag>" or "commit/<sha>".
+func (t target) webPath() string {
+	switch {
+	case t.Branch != "":
+		return "tree/" + t.Branch
+	case t.Tag != "":
+		return "tree/" + t.Tag
+	default:
+		return "commit/" + t.SHA
+	}
+}
+
+// classifyRef splits the output of "git rev-parse --symbolic-full-name" into a
+// branch or tag name. Both are empty for a SHA.
+func classifyRef(fullName string) (branch, tag string) {
+	switch {
+	case strings.HasPrefix(fullName, "refs/heads/"):
+		return strings.TrimPrefix(fullName, "refs/heads/"), ""
+	case strings.HasPrefix(fullName, "refs/tags/"):
+		return "", strings.TrimPrefix(fullName, "refs/tags/")
+	case strings.HasPrefix(fullName, "refs/remotes/"):
+		// refs/remotes/<remote>/<branch>
+		_, branch, ok := strings.Cut(strings.TrimPrefix(fullName, "refs/remotes/"), "/")
+		if ok && branch != "HEAD" {
+			return branch, ""
+		}
+	}
+	return "", ""
+}
+
+// symbolicFullName returns the full name of ref, e.g. "refs/tags/v1.2.0", or
+// an empty string if ref is a SHA.
+func symbolicFullName(ctx context.Context, ref string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", "rev-parse", "--symbolic-full-name", ref).Output()
+	if err != nil {
+		return "", fmt.Errorf("resolving %q: %w", ref, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+var fullSHARegexp = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// resolveTarget works out which commit a command should act on, from the
+// --sha flag, the --ref flag or the first positional argument, in that order,
+// falling back to the current branch or, if HEAD is detached, the commit HEAD
+// points at.
+func resolveTarget(ctx context.Context, args []string, sha, ref string) (target, error) {
+	if sha != "" && (ref != "" || len(args) > 0) {
+		return target{}, errors.New("--sha can't be combined with --ref or a ref argument")
+	}
+	if ref != "" && len(args) > 0 {
+		return target{}, errors.New("--ref can't be combined with a ref argument")
+	}
+	name := sha
+	if name == "" {
+		name = ref
+	}
+	if name == "" && len(args) > 0 {
+		name = args[0]
+	}
+	if name == "" {
+		branch, err := currentBranch(ctx)
+		switch {
+		case errors.Is(err, errDetachedHead):
+			name = "HEAD"
+		case err != nil:
+			return target{}, err
+		default:
+			name = branch
+		}
+	}
+
+	t := target{Ref: name}
+	tip, err := gitTip(ctx, name)
+	if err != nil {
+		// A full SHA from a CI log may not have been fetched; the API
+		// doesn't need it to be local.
+		if sha != "" && fullSHARegexp.MatchString(sha) {
+			t.SHA = strings.ToLower(sha)
+			return t, nil
+		}
+		return target{}, err
+	}
+	t.SHA = tip
+	if sha != "" || name == "HEAD" {
+		return t, nil
+	}
+	fullName, err := symbolicFullName(ctx, name)
+	if err != nil {
+		return target{}, err
+	}
+	t.Branch, t.Tag = classifyRef(fullName)
+	return t, nil
+}
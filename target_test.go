@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestClassifyRef(t *testing.T) {
+	tests := []struct {
+		fullName string
+		branch   string
+		tag      string
+	}{
+		{"refs/heads/main", "main", ""},
+		{"refs/heads/feature/login", "feature/login", ""},
+		{"refs/tags/v1.2.0", "", "v1.2.0"},
+		{"refs/remotes/origin/release/1.x", "release/1.x", ""},
+		{"refs/remotes/origin/HEAD", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		branch, tag := classifyRef(tt.fullName)
+		if branch != tt.branch || tag != tt.tag {
+			t.Errorf("classifyRef(%q) = (%q, %q), want (%q, %q)", tt.fullName, branch, tag, tt.branch, tt.tag)
+		}
+	}
+}
+
+func TestTargetDescriptions(t *testing.T) {
+	const sha = "1a2b3c4d5e6f7a8b9c0d1a2b3c4d5e6f7a8b9c0d"
+	tests := []struct {
+		name    string
+		target  target
+		str     string
+		arg     string
+		webPath string
+	}{
+		{"branch", target{Ref: "main", Branch: "main", SHA: sha}, "main", "main", "tree/main"},
+		{"tag", target{Ref: "v1.2.0", Tag: "v1.2.0", SHA: sha}, "tag v1.2.0", "v1.2.0", "tree/v1.2.0"},
+		{"sha", target{Ref: sha, SHA: sha}, "commit 1a2b3c4d", "1a2b3c4d", "commit/" + sha},
+		{"detached", target{Ref: "HEAD", SHA: sha}, "detached HEAD (1a2b3c4d)", "1a2b3c4d", "commit/" + sha},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.target.String(); got != tt.str {
+				t.Errorf("String() = %q, want %q", got, tt.str)
+			}
+			if got := tt.target.arg(); got != tt.arg {
+				t.Errorf("arg() = %q, want %q", got, tt.arg)
+			}
+			if got := tt.target.webPath(); got != tt.webPath {
+				t.Errorf("webPath() = %q, want %q", got, tt.webPath)
+			}
+		})
+	}
+}
+
+func TestResolveTargetConflictingFlags(t *testing.T) {
+	tests := []struct {
+		args     []string
+		sha, ref string
+		want     string
+	}{
+		{[]string{"main"}, "abc123", "", "--sha can't be combined"},
+		{nil, "abc123", "main", "--sha can't be combined"},
+		{[]string{"main"}, "", "v1.0", "--ref can't be combined"},
+	}
+	for _, tt := range tests {
+		_, err := resolveTarget(context.Background(), tt.args, tt.sha, tt.ref)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("resolveTarget(%q, %q, %q) = %v, want error containing %q", tt.args, tt.sha, tt.ref, err, tt.want)
+		}
+	}
+}
+
+func TestResolveTargetUnknownFullSHA(t *testing.T) {
+	// A commit that isn't in the local clone can still be waited on by SHA.
+	const sha = "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"
+	got, err := resolveTarget(context.Background(), nil, sha, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SHA != strings.ToLower(sha) || got.Branch != "" || got.Tag != "" {
+		t.Errorf("resolveTarget(--sha) = %+v, want the lowercased SHA and no branch or tag", got)
+	}
+}